@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func expectValue(t *testing.T, c *LRU, key string, want string) {
+	t.Helper()
+	value, ok, err := c.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want == "" {
+		if ok {
+			t.Fatalf("%s = %q, want missing", key, value)
+		}
+		return
+	}
+	if !ok || string(value) != want {
+		t.Fatalf("%s = %q (found %v), want %q", key, value, ok, want)
+	}
+}
+
+func TestLRUSetGetDelete(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+
+	_ = c.Set(ctx, "a", []byte("1"), 0)
+	_ = c.Set(ctx, "b", []byte("2"), 0)
+	_ = c.Set(ctx, "a", []byte("3"), 0)
+	expectValue(t, c, "a", "3")
+	expectValue(t, c, "b", "2")
+
+	if err := c.Delete(ctx, "a", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, c, "a", "")
+	expectValue(t, c, "b", "2")
+	if c.Len() != 1 {
+		t.Fatalf("got %d entries, want 1", c.Len())
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+
+	_ = c.Set(ctx, "short", []byte("1"), 10*time.Millisecond)
+	_ = c.Set(ctx, "forever", []byte("2"), 0)
+	time.Sleep(20 * time.Millisecond)
+
+	expectValue(t, c, "short", "")
+	expectValue(t, c, "forever", "2")
+	if c.Len() != 1 {
+		t.Fatalf("got %d entries, want the expired one removed", c.Len())
+	}
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+
+	_ = c.Set(ctx, "a", []byte("1"), 0)
+	_ = c.Set(ctx, "b", []byte("2"), 0)
+	expectValue(t, c, "a", "1") // a is now more recent than b
+	_ = c.Set(ctx, "c", []byte("3"), 0)
+
+	expectValue(t, c, "b", "")
+	expectValue(t, c, "a", "1")
+	expectValue(t, c, "c", "3")
+
+	// Capacities below one still hold an entry
+	tiny := NewLRU(0)
+	_ = tiny.Set(ctx, "a", []byte("1"), 0)
+	expectValue(t, tiny, "a", "1")
+}
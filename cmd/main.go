@@ -3,45 +3,242 @@ package main
 import (
 	"context"
 	"errors"
+	"github.com/Ahmad-mufied/iducate-community-service/cache"
 	"github.com/Ahmad-mufied/iducate-community-service/config"
 	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/digest"
+	"github.com/Ahmad-mufied/iducate-community-service/events"
+	"github.com/Ahmad-mufied/iducate-community-service/health"
+	"github.com/Ahmad-mufied/iducate-community-service/logging"
+	"github.com/Ahmad-mufied/iducate-community-service/mailer"
+	"github.com/Ahmad-mufied/iducate-community-service/metrics"
+	"github.com/Ahmad-mufied/iducate-community-service/migrations"
+	"github.com/Ahmad-mufied/iducate-community-service/moderation"
+	"github.com/Ahmad-mufied/iducate-community-service/realtime"
 	"github.com/Ahmad-mufied/iducate-community-service/server"
 	"github.com/Ahmad-mufied/iducate-community-service/server/handler"
+	"github.com/Ahmad-mufied/iducate-community-service/server/middlewares"
+	"github.com/Ahmad-mufied/iducate-community-service/tracing"
+	"github.com/Ahmad-mufied/iducate-community-service/views"
+	"github.com/Ahmad-mufied/iducate-community-service/webhooks"
 	"github.com/go-playground/validator/v10"
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
 func main() {
+	// LOG_LEVEL is debug, info, warn or error
+	if config.Viper.IsSet("LOG_LEVEL") {
+		if err := logging.SetLevel(config.Viper.GetString("LOG_LEVEL")); err != nil {
+			logging.Fatal("Failed to configure logging", "error", err)
+		}
+	}
+
 	postgresDb := config.InitDB()
 
+	// `main migrate ...` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(postgresDb, os.Args[2:]); err != nil {
+			logging.Fatal("Migration failed", "error", err)
+		}
+		return
+	}
+
+	// `main reconcile-counters` recomputes the post counters and exits
+	if len(os.Args) > 1 && os.Args[1] == "reconcile-counters" {
+		fixed, err := data.New(postgresDb).Post.ReconcileCounters(context.Background())
+		if err != nil {
+			logging.Fatal("Reconciling counters failed", "error", err)
+		}
+		slog.Info("Reconciled counters", "posts", fixed)
+		return
+	}
+
+	// Optionally bring the schema up to date before serving
+	if config.Viper.GetBool("AUTO_MIGRATE") {
+		if err := runMigrateCommand(postgresDb, []string{"up"}); err != nil {
+			logging.Fatal("Migration failed", "error", err)
+		}
+	}
+
+	// Traces are exported over OTLP when a collector is configured
+	tracingConfig := tracing.Config{
+		Endpoint:    config.Viper.GetString("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName: config.Viper.GetString("OTEL_SERVICE_NAME"),
+	}
+	if config.Viper.IsSet("OTEL_TRACES_SAMPLER_ARG") {
+		tracingConfig.SampleRatio = config.Viper.GetFloat64("OTEL_TRACES_SAMPLER_ARG")
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingConfig)
+	if err != nil {
+		logging.Fatal("Failed to configure tracing", "error", err)
+	}
+
+	// Connection pool stats are exported along with the other metrics
+	metrics.RegisterDB(postgresDb.DB)
+
+	// Readiness needs the database to answer and the schema of this build
+	migrator, err := migrations.New(postgresDb)
+	if err != nil {
+		logging.Fatal("Failed to load migrations", "error", err)
+	}
+	var readinessTimeout time.Duration
+	if config.Viper.IsSet("READINESS_TIMEOUT") {
+		readinessTimeout = config.Viper.GetDuration("READINESS_TIMEOUT")
+	}
+	healthChecker := health.NewChecker(postgresDb, migrator, readinessTimeout)
+
+	// ID tokens are verified against the user pool's keys, which readiness
+	// waits for
+	var signingKeys *middlewares.JWKS
+	if jwksURL := config.Viper.GetString("COGNITO_JWKS_URL"); jwksURL != "" {
+		signingKeys = middlewares.NewJWKS(jwksURL)
+		healthChecker.Register("jwks", signingKeys.Check)
+	} else {
+		slog.Warn("COGNITO_JWKS_URL not set, ID tokens are not verified")
+	}
+
 	dbModel := data.New(postgresDb)
 	validate := validator.New()
-	handler.InitHandler(dbModel, validate)
 
-	startAndGracefullyStopServer(echo.New())
+	// Content filter backs the `clean` validation tag
+	contentFilter, err := moderation.NewContentFilterFromConfig(config.Viper)
+	if err != nil {
+		logging.Fatal("Failed to configure content filter", "error", err)
+	}
+	if err := contentFilter.RegisterValidation(validate); err != nil {
+		logging.Fatal("Failed to register content filter", "error", err)
+	}
+
+	spamScorer := moderation.NewSpamScorerFromConfig(config.Viper)
+
+	// Post views are buffered and written in batches
+	flushInterval := 10 * time.Second
+	if config.Viper.IsSet("VIEW_FLUSH_INTERVAL") {
+		flushInterval = config.Viper.GetDuration("VIEW_FLUSH_INTERVAL")
+	}
+	dedupWindow := 30 * time.Minute
+	if config.Viper.IsSet("VIEW_DEDUP_WINDOW") {
+		dedupWindow = config.Viper.GetDuration("VIEW_DEDUP_WINDOW")
+	}
+	viewCounter := views.NewCounter(dbModel.Post, flushInterval, dedupWindow)
+	viewCounter.Start()
+
+	// Feed, post detail and counts are served through a read-through cache
+	cacheSize := 1000
+	if config.Viper.IsSet("CACHE_SIZE") {
+		cacheSize = config.Viper.GetInt("CACHE_SIZE")
+	}
+	cacheTTL := data.CacheTTL{Feed: 30 * time.Second, Post: time.Minute, Count: 30 * time.Second}
+	if config.Viper.IsSet("CACHE_FEED_TTL") {
+		cacheTTL.Feed = config.Viper.GetDuration("CACHE_FEED_TTL")
+	}
+	if config.Viper.IsSet("CACHE_POST_TTL") {
+		cacheTTL.Post = config.Viper.GetDuration("CACHE_POST_TTL")
+	}
+	if config.Viper.IsSet("CACHE_COUNT_TTL") {
+		cacheTTL.Count = config.Viper.GetDuration("CACHE_COUNT_TTL")
+	}
+	cachedModel := data.NewCached(dbModel, cache.NewLRU(cacheSize), cacheTTL)
+
+	// Real-time events for the SSE streams
+	replaySize := 1000
+	if config.Viper.IsSet("EVENTS_REPLAY_SIZE") {
+		replaySize = config.Viper.GetInt("EVENTS_REPLAY_SIZE")
+	}
+	eventBus := events.NewBus(replaySize)
+
+	// Live comment threads over WebSocket
+	maxConnectionsPerUser := 5
+	if config.Viper.IsSet("WS_MAX_CONNECTIONS_PER_USER") {
+		maxConnectionsPerUser = config.Viper.GetInt("WS_MAX_CONNECTIONS_PER_USER")
+	}
+	liveHub := realtime.NewHub(eventBus, realtime.Config{
+		MaxConnectionsPerUser: maxConnectionsPerUser,
+		SendBuffer:            32,
+	})
+
+	// Outbox events are delivered to the registered webhook endpoints
+	webhookConfig := webhooks.Config{}
+	if config.Viper.IsSet("WEBHOOK_POLL_INTERVAL") {
+		webhookConfig.PollInterval = config.Viper.GetDuration("WEBHOOK_POLL_INTERVAL")
+	}
+	if config.Viper.IsSet("WEBHOOK_TIMEOUT") {
+		webhookConfig.Timeout = config.Viper.GetDuration("WEBHOOK_TIMEOUT")
+	}
+	if config.Viper.IsSet("WEBHOOK_MAX_ATTEMPTS") {
+		webhookConfig.MaxAttempts = config.Viper.GetInt("WEBHOOK_MAX_ATTEMPTS")
+	}
+	webhookDispatcher := webhooks.NewDispatcher(dbModel.Webhook, webhookConfig)
+	webhookDispatcher.Start()
+
+	// Email digests are sent when an SMTP server is configured
+	var digestSender *digest.Sender
+	if config.Viper.GetString("SMTP_HOST") != "" {
+		smtpMailer, err := mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     config.Viper.GetString("SMTP_HOST"),
+			Port:     config.Viper.GetInt("SMTP_PORT"),
+			Username: config.Viper.GetString("SMTP_USERNAME"),
+			Password: config.Viper.GetString("SMTP_PASSWORD"),
+			From:     config.Viper.GetString("MAIL_FROM"),
+		})
+		if err != nil {
+			logging.Fatal("Failed to configure mailer", "error", err)
+		}
+
+		// Emails link back to the unsubscribe endpoint
+		publicURL := config.Viper.GetString("PUBLIC_URL")
+		if publicURL == "" {
+			logging.Fatal("PUBLIC_URL is required to send email digests")
+		}
+
+		digestConfig := digest.Config{
+			AppURL:         config.Viper.GetString("APP_URL"),
+			UnsubscribeURL: strings.TrimRight(publicURL, "/") + "/digest/unsubscribe",
+		}
+		if config.Viper.IsSet("DIGEST_INTERVAL") {
+			digestConfig.Interval = config.Viper.GetDuration("DIGEST_INTERVAL")
+		}
+		digestSender = digest.NewSender(dbModel.Digest, dbModel.Notification, smtpMailer, digestConfig)
+		digestSender.Start()
+	} else {
+		slog.Info("SMTP_HOST not set, email digests are disabled")
+	}
+
+	h := handler.New(cachedModel, validate, contentFilter, spamScorer, viewCounter, eventBus, liveHub)
+
+	// Echo's banner and port line aren't JSON, the server logs its own start
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+
+	startAndGracefullyStopServer(e, h, signingKeys, viewCounter, eventBus, liveHub, webhookDispatcher, digestSender, shutdownTracing, healthChecker, postgresDb)
 
 }
 
-func startAndGracefullyStopServer(e *echo.Echo) {
+func startAndGracefullyStopServer(e *echo.Echo, h *handler.Handler, signingKeys *middlewares.JWKS, viewCounter *views.Counter, eventBus *events.Bus, liveHub *realtime.Hub, webhookDispatcher *webhooks.Dispatcher, digestSender *digest.Sender, shutdownTracing func(context.Context) error, healthChecker *health.Checker, postgresDb *sqlx.DB) {
 	// Register routes
-	server.Routes(e)
+	server.Routes(e, h, signingKeys)
+	server.HealthRoutes(e, healthChecker)
 
 	env := config.Viper.GetString("APP_ENV")
 	port := "8080"
 
 	if env == "production" {
-		log.Println("Running in production mode")
+		slog.Info("Running in production mode")
 		port = config.Viper.GetString("PORT")
 	} else {
-		log.Println("Running in development mode")
+		slog.Info("Running in development mode")
 	}
 
-	log.Printf("Starting server on port %s...", port)
+	slog.Info("Starting server", "port", port)
 
 	srv := &http.Server{
 		Addr:    ":" + port,
@@ -50,21 +247,113 @@ func startAndGracefullyStopServer(e *echo.Echo) {
 
 	go func() {
 		if err := e.StartServer(srv); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("Failed to start server: %v", err)
+			logging.Fatal("Failed to start server", "error", err)
 		}
 	}()
 
-	// Graceful shutdown
+	// Metrics get their own server on an internal port, if configured
+	var metricsSrv *http.Server
+	if metricsPort := config.Viper.GetString("METRICS_PORT"); metricsPort != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:              ":" + metricsPort,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		slog.Info("Serving metrics", "port", metricsPort)
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logging.Fatal("Failed to start metrics server", "error", err)
+			}
+		}()
+	}
+
+	// Graceful shutdown on Ctrl+C and on SIGTERM from container runtimes
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	sig := <-quit
+	slog.Info("Received signal", "signal", sig.String())
 
-	log.Println("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// A second signal doesn't wait for the shutdown to finish
+	go func() {
+		sig := <-quit
+		logging.Fatal("Forced exit", "signal", sig.String())
+	}()
+
+	// Fail readiness first, so load balancers stop sending requests while
+	// the server still takes them
+	healthChecker.Drain()
+	drainDelay := 5 * time.Second
+	if config.Viper.IsSet("SHUTDOWN_DRAIN_DELAY") {
+		drainDelay = config.Viper.GetDuration("SHUTDOWN_DRAIN_DELAY")
+	}
+	if drainDelay > 0 {
+		slog.Info("Draining before shutdown", "delay", drainDelay.String())
+		time.Sleep(drainDelay)
+	}
+
+	// SHUTDOWN_TIMEOUT bounds everything below
+	shutdownTimeout := 10 * time.Second
+	if config.Viper.IsSet("SHUTDOWN_TIMEOUT") {
+		shutdownTimeout = config.Viper.GetDuration("SHUTDOWN_TIMEOUT")
+	}
+
+	slog.Info("Shutting down server...", "timeout", shutdownTimeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
+
+	// End the event streams first, Shutdown waits for open connections and
+	// doesn't see the hijacked WebSocket ones. The hub goes before the bus so
+	// WebSocket clients are told 1001 going away rather than 1013 try again
+	// when their subscriptions end.
+	liveHub.Close()
+	eventBus.Close()
+
+	// Stop accepting requests and wait for those in flight. Past the timeout
+	// the remaining connections are cut and the workers below are given up.
 	if err := e.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		slog.Error("Server forced to shutdown", "error", err)
+		if err := e.Close(); err != nil {
+			slog.Error("Failed to close server", "error", err)
+		}
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			slog.Error("Failed to stop metrics server", "error", err)
+		}
+	}
+
+	// Background workers next. Notifications are written in the transaction
+	// of their request, so they are done along with the requests.
+
+	// Let the webhook deliveries in flight finish, the rest stay in the outbox
+	if err := webhookDispatcher.Close(ctx); err != nil {
+		slog.Error("Failed to stop webhook dispatcher", "error", err)
+	}
+
+	// Finish the digest batch in progress
+	if digestSender != nil {
+		if err := digestSender.Close(ctx); err != nil {
+			slog.Error("Failed to stop digest sender", "error", err)
+		}
+	}
+
+	// Write the views buffered since the last flush
+	if err := viewCounter.Close(ctx); err != nil {
+		slog.Error("Failed to flush post views", "error", err)
+	}
+
+	// Export the spans still buffered
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
+	// Nothing uses the database anymore
+	if err := postgresDb.Close(); err != nil {
+		slog.Error("Failed to close database", "error", err)
 	}
 
-	log.Println("Server exiting")
+	slog.Info("Server exiting")
 }
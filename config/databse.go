@@ -2,19 +2,20 @@ package config
 
 import (
 	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/logging"
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/jmoiron/sqlx"
 	"github.com/spf13/viper"
-	"log"
+	"log/slog"
 	"time"
 )
 
 func InitDB() *sqlx.DB {
 	conn := connectToDB(Viper)
 	if conn == nil {
-		log.Fatal("can't connect to database")
+		logging.Fatal("can't connect to database")
 		return nil
 	}
 	return conn
@@ -43,10 +44,9 @@ func connectToDB(v *viper.Viper) *sqlx.DB {
 	for {
 		connection, err := openDB(dsn)
 		if err != nil {
-			log.Println("PostgreSQL not yet ready...")
-			log.Printf("Open DB Error: %v", err)
+			slog.Warn("PostgreSQL not yet ready...", "error", err)
 		} else {
-			log.Print("connected to database!")
+			slog.Info("connected to database!")
 			return connection
 		}
 
@@ -54,7 +54,7 @@ func connectToDB(v *viper.Viper) *sqlx.DB {
 			return nil
 		}
 
-		log.Printf("Backing off for 1 second : %v", counts)
+		slog.Info("Backing off for 1 second", "attempt", counts)
 		time.Sleep(1 * time.Second)
 		counts++
 
@@ -3,7 +3,7 @@ package config
 import (
 	"fmt"
 	"github.com/spf13/viper"
-	"log"
+	"log/slog"
 	"os"
 )
 
@@ -14,7 +14,7 @@ func init() {
 	// Directly read the environment variable using os.Getenv
 	env := os.Getenv("APP_ENV")
 	if env == "" {
-		log.Println("APP_ENV not set, defaulting to 'development'")
+		slog.Info("APP_ENV not set, defaulting to 'development'")
 		env = "development"
 	}
 
@@ -22,12 +22,10 @@ func init() {
 	v := viper.New()
 
 	if err := checkFileExists(); err != nil {
-		log.Println(err)
-		log.Printf("Loaded From Enivronment Variables. APP_ENV: %s \n", env)
+		slog.Info("Loaded From Enivronment Variables", "app_env", env, "reason", err.Error())
 		v.AutomaticEnv()
 	} else {
-		log.Print("File .env exists\n")
-		log.Print("Loaded .env file\n")
+		slog.Info("Loaded .env file", "app_env", env)
 
 		// Set the configuration file based on the environment
 		v.SetConfigFile(fmt.Sprint(".env"))
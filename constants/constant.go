@@ -10,10 +10,17 @@ const (
 	ResponseStatusSuccess = "Success"
 )
 
+// Shared API errors. Use WithDetail to attach request specific information.
 var (
-	ErrNotFound            = utils.NewAPIError(http.StatusNotFound, "Resource not found", "")
-	ErrBadRequest          = utils.NewAPIError(http.StatusBadRequest, "Invalid request data", "")
-	ErrInternalServerError = utils.NewAPIError(http.StatusInternalServerError, "Internal Server Error", "")
-	ErrUnauthorized        = utils.NewAPIError(http.StatusUnauthorized, "Unauthorized access", "")
-	ErrConflict            = utils.NewAPIError(http.StatusConflict, "Resource already exists", "")
+	ErrNotFound            = utils.NewAPIError(http.StatusNotFound, "not_found", "Resource not found", nil)
+	ErrBadRequest          = utils.NewAPIError(http.StatusBadRequest, "bad_request", "Invalid request data", nil)
+	ErrInternalServerError = utils.NewAPIError(http.StatusInternalServerError, "internal_error", "Internal Server Error", nil)
+	ErrUnauthorized        = utils.NewAPIError(http.StatusUnauthorized, "unauthorized", "Unauthorized access", nil)
+	ErrForbidden           = utils.NewAPIError(http.StatusForbidden, "forbidden", "Access to the resource is forbidden", nil)
+	ErrConflict            = utils.NewAPIError(http.StatusConflict, "conflict", "Resource already exists", nil)
+	ErrTooManyRequests     = utils.NewAPIError(http.StatusTooManyRequests, "too_many_requests", "Too many requests, please try again later", nil)
+	ErrSpamRejected        = utils.NewAPIError(http.StatusUnprocessableEntity, "spam_rejected", "Content was rejected as spam", nil)
+
+	ErrIdempotencyKeyReused     = utils.NewAPIError(http.StatusConflict, "idempotency_key_reused", "Idempotency-Key was already used with a different request", nil)
+	ErrIdempotencyKeyInProgress = utils.NewAPIError(http.StatusConflict, "idempotency_key_in_progress", "A request with this Idempotency-Key is still in progress", nil)
 )
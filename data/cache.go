@@ -0,0 +1,337 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/cache"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// feedGenerationKey holds the generation embedded in every feed key. Deleting
+// it drops all cached feed pages at once: the next read starts a new
+// generation and the old pages are never read again. Only writes adding or
+// removing posts do so; the counts shown in the feed catch up with likes and
+// comments when the pages expire.
+const feedGenerationKey = "posts:feed:gen"
+
+// CacheTTL sets how long each kind of cached read is kept
+type CacheTTL struct {
+	Feed  time.Duration // Pages of GET /posts
+	Post  time.Duration // Post detail with its comments
+	Count time.Duration // Like and comment counts
+}
+
+// NewCached puts a read-through cache in front of the feed, post detail and
+// count queries of models. Writes going through the returned Models
+// invalidate the affected entries; inside WithTx reads bypass the cache and
+// invalidation waits until the transaction has committed. Cache failures are
+// logged and the query falls back to models.
+func NewCached(models *Models, store cache.Store, ttl CacheTTL) *Models {
+	c := &modelCache{store: store, ttl: ttl}
+
+	cached := c.wrap(models, false, c.invalidate)
+	cached.withTx = func(ctx context.Context, fn func(tx *Models) error) error {
+		var keys []string
+		collect := func(ctx context.Context, k ...string) {
+			keys = append(keys, k...)
+		}
+
+		err := models.WithTx(ctx, func(tx *Models) error {
+			wrapped := c.wrap(tx, true, collect)
+			wrapped.withTx = nestedTx(wrapped)
+			return fn(wrapped)
+		})
+		if err == nil {
+			c.invalidate(ctx, keys...)
+		}
+		return err
+	}
+	return cached
+}
+
+type modelCache struct {
+	store cache.Store
+	ttl   CacheTTL
+}
+
+// invalidateFunc drops the given cache keys
+type invalidateFunc func(ctx context.Context, keys ...string)
+
+func (c *modelCache) wrap(models *Models, bypass bool, invalidate invalidateFunc) *Models {
+	return &Models{
+		Post:       &cachedPostRepository{PostInterfaces: models.Post, cache: c, bypass: bypass, invalidate: invalidate},
+		Comment:    &cachedCommentRepository{CommentInterfaces: models.Comment, cache: c, bypass: bypass, invalidate: invalidate},
+		Like:       &cachedLikeRepository{LikeInterfaces: models.Like, cache: c, bypass: bypass, invalidate: invalidate},
+		Spam:       models.Spam,
+		Moderation: &cachedModerationRepository{ModerationInterfaces: models.Moderation, invalidate: invalidate},
+
+		Notification: models.Notification,
+		User:         models.User,
+		Mention:      models.Mention,
+		Webhook:      models.Webhook,
+		Digest:       models.Digest,
+	}
+}
+
+func (c *modelCache) invalidate(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	if err := c.store.Delete(ctx, keys...); err != nil {
+		slog.ErrorContext(ctx, "Failed to invalidate cache keys", "keys", keys, "error", err)
+	}
+}
+
+// get decodes the value cached under key into dest and reports whether it was found
+func (c *modelCache) get(ctx context.Context, key string, dest interface{}) bool {
+	value, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read cache key", "key", key, "error", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(value, dest); err != nil {
+		slog.ErrorContext(ctx, "Failed to decode cache key", "key", key, "error", err)
+		return false
+	}
+	return true
+}
+
+func (c *modelCache) set(ctx context.Context, key string, value interface{}, ttl time.Duration) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to encode cache key", "key", key, "error", err)
+		return
+	}
+	if err := c.store.Set(ctx, key, encoded, ttl); err != nil {
+		slog.ErrorContext(ctx, "Failed to write cache key", "key", key, "error", err)
+	}
+}
+
+// feedGeneration returns the current feed generation, starting a new one when
+// the previous was invalidated
+func (c *modelCache) feedGeneration(ctx context.Context) string {
+	value, ok, err := c.store.Get(ctx, feedGenerationKey)
+	if err == nil && ok {
+		return string(value)
+	}
+
+	generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := c.store.Set(ctx, feedGenerationKey, []byte(generation), 0); err != nil {
+		slog.ErrorContext(ctx, "Failed to write cache key", "key", feedGenerationKey, "error", err)
+	}
+	return generation
+}
+
+func feedKey(generation string, query PaginatedFeedQuery) string {
+	return fmt.Sprintf("posts:feed:%s:%s:%s:%d:%d", generation, query.SortType, query.Sort, query.Limit, query.Offset)
+}
+
+func postDetailKey(postID uint) string {
+	return fmt.Sprintf("posts:detail:%d", postID)
+}
+
+func likeCountKey(postID uint) string {
+	return fmt.Sprintf("likes:count:%d", postID)
+}
+
+func commentCountKey(postID uint) string {
+	return fmt.Sprintf("comments:count:%d", postID)
+}
+
+// postKeys are the entries that change with the likes or comments of a post
+func postKeys(postID uint) []string {
+	return []string{postDetailKey(postID), likeCountKey(postID), commentCountKey(postID)}
+}
+
+type cachedPostRepository struct {
+	PostInterfaces
+	cache      *modelCache
+	bypass     bool
+	invalidate invalidateFunc
+}
+
+type cachedPostDetail struct {
+	Post     *PostResponse      `json:"post"`
+	Comments []*CommentResponse `json:"comments"`
+}
+
+func (p *cachedPostRepository) GetPaginatedPosts(ctx context.Context, query PaginatedFeedQuery) ([]PostResponse, error) {
+	if p.bypass {
+		return p.PostInterfaces.GetPaginatedPosts(ctx, query)
+	}
+
+	key := feedKey(p.cache.feedGeneration(ctx), query)
+	var posts []PostResponse
+	if p.cache.get(ctx, key, &posts) {
+		return posts, nil
+	}
+
+	posts, err := p.PostInterfaces.GetPaginatedPosts(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.set(ctx, key, posts, p.cache.ttl.Feed)
+	return posts, nil
+}
+
+func (p *cachedPostRepository) GetPostDetailWithComments(ctx context.Context, postID uint) (*PostResponse, []*CommentResponse, error) {
+	if p.bypass {
+		return p.PostInterfaces.GetPostDetailWithComments(ctx, postID)
+	}
+
+	key := postDetailKey(postID)
+	var detail cachedPostDetail
+	if p.cache.get(ctx, key, &detail) && detail.Post != nil {
+		return detail.Post, detail.Comments, nil
+	}
+
+	post, comments, err := p.PostInterfaces.GetPostDetailWithComments(ctx, postID)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.cache.set(ctx, key, cachedPostDetail{Post: post, Comments: comments}, p.cache.ttl.Post)
+	return post, comments, nil
+}
+
+func (p *cachedPostRepository) CreatePost(ctx context.Context, req *CreatePostRequest) (PostResponse, error) {
+	post, err := p.PostInterfaces.CreatePost(ctx, req)
+	if err != nil {
+		return PostResponse{}, err
+	}
+	p.invalidate(ctx, feedGenerationKey)
+	return post, nil
+}
+
+func (p *cachedPostRepository) DeletePost(ctx context.Context, postID uint) error {
+	if err := p.PostInterfaces.DeletePost(ctx, postID); err != nil {
+		return err
+	}
+	p.invalidate(ctx, append(postKeys(postID), feedGenerationKey)...)
+	return nil
+}
+
+type cachedCommentRepository struct {
+	CommentInterfaces
+	cache      *modelCache
+	bypass     bool
+	invalidate invalidateFunc
+}
+
+func (c *cachedCommentRepository) GetCommentCount(ctx context.Context, postID int) (int, error) {
+	if c.bypass {
+		return c.CommentInterfaces.GetCommentCount(ctx, postID)
+	}
+
+	key := commentCountKey(uint(postID))
+	var count int
+	if c.cache.get(ctx, key, &count) {
+		return count, nil
+	}
+
+	count, err := c.CommentInterfaces.GetCommentCount(ctx, postID)
+	if err != nil {
+		return 0, err
+	}
+	c.cache.set(ctx, key, count, c.cache.ttl.Count)
+	return count, nil
+}
+
+func (c *cachedCommentRepository) CreateComment(ctx context.Context, req *CreateCommentRequest) (CommentResponse, error) {
+	comment, err := c.CommentInterfaces.CreateComment(ctx, req)
+	if err != nil {
+		return CommentResponse{}, err
+	}
+	c.invalidate(ctx, postKeys(req.PostID)...)
+	return comment, nil
+}
+
+func (c *cachedCommentRepository) UpdateComment(ctx context.Context, req *UpdateCommentRequest) (*Comment, error) {
+	comment, err := c.CommentInterfaces.UpdateComment(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(ctx, postKeys(comment.PostID)...)
+	return comment, nil
+}
+
+func (c *cachedCommentRepository) DeleteComment(ctx context.Context, commentID uint, userID string) (*Comment, error) {
+	comment, err := c.CommentInterfaces.DeleteComment(ctx, commentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	c.invalidate(ctx, postKeys(comment.PostID)...)
+	return comment, nil
+}
+
+type cachedLikeRepository struct {
+	LikeInterfaces
+	cache      *modelCache
+	bypass     bool
+	invalidate invalidateFunc
+}
+
+func (l *cachedLikeRepository) CountLikes(ctx context.Context, postID int) (int, error) {
+	if l.bypass {
+		return l.LikeInterfaces.CountLikes(ctx, postID)
+	}
+
+	key := likeCountKey(uint(postID))
+	var count int
+	if l.cache.get(ctx, key, &count) {
+		return count, nil
+	}
+
+	count, err := l.LikeInterfaces.CountLikes(ctx, postID)
+	if err != nil {
+		return 0, err
+	}
+	l.cache.set(ctx, key, count, l.cache.ttl.Count)
+	return count, nil
+}
+
+func (l *cachedLikeRepository) AddLike(ctx context.Context, userID string, postID int) (bool, error) {
+	added, err := l.LikeInterfaces.AddLike(ctx, userID, postID)
+	if err != nil || !added {
+		return added, err
+	}
+	l.invalidate(ctx, postKeys(uint(postID))...)
+	return true, nil
+}
+
+func (l *cachedLikeRepository) RemoveLike(ctx context.Context, userID string, postID int) (bool, error) {
+	removed, err := l.LikeInterfaces.RemoveLike(ctx, userID, postID)
+	if err != nil || !removed {
+		return removed, err
+	}
+	l.invalidate(ctx, postKeys(uint(postID))...)
+	return true, nil
+}
+
+type cachedModerationRepository struct {
+	ModerationInterfaces
+	invalidate invalidateFunc
+}
+
+func (m *cachedModerationRepository) ModeratePost(ctx context.Context, postID uint, status string) (*Post, error) {
+	post, err := m.ModerationInterfaces.ModeratePost(ctx, postID, status)
+	if err != nil {
+		return nil, err
+	}
+	m.invalidate(ctx, append(postKeys(post.ID), feedGenerationKey)...)
+	return post, nil
+}
+
+func (m *cachedModerationRepository) ModerateComment(ctx context.Context, commentID uint, status string) (*Comment, error) {
+	comment, err := m.ModerationInterfaces.ModerateComment(ctx, commentID, status)
+	if err != nil {
+		return nil, err
+	}
+	m.invalidate(ctx, postKeys(comment.PostID)...)
+	return comment, nil
+}
@@ -0,0 +1,125 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Ahmad-mufied/iducate-community-service/cache"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"testing"
+	"time"
+)
+
+var latestFeed = data.PaginatedFeedQuery{Limit: 10, SortType: "latest", Sort: "desc"}
+
+// setupCached returns cached memory models with alice and bob, and the
+// uncached models underneath for writes the cache doesn't see
+func setupCached(t *testing.T) (cached *data.Models, direct *data.Models) {
+	direct, addUser := setupMemory(t)
+	addUser(data.User{ID: "alice", Username: "Alice"})
+	addUser(data.User{ID: "bob", Username: "Bob"})
+	return data.NewCached(direct, cache.NewLRU(100), data.CacheTTL{Feed: time.Hour, Post: time.Hour, Count: time.Hour}), direct
+}
+
+func likeCount(t *testing.T, models *data.Models, postID uint) int {
+	t.Helper()
+	count, err := models.Like.CountLikes(context.Background(), int(postID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestCachedFeed(t *testing.T) {
+	ctx := context.Background()
+	cached, direct := setupCached(t)
+	createPost(t, cached, "alice", "first", data.StatusPublished)
+
+	expectStrings(t, feedTitles(t, cached, latestFeed), "first")
+
+	// Pages are served from the cache
+	createPost(t, direct, "alice", "hidden", data.StatusPublished)
+	expectStrings(t, feedTitles(t, cached, latestFeed), "first")
+
+	// New, deleted and moderated posts start a new feed generation
+	second := createPost(t, cached, "bob", "second", data.StatusPublished)
+	expectStrings(t, feedTitles(t, cached, latestFeed), "second", "hidden", "first")
+	if err := cached.Post.DeletePost(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	expectStrings(t, feedTitles(t, cached, latestFeed), "hidden", "first")
+	queued := createPost(t, direct, "bob", "queued", data.StatusPending)
+	if _, err := cached.Moderation.ModeratePost(ctx, queued, data.StatusPublished); err != nil {
+		t.Fatal(err)
+	}
+	expectStrings(t, feedTitles(t, cached, latestFeed), "queued", "hidden", "first")
+}
+
+func TestCachedLikesKeepFeedPages(t *testing.T) {
+	ctx := context.Background()
+	cached, direct := setupCached(t)
+	postID := createPost(t, cached, "alice", "first", data.StatusPublished)
+
+	feedTitles(t, cached, latestFeed)
+	if _, _, err := cached.Post.GetPostDetailWithComments(ctx, postID); err != nil {
+		t.Fatal(err)
+	}
+	if likeCount(t, cached, postID) != 0 {
+		t.Fatal("post starts with likes")
+	}
+
+	// Posts created behind the cache's back show whether the feed was dropped
+	createPost(t, direct, "bob", "hidden", data.StatusPublished)
+
+	if _, err := cached.Like.AddLike(ctx, "bob", int(postID)); err != nil {
+		t.Fatal(err)
+	}
+	createComment(t, cached, postID, "bob", "nice", data.StatusPublished)
+
+	// The cached feed page is kept
+	expectStrings(t, feedTitles(t, cached, latestFeed), "first")
+
+	// The post's own entries are fresh
+	if likeCount(t, cached, postID) != 1 {
+		t.Fatal("like count wasn't invalidated")
+	}
+	post, comments, err := cached.Post.GetPostDetailWithComments(ctx, postID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.LikeCount != 1 || len(comments) != 1 {
+		t.Fatalf("got %d likes and %d comments, want the detail invalidated", post.LikeCount, len(comments))
+	}
+}
+
+func TestCachedInvalidatesAfterCommit(t *testing.T) {
+	ctx := context.Background()
+	cached, _ := setupCached(t)
+	postID := createPost(t, cached, "alice", "first", data.StatusPublished)
+	likeCount(t, cached, postID)
+
+	// Rolled back writes keep the cache
+	rollback := errors.New("rollback")
+	err := cached.WithTx(ctx, func(tx *data.Models) error {
+		if _, err := tx.Like.AddLike(ctx, "bob", int(postID)); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("got %v, want the rollback error", err)
+	}
+	if likeCount(t, cached, postID) != 0 {
+		t.Fatal("rolled back like counted")
+	}
+
+	err = cached.WithTx(ctx, func(tx *data.Models) error {
+		_, err := tx.Like.AddLike(ctx, "bob", int(postID))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if likeCount(t, cached, postID) != 1 {
+		t.Fatal("committed like wasn't invalidated")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"github.com/xeonx/timeago"
 	"time"
 )
@@ -13,66 +14,125 @@ type Comment struct {
 	ID        uint      `json:"id" db:"id"`                 // Primary key
 	PostID    uint      `json:"post_id" db:"post_id"`       // Foreign key referencing Post
 	UserID    string    `json:"user_id" db:"user_id"`       // Foreign key referencing User
+	ParentID  *uint     `json:"parent_id" db:"parent_id"`   // Comment this one replies to
 	Content   string    `json:"content" db:"content"`       // Comment content
+	Status    string    `json:"status" db:"status"`         // Moderation status
 	CreatedAt time.Time `json:"created_at" db:"created_at"` // Timestamp for record creation
 }
 
+type CreateCommentRequest struct {
+	PostID   uint   `json:"-"`
+	UserID   string `json:"-"`
+	ParentID *uint  `json:"parent_id"` // Set when replying to a comment of the same post
+	Content  string `json:"content" validate:"required,clean"`
+	Status   string `json:"-"` // Set by the handler, defaults to published
+}
+
+type UpdateCommentRequest struct {
+	CommentID uint   `json:"-"`
+	UserID    string `json:"-"`
+	Content   string `json:"content" validate:"required,clean"`
+	Status    string `json:"-"` // Set by the handler, empty keeps the current status
+}
+
 type CommentResponse struct {
-	ID        uint   `json:"id" db:"id"`
-	Username  string `json:"username" db:"username"`
-	Content   string `json:"content" db:"content"`
-	CreatedAt string `json:"created_at" db:"created_at"`
+	ID        uint      `json:"id" db:"id"`
+	ParentID  *uint     `json:"parent_id" db:"parent_id"`
+	Username  string    `json:"username" db:"username"`
+	Content   string    `json:"content" db:"content"`
+	CreatedAt string    `json:"created_at" db:"created_at"`
+	Mentions  []Mention `json:"mentions" db:"-"`
+}
+
+// CommentRepository stores comments in PostgreSQL
+type CommentRepository struct {
+	db sqlx.ExtContext
 }
 
-func (c *Comment) GetComments(ctx context.Context, postID uint) ([]CommentResponse, error) {
+func (c *CommentRepository) GetComments(ctx context.Context, postID uint) ([]CommentResponse, error) {
+	defer observe(ctx, "comment", "GetComments")()
+
 	query := `
-		SELECT comments.id, users.username, comments.content, comments.created_at
+		SELECT comments.id, comments.parent_id, users.username, comments.content, comments.created_at
 		FROM comments
 		JOIN users ON comments.user_id = users.id
-		WHERE comments.post_id = $1
-		ORDER BY comments.created_at DESC;
+		WHERE comments.post_id = $1 AND comments.status = 'published'
+		ORDER BY comments.created_at DESC, comments.id DESC;
 	`
 
 	var comments []CommentResponse
-	err := db.SelectContext(ctx, &comments, query, postID)
+	err := sqlx.SelectContext(ctx, c.db, &comments, query, postID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch comments: %w", err)
 	}
 
+	commentIDs := make([]uint, len(comments))
+	for i := range comments {
+		commentIDs[i] = comments[i].ID
+	}
+	mentions, err := commentMentions(ctx, c.db, commentIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		comments[i].Mentions = orNoMentions(mentions[comments[i].ID])
+	}
+
 	return comments, nil
 }
 
-func (c *Comment) CreateComment(ctx context.Context, postID uint, userID string, content string) (CommentResponse, error) {
-	// Check if the post exists
-	checkPostQuery := `SELECT id FROM posts WHERE id = $1;`
+func (c *CommentRepository) CreateComment(ctx context.Context, req *CreateCommentRequest) (CommentResponse, error) {
+	defer observe(ctx, "comment", "CreateComment")()
+
+	// Check if the post exists, locking it against deletion until the insert
+	checkPostQuery := `SELECT id FROM posts WHERE id = $1 AND status = 'published' FOR SHARE;`
 	var existingPostID uint
-	err := db.GetContext(ctx, &existingPostID, checkPostQuery, postID)
+	err := sqlx.GetContext(ctx, c.db, &existingPostID, checkPostQuery, req.PostID)
 	if err != nil {
-		if errors.Is(sql.ErrNoRows, err) {
-			return CommentResponse{}, fmt.Errorf("post not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return CommentResponse{}, fmt.Errorf("post %w", ErrNotFound)
 		}
 		return CommentResponse{}, fmt.Errorf("failed to validate post existence: %w", err)
 	}
 
-	// Check if the user exists
-	checkUserQuery := `SELECT id FROM users WHERE id = $1;`
-	var existingUserID string
-	err = db.GetContext(ctx, &existingUserID, checkUserQuery, userID)
+	// Check if the user exists, the response names them
+	checkUserQuery := `SELECT username FROM users WHERE id = $1;`
+	var username string
+	err = sqlx.GetContext(ctx, c.db, &username, checkUserQuery, req.UserID)
 	if err != nil {
-		if errors.Is(sql.ErrNoRows, err) {
-			return CommentResponse{}, fmt.Errorf("user not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return CommentResponse{}, fmt.Errorf("user %w", ErrNotFound)
 		}
 		return CommentResponse{}, fmt.Errorf("failed to validate user existence: %w", err)
 	}
 
+	// Replies must answer a visible comment of the same post
+	if req.ParentID != nil {
+		checkParentQuery := `SELECT post_id FROM comments WHERE id = $1 AND status = 'published';`
+		var parentPostID uint
+		err = sqlx.GetContext(ctx, c.db, &parentPostID, checkParentQuery, *req.ParentID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return CommentResponse{}, fmt.Errorf("failed to validate parent comment: %w", err)
+		}
+		if errors.Is(err, sql.ErrNoRows) || parentPostID != req.PostID {
+			return CommentResponse{}, fmt.Errorf("parent comment %w", ErrNotFound)
+		}
+	}
+
 	// Insert the comment
 	insertQuery := `
-        INSERT INTO comments (post_id, user_id, content, created_at)
-        VALUES ($1, $2, $3, NOW())
-        RETURNING id, content, created_at;
+        INSERT INTO comments (post_id, user_id, parent_id, content, status, created_at)
+        VALUES ($1, $2, $3, $4, $5, NOW())
+        RETURNING id, parent_id, content, status, created_at;
     `
+
+	status := req.Status
+	if status == "" {
+		status = StatusPublished
+	}
+
 	var comment Comment
-	err = db.GetContext(ctx, &comment, insertQuery, postID, userID, content)
+	err = sqlx.GetContext(ctx, c.db, &comment, insertQuery, req.PostID, req.UserID, req.ParentID, req.Content, status)
 	if err != nil {
 		return CommentResponse{}, fmt.Errorf("failed to create comment: %w", err)
 	}
@@ -81,54 +141,118 @@ func (c *Comment) CreateComment(ctx context.Context, postID uint, userID string,
 	timestring := timeago.English.Format(comment.CreatedAt)
 	commentResponse := CommentResponse{
 		ID:        comment.ID,
-		Username:  userID,
+		ParentID:  comment.ParentID,
+		Username:  username,
 		Content:   comment.Content,
 		CreatedAt: timestring,
+		Mentions:  []Mention{},
 	}
 
 	return commentResponse, nil
 }
 
-func (c *Comment) DeleteComment(ctx context.Context, commentID uint, userID string) error {
+func (c *CommentRepository) DeleteComment(ctx context.Context, commentID uint, userID string) (*Comment, error) {
+	defer observe(ctx, "comment", "DeleteComment")()
+
 	// Verify that the comment belongs to the user
 	checkQuery := `SELECT user_id FROM comments WHERE id = $1;`
 	var commentOwnerID string
-	err := db.GetContext(ctx, &commentOwnerID, checkQuery, commentID)
+	err := sqlx.GetContext(ctx, c.db, &commentOwnerID, checkQuery, commentID)
 	if err != nil {
-		if errors.Is(sql.ErrNoRows, err) {
-			return fmt.Errorf("comment not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("comment %w", ErrNotFound)
 		}
-		return fmt.Errorf("failed to verify comment ownership: %w", err)
+		return nil, fmt.Errorf("failed to verify comment ownership: %w", err)
 	}
 
 	if commentOwnerID != userID {
-		return fmt.Errorf("unauthorized: you are not the owner of this comment")
+		return nil, fmt.Errorf("%w: you are not the owner of this comment", ErrForbidden)
 	}
 
-	// Delete the comment
-	deleteQuery := `DELETE FROM comments WHERE id = $1;`
-	result, err := db.ExecContext(ctx, deleteQuery, commentID)
+	// Delete the comment and return it so callers know which post it belonged to
+	deleteQuery := `
+        DELETE FROM comments WHERE id = $1
+        RETURNING id, post_id, user_id, parent_id, content, status, created_at;
+    `
+	comment := new(Comment)
+	err = sqlx.GetContext(ctx, c.db, comment, deleteQuery, commentID)
 	if err != nil {
-		return fmt.Errorf("failed to delete comment: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("comment %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to delete comment: %w", err)
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("comment not found")
+	return comment, nil
+}
+
+func (c *CommentRepository) UpdateComment(ctx context.Context, req *UpdateCommentRequest) (*Comment, error) {
+	defer observe(ctx, "comment", "UpdateComment")()
+
+	// Verify that the comment belongs to the user, locking it until the update
+	checkQuery := `SELECT user_id FROM comments WHERE id = $1 FOR UPDATE;`
+	var commentOwnerID string
+	err := sqlx.GetContext(ctx, c.db, &commentOwnerID, checkQuery, req.CommentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("comment %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to verify comment ownership: %w", err)
+	}
+
+	if commentOwnerID != req.UserID {
+		return nil, fmt.Errorf("%w: you are not the owner of this comment", ErrForbidden)
+	}
+
+	updateQuery := `
+        UPDATE comments
+        SET content = $2, status = COALESCE(NULLIF($3, ''), status), updated_at = NOW()
+        WHERE id = $1
+        RETURNING id, post_id, user_id, parent_id, content, status, created_at;
+    `
+	comment := new(Comment)
+	err = sqlx.GetContext(ctx, c.db, comment, updateQuery, req.CommentID, req.Content, req.Status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("comment %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to update comment: %w", err)
 	}
 
-	return nil
+	return comment, nil
 }
 
-func (c *Comment) GetCommentCount(ctx context.Context, postID int) (int, error) {
+func (c *CommentRepository) GetCommentByID(ctx context.Context, commentID uint) (*Comment, error) {
+	defer observe(ctx, "comment", "GetCommentByID")()
+
+	query := `
+        SELECT id, post_id, user_id, parent_id, content, status, created_at
+        FROM comments
+        WHERE id = $1;
+    `
+
+	comment := new(Comment)
+	err := sqlx.GetContext(ctx, c.db, comment, query, commentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("comment %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to fetch comment: %w", err)
+	}
+	return comment, nil
+}
+
+func (c *CommentRepository) GetCommentCount(ctx context.Context, postID int) (int, error) {
+	defer observe(ctx, "comment", "GetCommentCount")()
+
 	query := `
         SELECT COUNT(*)
         FROM comments
-        WHERE post_id = $1;
+        WHERE post_id = $1 AND status = 'published';
     `
 
 	var count int
-	err := db.GetContext(ctx, &count, query, postID)
+	err := sqlx.GetContext(ctx, c.db, &count, query, postID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to fetch comment count: %w", err)
 	}
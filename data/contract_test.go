@@ -0,0 +1,550 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/migrations"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/jmoiron/sqlx"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDatabaseURLEnv names the PostgreSQL DSN the contract suite also runs
+// against. The database is migrated and emptied by the tests, don't point it
+// at one you care about.
+const testDatabaseURLEnv = "TEST_DATABASE_URL"
+
+// backend creates empty models for a test along with a way to add users,
+// which the repositories only read
+type backend struct {
+	name  string
+	setup func(t *testing.T) (models *data.Models, addUser func(user data.User))
+}
+
+func backends(t *testing.T) []backend {
+	all := []backend{{name: "memory", setup: setupMemory}}
+	if os.Getenv(testDatabaseURLEnv) != "" {
+		all = append(all, backend{name: "postgres", setup: setupPostgres})
+	} else {
+		t.Logf("%s is not set, skipping PostgreSQL", testDatabaseURLEnv)
+	}
+	return all
+}
+
+func setupMemory(t *testing.T) (*data.Models, func(user data.User)) {
+	store := data.NewMemoryStore()
+	return data.NewMemory(store), store.AddUser
+}
+
+var (
+	postgresOnce sync.Once
+	postgresDB   *sqlx.DB
+	postgresErr  error
+)
+
+func setupPostgres(t *testing.T) (*data.Models, func(user data.User)) {
+	ctx := context.Background()
+
+	postgresOnce.Do(func() {
+		postgresDB, postgresErr = sqlx.Connect("pgx", os.Getenv(testDatabaseURLEnv))
+		if postgresErr != nil {
+			return
+		}
+		var migrator *migrations.Migrator
+		migrator, postgresErr = migrations.New(postgresDB)
+		if postgresErr != nil {
+			return
+		}
+		_, postgresErr = migrator.Up(ctx)
+	})
+	if postgresErr != nil {
+		t.Fatalf("failed to prepare %s: %v", testDatabaseURLEnv, postgresErr)
+	}
+
+	// Every table references users or posts, or is emptied explicitly
+	_, err := postgresDB.ExecContext(ctx, `TRUNCATE users, posts, webhook_endpoints, outbox_events RESTART IDENTITY CASCADE;`)
+	if err != nil {
+		t.Fatalf("failed to empty the database: %v", err)
+	}
+
+	addUser := func(user data.User) {
+		if user.CreatedAt.IsZero() {
+			user.CreatedAt = time.Now()
+		}
+		_, err := postgresDB.ExecContext(ctx,
+			`INSERT INTO users (id, email, username, created_at) VALUES ($1, $2, $3, $4);`,
+			user.ID, user.ID+"@example.com", user.Username, user.CreatedAt)
+		if err != nil {
+			t.Fatalf("failed to add user %s: %v", user.ID, err)
+		}
+	}
+	return data.New(postgresDB), addUser
+}
+
+// runContract runs test against every backend with two users, alice and bob
+func runContract(t *testing.T, test func(t *testing.T, models *data.Models)) {
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			models, addUser := b.setup(t)
+			addUser(data.User{ID: "alice", Username: "Alice"})
+			addUser(data.User{ID: "bob", Username: "Bob"})
+			test(t, models)
+		})
+	}
+}
+
+func createPost(t *testing.T, models *data.Models, userID string, title string, status string) uint {
+	t.Helper()
+	post, err := models.Post.CreatePost(context.Background(), &data.CreatePostRequest{
+		UserID:  userID,
+		Title:   title,
+		Content: title + " content",
+		Status:  status,
+	})
+	if err != nil {
+		t.Fatalf("CreatePost(%q): %v", title, err)
+	}
+	return post.ID
+}
+
+func createComment(t *testing.T, models *data.Models, postID uint, userID string, content string, status string) uint {
+	t.Helper()
+	comment, err := models.Comment.CreateComment(context.Background(), &data.CreateCommentRequest{
+		PostID:  postID,
+		UserID:  userID,
+		Content: content,
+		Status:  status,
+	})
+	if err != nil {
+		t.Fatalf("CreateComment(%q): %v", content, err)
+	}
+	return comment.ID
+}
+
+func like(t *testing.T, models *data.Models, userID string, postID uint) {
+	t.Helper()
+	if _, err := models.Like.AddLike(context.Background(), userID, int(postID)); err != nil {
+		t.Fatalf("AddLike(%s, %d): %v", userID, postID, err)
+	}
+}
+
+func expectErr(t *testing.T, err error, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("got error %v, want %v", err, target)
+	}
+}
+
+func feedTitles(t *testing.T, models *data.Models, query data.PaginatedFeedQuery) []string {
+	t.Helper()
+	posts, err := models.Post.GetPaginatedPosts(context.Background(), query)
+	if err != nil {
+		t.Fatalf("GetPaginatedPosts(%+v): %v", query, err)
+	}
+	titles := []string{}
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+	}
+	return titles
+}
+
+func expectStrings(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestContractFeedOrderAndPagination(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		createPost(t, models, "alice", "first", "")
+		second := createPost(t, models, "bob", "second", "")
+		createPost(t, models, "alice", "held", data.StatusPending)
+		third := createPost(t, models, "alice", "third", "")
+
+		like(t, models, "alice", second)
+		like(t, models, "bob", second)
+		like(t, models, "bob", third)
+
+		// Pending posts are never listed
+		latest := data.PaginatedFeedQuery{Limit: 10, SortType: "latest", Sort: "desc"}
+		expectStrings(t, feedTitles(t, models, latest), "third", "second", "first")
+		latest.Sort = "asc"
+		expectStrings(t, feedTitles(t, models, latest), "first", "second", "third")
+
+		// Ties on the like count are broken by ID
+		trend := data.PaginatedFeedQuery{Limit: 10, SortType: "trend", Sort: "desc"}
+		expectStrings(t, feedTitles(t, models, trend), "second", "third", "first")
+		trend.Sort = "asc"
+		expectStrings(t, feedTitles(t, models, trend), "first", "third", "second")
+
+		page := data.PaginatedFeedQuery{Limit: 2, Offset: 0, SortType: "latest", Sort: "desc"}
+		expectStrings(t, feedTitles(t, models, page), "third", "second")
+		page.Offset = 2
+		expectStrings(t, feedTitles(t, models, page), "first")
+		page.Offset = 3
+		expectStrings(t, feedTitles(t, models, page))
+	})
+}
+
+func TestContractFeedCounts(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+		postID := createPost(t, models, "alice", "counted", "")
+		like(t, models, "alice", postID)
+		like(t, models, "bob", postID)
+		createComment(t, models, postID, "bob", "published", "")
+		createComment(t, models, postID, "bob", "held", data.StatusPending)
+
+		posts, err := models.Post.GetPaginatedPosts(ctx, data.PaginatedFeedQuery{Limit: 10, SortType: "latest", Sort: "desc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != 1 {
+			t.Fatalf("got %d posts, want 1", len(posts))
+		}
+		post := posts[0]
+		if post.Author != "Alice" || post.LikeCount != 2 || post.CommentCount != 1 {
+			t.Fatalf("got author %q with %d likes and %d comments, want Alice with 2 and 1", post.Author, post.LikeCount, post.CommentCount)
+		}
+
+		err = models.Post.IncrementPostViewsBy(ctx, map[uint]int{postID: 3, postID + 100: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		detail, _, err := models.Post.GetPostDetailWithComments(ctx, postID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if detail.Views != 3 {
+			t.Fatalf("got %d views, want 3", detail.Views)
+		}
+	})
+}
+
+func TestContractPostDetail(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+		postID := createPost(t, models, "alice", "detail", "")
+		createComment(t, models, postID, "bob", "one", "")
+		createComment(t, models, postID, "alice", "two", "")
+		createComment(t, models, postID, "bob", "hidden", data.StatusPending)
+
+		// Oldest comment first
+		_, comments, err := models.Post.GetPostDetailWithComments(ctx, postID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var contents []string
+		for _, comment := range comments {
+			contents = append(contents, comment.Content)
+		}
+		expectStrings(t, contents, "one", "two")
+
+		heldID := createPost(t, models, "alice", "held", data.StatusPending)
+		_, _, err = models.Post.GetPostDetailWithComments(ctx, heldID)
+		expectErr(t, err, data.ErrNotFound)
+		_, _, err = models.Post.GetPostDetailWithComments(ctx, postID+100)
+		expectErr(t, err, data.ErrNotFound)
+
+		// Held posts exist for their author
+		post, err := models.Post.GetPostByID(ctx, heldID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Status != data.StatusPending {
+			t.Fatalf("got status %q, want pending", post.Status)
+		}
+		_, err = models.Post.GetPostByID(ctx, postID+100)
+		expectErr(t, err, data.ErrNotFound)
+	})
+}
+
+func TestContractCreatePostUnknownUser(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		_, err := models.Post.CreatePost(context.Background(), &data.CreatePostRequest{UserID: "carol", Title: "t", Content: "c"})
+		expectErr(t, err, data.ErrNotFound)
+	})
+}
+
+func TestContractUsernames(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+
+		// Responses name the author, not their ID
+		post, err := models.Post.CreatePost(ctx, &data.CreatePostRequest{UserID: "alice", Title: "t", Content: "c"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Author != "Alice" {
+			t.Fatalf("got author %q, want Alice", post.Author)
+		}
+		comment, err := models.Comment.CreateComment(ctx, &data.CreateCommentRequest{PostID: post.ID, UserID: "bob", Content: "c"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if comment.Username != "Bob" {
+			t.Fatalf("got username %q, want Bob", comment.Username)
+		}
+
+		user, err := models.User.GetUser(ctx, "alice")
+		if err != nil || user.Username != "Alice" {
+			t.Fatalf("got %+v and error %v, want Alice", user, err)
+		}
+		_, err = models.User.GetUser(ctx, "carol")
+		expectErr(t, err, data.ErrNotFound)
+	})
+}
+
+func TestContractDeletePost(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+		postID := createPost(t, models, "alice", "deleted", "")
+		like(t, models, "bob", postID)
+		commentID := createComment(t, models, postID, "bob", "gone too", "")
+
+		if err := models.Post.DeletePost(ctx, postID); err != nil {
+			t.Fatal(err)
+		}
+		expectErr(t, models.Post.DeletePost(ctx, postID), data.ErrNotFound)
+
+		exists, err := models.Post.CheckPostByID(ctx, postID)
+		if err != nil || exists {
+			t.Fatalf("got exists %v and error %v, want false and none", exists, err)
+		}
+		_, err = models.Comment.GetCommentByID(ctx, commentID)
+		expectErr(t, err, data.ErrNotFound)
+		count, err := models.Like.CountLikes(ctx, int(postID))
+		if err != nil || count != 0 {
+			t.Fatalf("got %d likes and error %v, want 0 and none", count, err)
+		}
+	})
+}
+
+func TestContractComments(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+		postID := createPost(t, models, "alice", "commented", "")
+		firstID := createComment(t, models, postID, "bob", "first", "")
+		createComment(t, models, postID, "alice", "second", "")
+		createComment(t, models, postID, "bob", "held", data.StatusPending)
+
+		// Newest first, published only
+		comments, err := models.Comment.GetComments(ctx, postID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var contents []string
+		for _, comment := range comments {
+			contents = append(contents, comment.Content)
+		}
+		expectStrings(t, contents, "second", "first")
+
+		count, err := models.Comment.GetCommentCount(ctx, int(postID))
+		if err != nil || count != 2 {
+			t.Fatalf("got %d comments and error %v, want 2 and none", count, err)
+		}
+
+		reply, err := models.Comment.CreateComment(ctx, &data.CreateCommentRequest{PostID: postID, UserID: "alice", ParentID: &firstID, Content: "reply"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.ParentID == nil || *reply.ParentID != firstID {
+			t.Fatalf("got parent %v, want %d", reply.ParentID, firstID)
+		}
+	})
+}
+
+func TestContractCreateCommentNotFound(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+		postID := createPost(t, models, "alice", "open", "")
+		otherID := createPost(t, models, "alice", "other", "")
+		heldID := createPost(t, models, "alice", "held", data.StatusPending)
+		otherCommentID := createComment(t, models, otherID, "bob", "elsewhere", "")
+
+		for name, req := range map[string]*data.CreateCommentRequest{
+			"missing post":           {PostID: postID + 100, UserID: "bob", Content: "c"},
+			"pending post":           {PostID: heldID, UserID: "bob", Content: "c"},
+			"unknown user":           {PostID: postID, UserID: "carol", Content: "c"},
+			"parent of another post": {PostID: postID, UserID: "bob", ParentID: &otherCommentID, Content: "c"},
+		} {
+			_, err := models.Comment.CreateComment(ctx, req)
+			if !errors.Is(err, data.ErrNotFound) {
+				t.Errorf("%s: got error %v, want ErrNotFound", name, err)
+			}
+		}
+	})
+}
+
+func TestContractCommentOwnership(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+		postID := createPost(t, models, "alice", "owned", "")
+		commentID := createComment(t, models, postID, "bob", "mine", "")
+
+		_, err := models.Comment.UpdateComment(ctx, &data.UpdateCommentRequest{CommentID: commentID, UserID: "alice", Content: "theirs"})
+		expectErr(t, err, data.ErrForbidden)
+		_, err = models.Comment.DeleteComment(ctx, commentID, "alice")
+		expectErr(t, err, data.ErrForbidden)
+
+		_, err = models.Comment.UpdateComment(ctx, &data.UpdateCommentRequest{CommentID: commentID + 100, UserID: "bob", Content: "missing"})
+		expectErr(t, err, data.ErrNotFound)
+		_, err = models.Comment.DeleteComment(ctx, commentID+100, "bob")
+		expectErr(t, err, data.ErrNotFound)
+
+		updated, err := models.Comment.UpdateComment(ctx, &data.UpdateCommentRequest{CommentID: commentID, UserID: "bob", Content: "edited"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Content != "edited" || updated.PostID != postID || updated.Status != data.StatusPublished {
+			t.Fatalf("got %+v, want the edited comment of post %d", updated, postID)
+		}
+
+		deleted, err := models.Comment.DeleteComment(ctx, commentID, "bob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted.PostID != postID {
+			t.Fatalf("got post %d, want %d", deleted.PostID, postID)
+		}
+		count, err := models.Comment.GetCommentCount(ctx, int(postID))
+		if err != nil || count != 0 {
+			t.Fatalf("got %d comments and error %v, want 0 and none", count, err)
+		}
+	})
+}
+
+func TestContractLikes(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+		postID := int(createPost(t, models, "alice", "liked", ""))
+
+		for i, want := range []bool{true, false} {
+			added, err := models.Like.AddLike(ctx, "bob", postID)
+			if err != nil || added != want {
+				t.Fatalf("AddLike #%d: got %v and error %v, want %v", i+1, added, err, want)
+			}
+		}
+		count, err := models.Like.CountLikes(ctx, postID)
+		if err != nil || count != 1 {
+			t.Fatalf("got %d likes and error %v, want 1 and none", count, err)
+		}
+
+		for i, want := range []bool{true, false} {
+			removed, err := models.Like.RemoveLike(ctx, "bob", postID)
+			if err != nil || removed != want {
+				t.Fatalf("RemoveLike #%d: got %v and error %v, want %v", i+1, removed, err, want)
+			}
+		}
+		count, err = models.Like.CountLikes(ctx, postID)
+		if err != nil || count != 0 {
+			t.Fatalf("got %d likes and error %v, want 0 and none", count, err)
+		}
+
+		_, err = models.Like.AddLike(ctx, "bob", postID+100)
+		expectErr(t, err, data.ErrNotFound)
+		_, err = models.Like.AddLike(ctx, "carol", postID)
+		expectErr(t, err, data.ErrNotFound)
+	})
+}
+
+func TestContractModeration(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+		postID := createPost(t, models, "alice", "open", "")
+		heldPostID := createPost(t, models, "alice", "held", data.StatusPending)
+		heldCommentID := createComment(t, models, postID, "bob", "held comment", data.StatusPending)
+		createPost(t, models, "bob", "also held", data.StatusPending)
+
+		err := models.Spam.RecordSpamScore(ctx, data.ContentTypePost, heldPostID, "alice", 5, []string{"new account", "1 link(s)"}, "review")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Each with its latest spam score, if any. PostgreSQL keeps creation
+		// times in seconds, so posts and comments of the same second may come
+		// in either order.
+		pending, err := models.Moderation.GetPendingContent(ctx, data.PendingContentQuery{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 3 {
+			t.Fatalf("got %d pending items, want 3", len(pending))
+		}
+		for _, item := range pending {
+			switch {
+			case item.ContentType == data.ContentTypePost && item.ID == heldPostID:
+				if item.SpamScore == nil || *item.SpamScore != 5 || *item.SpamReasons != "new account, 1 link(s)" {
+					t.Fatalf("got %+v, want the post scored 5", item)
+				}
+			case item.ContentType == data.ContentTypeComment:
+				if item.ID != heldCommentID || item.PostID != postID || item.SpamScore != nil {
+					t.Fatalf("got %+v, want the unscored comment %d of post %d", item, heldCommentID, postID)
+				}
+			}
+		}
+
+		// Oldest first
+		page, err := models.Moderation.GetPendingContent(ctx, data.PendingContentQuery{ContentType: data.ContentTypePost, Limit: 1, Offset: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 1 || page[0].Title != "also held" {
+			t.Fatalf("got %+v, want the second pending post", page)
+		}
+
+		// Approving publishes and counts the content
+		if _, err := models.Moderation.ModeratePost(ctx, heldPostID, data.StatusPublished); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := models.Post.GetPostDetailWithComments(ctx, heldPostID); err != nil {
+			t.Fatalf("approved post: %v", err)
+		}
+		comment, err := models.Moderation.ModerateComment(ctx, heldCommentID, data.StatusPublished)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if comment.PostID != postID || comment.Status != data.StatusPublished {
+			t.Fatalf("got %+v, want the published comment of post %d", comment, postID)
+		}
+		detail, _, err := models.Post.GetPostDetailWithComments(ctx, postID)
+		if err != nil || detail.CommentCount != 1 {
+			t.Fatalf("got %+v and error %v, want one comment", detail, err)
+		}
+
+		// Decided content can't be moderated again
+		_, err = models.Moderation.ModeratePost(ctx, heldPostID, data.StatusRejected)
+		expectErr(t, err, data.ErrConflict)
+		_, err = models.Moderation.ModerateComment(ctx, heldCommentID, data.StatusRejected)
+		expectErr(t, err, data.ErrConflict)
+		_, err = models.Moderation.ModeratePost(ctx, heldPostID+100, data.StatusPublished)
+		expectErr(t, err, data.ErrNotFound)
+		_, err = models.Moderation.ModerateComment(ctx, heldCommentID+100, data.StatusPublished)
+		expectErr(t, err, data.ErrNotFound)
+	})
+}
+
+func TestContractWithTxRollsBack(t *testing.T) {
+	runContract(t, func(t *testing.T, models *data.Models) {
+		ctx := context.Background()
+		failed := errors.New("failed")
+
+		err := models.WithTx(ctx, func(tx *data.Models) error {
+			createPost(t, tx, "alice", "rolled back", "")
+			return failed
+		})
+		expectErr(t, err, failed)
+
+		expectStrings(t, feedTitles(t, models, data.PaginatedFeedQuery{Limit: 10, SortType: "latest", Sort: "desc"}))
+	})
+}
@@ -0,0 +1,266 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+
+	// DefaultDigestFrequency applies to users who never chose one
+	DefaultDigestFrequency = DigestWeekly
+)
+
+type DigestPreference struct {
+	Frequency string `json:"frequency" db:"frequency"`
+}
+
+type UpdateDigestPreferenceRequest struct {
+	Frequency string `json:"frequency" validate:"required,oneof=daily weekly off"`
+}
+
+// DigestRecipient is a user claimed for a digest
+type DigestRecipient struct {
+	UserID           string `db:"user_id"`
+	Email            string `db:"email"`
+	Username         string `db:"username"`
+	Frequency        string `db:"frequency"`
+	UnsubscribeToken string `db:"unsubscribe_token"`
+}
+
+// DigestQuery selects what goes into a digest
+type DigestQuery struct {
+	Since    time.Time
+	Limit    int  // Replies and top posts listed at most
+	Comments bool // Comments on the user's posts
+	Replies  bool // Replies to the user's comments
+}
+
+// Digest is the activity a user missed since their last digest
+type Digest struct {
+	Replies    []DigestReply
+	ReplyCount int // All new replies, Replies holds the latest ones
+	TopPosts   []DigestPost
+}
+
+// Empty reports whether there is nothing worth sending
+func (d *Digest) Empty() bool {
+	return d.ReplyCount == 0 && len(d.TopPosts) == 0
+}
+
+// DigestReply is a comment on the user's post or a reply to their comment
+type DigestReply struct {
+	CommentID uint      `db:"comment_id"`
+	PostID    uint      `db:"post_id"`
+	PostTitle string    `db:"post_title"`
+	Author    string    `db:"author"`
+	Content   string    `db:"content"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// DigestPost is a popular post by users of the same country or major
+type DigestPost struct {
+	PostID       uint   `db:"post_id"`
+	Title        string `db:"title"`
+	Author       string `db:"author"`
+	LikeCount    int    `db:"like_count"`
+	CommentCount int    `db:"comment_count"`
+}
+
+// DigestPeriod is the time a digest of the given frequency covers
+func DigestPeriod(frequency string) time.Duration {
+	if frequency == DigestDaily {
+		return 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// DigestRepository stores digest preferences and gathers digests from
+// PostgreSQL
+type DigestRepository struct {
+	db sqlx.ExtContext
+}
+
+func (d *DigestRepository) GetDigestPreference(ctx context.Context, userID string) (*DigestPreference, error) {
+	defer observe(ctx, "digest", "GetDigestPreference")()
+
+	query := `
+        SELECT frequency
+        FROM digest_preferences
+        WHERE user_id = $1;
+    `
+
+	preference := DigestPreference{Frequency: DefaultDigestFrequency}
+	err := sqlx.GetContext(ctx, d.db, &preference, query, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to fetch digest preference: %w", err)
+	}
+	return &preference, nil
+}
+
+func (d *DigestRepository) UpdateDigestPreference(ctx context.Context, userID string, frequency string) error {
+	defer observe(ctx, "digest", "UpdateDigestPreference")()
+
+	query := `
+        INSERT INTO digest_preferences (user_id, frequency, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (user_id) DO UPDATE SET frequency  = EXCLUDED.frequency,
+                                            updated_at = NOW();
+    `
+
+	_, err := d.db.ExecContext(ctx, query, userID, frequency)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update digest preference: %w", err)
+	}
+	return nil
+}
+
+func (d *DigestRepository) UnsubscribeDigest(ctx context.Context, token string) error {
+	defer observe(ctx, "digest", "UnsubscribeDigest")()
+
+	query := `
+        UPDATE digest_preferences
+        SET frequency  = 'off',
+            updated_at = NOW()
+        WHERE unsubscribe_token = $1;
+    `
+
+	result, err := d.db.ExecContext(ctx, query, token)
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe from digest: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("unsubscribe token %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (d *DigestRepository) ClaimDigestRecipients(ctx context.Context, limit int) ([]DigestRecipient, error) {
+	defer observe(ctx, "digest", "ClaimDigestRecipients")()
+
+	// Stamp last_sent_at before sending, so replicas don't mail the same
+	// user twice. The conflict clause checks again that the user is due, as
+	// another replica may have claimed them since the SELECT.
+	query := `
+        WITH due AS (
+            SELECT users.id, COALESCE(digest_preferences.frequency, $1) AS frequency
+            FROM users
+                     LEFT JOIN digest_preferences ON digest_preferences.user_id = users.id
+            WHERE COALESCE(digest_preferences.frequency, $1) <> 'off'
+              AND (digest_preferences.last_sent_at IS NULL OR
+                   digest_preferences.last_sent_at <= NOW() - CASE COALESCE(digest_preferences.frequency, $1)
+                                                                  WHEN 'daily' THEN INTERVAL '1 day'
+                                                                  ELSE INTERVAL '7 days' END)
+            ORDER BY digest_preferences.last_sent_at NULLS FIRST, users.id
+            LIMIT $2
+        ),
+        claimed AS (
+            INSERT INTO digest_preferences (user_id, frequency, last_sent_at, updated_at)
+            SELECT id, frequency, NOW(), NOW() FROM due
+            ON CONFLICT (user_id) DO UPDATE SET last_sent_at = NOW()
+            WHERE digest_preferences.frequency <> 'off'
+              AND (digest_preferences.last_sent_at IS NULL OR
+                   digest_preferences.last_sent_at <= NOW() - CASE digest_preferences.frequency
+                                                                  WHEN 'daily' THEN INTERVAL '1 day'
+                                                                  ELSE INTERVAL '7 days' END)
+            RETURNING user_id, frequency, unsubscribe_token
+        )
+        SELECT claimed.user_id, users.email, users.username, claimed.frequency, claimed.unsubscribe_token
+        FROM claimed
+                 JOIN users ON users.id = claimed.user_id
+        ORDER BY claimed.user_id;
+    `
+
+	var recipients []DigestRecipient
+	err := sqlx.SelectContext(ctx, d.db, &recipients, query, DefaultDigestFrequency, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim digest recipients: %w", err)
+	}
+	return recipients, nil
+}
+
+func (d *DigestRepository) GetDigest(ctx context.Context, userID string, query DigestQuery) (*Digest, error) {
+	defer observe(ctx, "digest", "GetDigest")()
+
+	// Comments by others on the user's posts and replies to their comments,
+	// as far as the query asks for them
+	repliesCondition := `
+        FROM comments
+                 JOIN posts ON posts.id = comments.post_id
+                 JOIN users ON users.id = comments.user_id
+                 LEFT JOIN comments parents ON parents.id = comments.parent_id
+        WHERE ((posts.user_id = $1 AND $3) OR (parents.user_id = $1 AND $4))
+          AND comments.user_id <> $1
+          AND comments.status = 'published'
+          AND posts.status = 'published'
+          AND comments.created_at >= $2
+    `
+
+	digest := Digest{Replies: []DigestReply{}, TopPosts: []DigestPost{}}
+
+	err := sqlx.GetContext(ctx, d.db, &digest.ReplyCount, `SELECT COUNT(*) `+repliesCondition,
+		userID, query.Since, query.Comments, query.Replies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count digest replies: %w", err)
+	}
+
+	if digest.ReplyCount > 0 {
+		repliesQuery := `
+            SELECT comments.id      AS comment_id,
+                   posts.id         AS post_id,
+                   posts.title      AS post_title,
+                   users.username   AS author,
+                   comments.content,
+                   comments.created_at
+            ` + repliesCondition + `
+            ORDER BY comments.created_at DESC, comments.id DESC
+            LIMIT $5;
+        `
+		err = sqlx.SelectContext(ctx, d.db, &digest.Replies, repliesQuery,
+			userID, query.Since, query.Comments, query.Replies, query.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch digest replies: %w", err)
+		}
+	}
+
+	// The most liked and discussed posts of users sharing the recipient's
+	// country or major
+	topPostsQuery := `
+        SELECT posts.id       AS post_id,
+               posts.title,
+               authors.username AS author,
+               posts.like_count,
+               posts.comment_count
+        FROM posts
+                 JOIN users authors ON authors.id = posts.user_id
+                 JOIN users recipient ON recipient.id = $1
+        WHERE posts.status = 'published'
+          AND posts.user_id <> $1
+          AND posts.created_at >= $2
+          AND (authors.country = recipient.country OR authors.major = recipient.major)
+        ORDER BY posts.like_count + posts.comment_count DESC, posts.id DESC
+        LIMIT $3;
+    `
+	err = sqlx.SelectContext(ctx, d.db, &digest.TopPosts, topPostsQuery, userID, query.Since, query.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch digest top posts: %w", err)
+	}
+
+	return &digest, nil
+}
@@ -4,20 +4,49 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
-var db *sqlx.DB
+// Moderation status of posts and comments
+const (
+	StatusPublished = "published"
+	StatusPending   = "pending"
+	StatusRejected  = "rejected" // Turned down by a moderator, never shown
+)
 
+// New creates the PostgreSQL backed repositories sharing the given pool
 func New(dbPool *sqlx.DB) *Models {
-	db = dbPool
+	models := newModels(dbPool)
+	models.withTx = postgresTx(dbPool)
+	return models
+}
 
+// newModels builds the repositories on top of a pool or a transaction
+func newModels(db sqlx.ExtContext) *Models {
 	return &Models{
-		Post:    &Post{},
-		Comment: &Comment{},
-		Like:    &Like{},
+		Post:       &PostRepository{db: db},
+		Comment:    &CommentRepository{db: db},
+		Like:       &LikeRepository{db: db},
+		Spam:       &SpamRepository{db: db},
+		Moderation: &ModerationRepository{db: db},
+
+		Notification: &NotificationRepository{db: db},
+		User:         &UserRepository{db: db},
+		Mention:      &MentionRepository{db: db},
+		Webhook:      &WebhookRepository{db: db},
+		Digest:       &DigestRepository{db: db},
 	}
 }
 
 type Models struct {
-	Post    PostInterfaces
-	Comment CommentInterfaces
-	Like    LikeInterfaces
+	Post       PostInterfaces
+	Comment    CommentInterfaces
+	Like       LikeInterfaces
+	Spam       SpamInterfaces
+	Moderation ModerationInterfaces
+
+	Notification NotificationInterfaces
+	User         UserInterfaces
+	Mention      MentionInterfaces
+	Webhook      WebhookInterfaces
+	Digest       DigestInterfaces
+
+	withTx txFunc
 }
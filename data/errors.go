@@ -0,0 +1,20 @@
+package data
+
+import (
+	"errors"
+	"github.com/jackc/pgconn"
+)
+
+// Sentinel errors returned by the models. They are wrapped with %w and can be
+// matched with errors.Is, e.g. fmt.Errorf("post %w", ErrNotFound).
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+	ErrConflict  = errors.New("conflict")
+)
+
+// isForeignKeyViolation reports whether a referenced row doesn't exist
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
@@ -0,0 +1,36 @@
+package data
+
+import (
+	"context"
+	"github.com/Ahmad-mufied/iducate-community-service/metrics"
+	"github.com/Ahmad-mufied/iducate-community-service/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// observe times a repository method for the query latency metrics and, in a
+// traced request, records it as a span:
+//
+//	defer observe(ctx, "post", "GetPostByID")()
+//
+// Background jobs polling the database aren't traced, they'd bury the
+// requests under spans of their own.
+func observe(ctx context.Context, repository string, method string) func() {
+	start := time.Now()
+
+	var span trace.Span
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		_, span = tracing.Start(ctx, repository+"."+method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL),
+		)
+	}
+
+	return func() {
+		if span != nil {
+			span.End()
+		}
+		metrics.ObserveQuery(repository, method, time.Since(start))
+	}
+}
@@ -2,26 +2,123 @@ package data
 
 import (
 	"context"
+	"time"
 )
 
 type PostInterfaces interface {
 	CreatePost(ctx context.Context, req *CreatePostRequest) (PostResponse, error)
-	GetPaginatedPosts(query PaginatedFeedQuery) ([]PostResponse, error)
+	GetPaginatedPosts(ctx context.Context, query PaginatedFeedQuery) ([]PostResponse, error)
 	GetPostDetailWithComments(ctx context.Context, postID uint) (*PostResponse, []*CommentResponse, error)
+	// GetPostByID returns the post whatever its moderation status
+	GetPostByID(ctx context.Context, postID uint) (*Post, error)
 	CheckPostByID(ctx context.Context, postID uint) (bool, error)
 	IncrementPostViews(ctx context.Context, postID uint) error
+	IncrementPostViewsBy(ctx context.Context, views map[uint]int) error
 	DeletePost(ctx context.Context, postID uint) error
+	// ReconcileCounters recomputes like_count and comment_count from the
+	// likes and comments tables and returns the number of corrected posts
+	ReconcileCounters(ctx context.Context) (int, error)
 }
 
 type CommentInterfaces interface {
 	GetComments(ctx context.Context, postID uint) ([]CommentResponse, error)
+	// GetCommentByID returns the comment whatever its moderation status
+	GetCommentByID(ctx context.Context, commentID uint) (*Comment, error)
 	GetCommentCount(ctx context.Context, postID int) (int, error)
-	CreateComment(ctx context.Context, postID uint, userID string, content string) (CommentResponse, error)
-	DeleteComment(ctx context.Context, commentID uint, userID string) error
+	CreateComment(ctx context.Context, req *CreateCommentRequest) (CommentResponse, error)
+	UpdateComment(ctx context.Context, req *UpdateCommentRequest) (*Comment, error)
+	DeleteComment(ctx context.Context, commentID uint, userID string) (*Comment, error)
 }
 
 type LikeInterfaces interface {
-	AddLike(ctx context.Context, userID string, postID int) error
-	RemoveLike(ctx context.Context, userID string, postID int) error
+	// AddLike likes a post and reports whether it wasn't liked already
+	AddLike(ctx context.Context, userID string, postID int) (bool, error)
+	// RemoveLike unlikes a post and reports whether it was liked
+	RemoveLike(ctx context.Context, userID string, postID int) (bool, error)
 	CountLikes(ctx context.Context, postID int) (int, error)
 }
+
+type NotificationInterfaces interface {
+	// CreateNotification records that an actor did something the recipient
+	// should hear about, aggregated with their unread notification of the
+	// same group
+	CreateNotification(ctx context.Context, notification *NewNotification) error
+	GetNotifications(ctx context.Context, userID string, query NotificationQuery) ([]NotificationResponse, error)
+	CountUnreadNotifications(ctx context.Context, userID string) (int, error)
+	MarkNotificationRead(ctx context.Context, userID string, notificationID uint) error
+	MarkAllNotificationsRead(ctx context.Context, userID string) (int, error)
+	// GetNotificationPreferences returns the channels of every notification
+	// type, the defaults for those the user never changed
+	GetNotificationPreferences(ctx context.Context, userID string) (NotificationPreferences, error)
+	// UpdateNotificationPreferences stores the channels of the given types
+	UpdateNotificationPreferences(ctx context.Context, userID string, preferences NotificationPreferences) error
+}
+
+type UserInterfaces interface {
+	// GetUser returns the user with the ID
+	GetUser(ctx context.Context, userID string) (*User, error)
+	// FindUsersByUsernames returns the users whose username is one of
+	// usernames, compared case-insensitively
+	FindUsersByUsernames(ctx context.Context, usernames []string) ([]User, error)
+	// SearchUsers returns up to limit users whose username, or a word of it,
+	// starts with prefix
+	SearchUsers(ctx context.Context, prefix string, limit int) ([]UserSummary, error)
+}
+
+type MentionInterfaces interface {
+	// ReplaceMentions stores the mentions in a post, or in one of its
+	// comments when commentID isn't 0, and returns the users mentioned before
+	ReplaceMentions(ctx context.Context, postID uint, commentID uint, mentions []Mention) ([]string, error)
+}
+
+type WebhookInterfaces interface {
+	// AddOutboxEvent records a change for the webhook endpoints subscribed to
+	// eventType. Call it with the models of the transaction making the change.
+	AddOutboxEvent(ctx context.Context, eventType string, postID uint, payload interface{}) error
+	CreateWebhookEndpoint(ctx context.Context, req *CreateWebhookEndpointRequest) (*WebhookEndpoint, error)
+	GetWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, endpointID uint) error
+	GetWebhookDeliveries(ctx context.Context, query WebhookDeliveryQuery) ([]WebhookDelivery, error)
+	// ReplayOutboxEvent sends an event again to its subscribed endpoints, or
+	// to one of them when endpointID isn't 0, and returns the number of
+	// deliveries queued
+	ReplayOutboxEvent(ctx context.Context, eventID uint, endpointID uint) (int, error)
+	// ReplayWebhookEndpoint sends the events since the given time again to an
+	// endpoint, or only its dead deliveries when since is nil
+	ReplayWebhookEndpoint(ctx context.Context, endpointID uint, since *time.Time) (int, error)
+	// ClaimWebhookDeliveries takes up to limit due deliveries, counting an
+	// attempt for each and hiding them from other claims for the lease
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueWebhookDelivery, error)
+	MarkWebhookDelivered(ctx context.Context, deliveryID uint, statusCode int) error
+	// MarkWebhookFailed records a failed attempt, retried at retryAt or dead
+	// when retryAt is nil
+	MarkWebhookFailed(ctx context.Context, deliveryID uint, statusCode int, message string, retryAt *time.Time) error
+}
+
+type DigestInterfaces interface {
+	// GetDigestPreference returns the user's digest frequency, the default
+	// one if they never chose
+	GetDigestPreference(ctx context.Context, userID string) (*DigestPreference, error)
+	UpdateDigestPreference(ctx context.Context, userID string, frequency string) error
+	// UnsubscribeDigest turns off the digest of the user the token was sent to
+	UnsubscribeDigest(ctx context.Context, token string) error
+	// ClaimDigestRecipients takes up to limit users whose digest is due and
+	// marks it sent
+	ClaimDigestRecipients(ctx context.Context, limit int) ([]DigestRecipient, error)
+	// GetDigest gathers the replies and top posts the query asks for
+	GetDigest(ctx context.Context, userID string, query DigestQuery) (*Digest, error)
+}
+
+type SpamInterfaces interface {
+	GetUserActivity(ctx context.Context, userID string, since time.Time) (*UserActivity, error)
+	RecordSpamScore(ctx context.Context, contentType string, contentID uint, userID string, score int, reasons []string, decision string) error
+}
+
+type ModerationInterfaces interface {
+	GetPendingContent(ctx context.Context, query PendingContentQuery) ([]PendingContent, error)
+	// ModeratePost publishes or rejects a pending post. Posts that aren't
+	// pending anymore are an ErrConflict.
+	ModeratePost(ctx context.Context, postID uint, status string) (*Post, error)
+	// ModerateComment publishes or rejects a pending comment, like ModeratePost
+	ModerateComment(ctx context.Context, commentID uint, status string) (*Comment, error)
+}
@@ -3,40 +3,65 @@ package data
 import (
 	"context"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 )
 
-type Like struct{}
+// LikeRepository stores likes in PostgreSQL
+type LikeRepository struct {
+	db sqlx.ExtContext
+}
+
+func (l *LikeRepository) AddLike(ctx context.Context, userID string, postID int) (bool, error) {
+	defer observe(ctx, "like", "AddLike")()
 
-func (l *Like) AddLike(ctx context.Context, userID string, postID int) error {
 	query := `
         INSERT INTO likes (user_id, post_id, created_at)
         VALUES ($1, $2, NOW())
         ON CONFLICT DO NOTHING; -- Avoid duplicate likes
     `
-	_, err := db.ExecContext(ctx, query, userID, postID)
+	result, err := l.db.ExecContext(ctx, query, userID, postID)
+	if err != nil {
+		// Foreign key violation means the post or the user doesn't exist
+		if isForeignKeyViolation(err) {
+			return false, fmt.Errorf("post or user %w", ErrNotFound)
+		}
+		return false, fmt.Errorf("failed to add like: %w", err)
+	}
+
+	// No row is inserted when the post was liked already
+	added, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to add like: %w", err)
+		return false, fmt.Errorf("failed to add like: %w", err)
 	}
-	return nil
+	return added > 0, nil
 }
 
-func (l *Like) RemoveLike(ctx context.Context, userID string, postID int) error {
+func (l *LikeRepository) RemoveLike(ctx context.Context, userID string, postID int) (bool, error) {
+	defer observe(ctx, "like", "RemoveLike")()
+
 	query := `DELETE FROM likes WHERE user_id = $1 AND post_id = $2;`
-	_, err := db.ExecContext(ctx, query, userID, postID)
+	result, err := l.db.ExecContext(ctx, query, userID, postID)
 	if err != nil {
-		return fmt.Errorf("failed to remove like: %w", err)
+		return false, fmt.Errorf("failed to remove like: %w", err)
 	}
-	return nil
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove like: %w", err)
+	}
+	return removed > 0, nil
 }
 
-func (l *Like) CountLikes(ctx context.Context, postID int) (int, error) {
+func (l *LikeRepository) CountLikes(ctx context.Context, postID int) (int, error) {
+	defer observe(ctx, "like", "CountLikes")()
+
 	query := `
         SELECT COUNT(*) 
         FROM likes
         WHERE post_id = $1;
     `
 	var likeCount int
-	err := db.GetContext(ctx, &likeCount, query, postID)
+	err := sqlx.GetContext(ctx, l.db, &likeCount, query, postID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count likes: %w", err)
 	}
@@ -0,0 +1,1684 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/xeonx/timeago"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps users, posts, comments, likes, spam scores, notifications,
+// mentions, webhooks and digest preferences in process memory. Models built with NewMemory behave like the
+// PostgreSQL repositories and are meant for tests and local experiments.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	txMu sync.Mutex // Serializes WithTx calls
+
+	users      map[string]User
+	posts      map[uint]*Post
+	comments   map[uint]*Comment
+	likes      map[memoryLikeKey]time.Time
+	spamScores []SpamScore
+
+	notifications      map[uint]*Notification
+	notificationActors map[uint]map[string]bool
+	notificationPrefs  map[string]NotificationPreferences // Changed types only
+	mentions           []Mention
+
+	webhookEndpoints  map[uint]*WebhookEndpoint
+	outboxEvents      map[uint]*OutboxEvent
+	webhookDeliveries map[uint]*WebhookDelivery
+
+	digestPreferences map[string]*memoryDigestPreference
+
+	nextPostID            uint
+	nextCommentID         uint
+	nextSpamID            uint
+	nextNotificationID    uint
+	nextWebhookEndpointID uint
+	nextOutboxEventID     uint
+	nextWebhookDeliveryID uint
+}
+
+type memoryLikeKey struct {
+	userID string
+	postID uint
+}
+
+// memoryDigestPreference is a row of digest_preferences
+type memoryDigestPreference struct {
+	frequency        string
+	unsubscribeToken string
+	lastSentAt       *time.Time
+}
+
+// NewMemoryStore creates an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:    make(map[string]User),
+		posts:    make(map[uint]*Post),
+		comments: make(map[uint]*Comment),
+		likes:    make(map[memoryLikeKey]time.Time),
+
+		notifications:      make(map[uint]*Notification),
+		notificationActors: make(map[uint]map[string]bool),
+		notificationPrefs:  make(map[string]NotificationPreferences),
+
+		webhookEndpoints:  make(map[uint]*WebhookEndpoint),
+		outboxEvents:      make(map[uint]*OutboxEvent),
+		webhookDeliveries: make(map[uint]*WebhookDelivery),
+
+		digestPreferences: make(map[string]*memoryDigestPreference),
+	}
+}
+
+// AddUser stores a user. Users are owned by another service, so the
+// repositories only read them.
+func (s *MemoryStore) AddUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	s.users[user.ID] = user
+}
+
+// SpamScores returns a copy of the recorded spam scores
+func (s *MemoryStore) SpamScores() []SpamScore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]SpamScore(nil), s.spamScores...)
+}
+
+// NewMemory creates repositories backed by the given store
+func NewMemory(store *MemoryStore) *Models {
+	models := &Models{
+		Post:       &MemoryPostRepository{store: store},
+		Comment:    &MemoryCommentRepository{store: store},
+		Like:       &MemoryLikeRepository{store: store},
+		Spam:       &MemorySpamRepository{store: store},
+		Moderation: &MemoryModerationRepository{store: store},
+
+		Notification: &MemoryNotificationRepository{store: store},
+		User:         &MemoryUserRepository{store: store},
+		Mention:      &MemoryMentionRepository{store: store},
+		Webhook:      &MemoryWebhookRepository{store: store},
+		Digest:       &MemoryDigestRepository{store: store},
+	}
+	models.withTx = memoryTx(store, models)
+	return models
+}
+
+// memoryTx serializes transactions and restores the store to its state
+// before the transaction when fn fails or panics. Writes made outside of
+// WithTx while a transaction is running are lost on rollback.
+func memoryTx(store *MemoryStore, models *Models) txFunc {
+	return func(ctx context.Context, fn func(tx *Models) error) (err error) {
+		store.txMu.Lock()
+		defer store.txMu.Unlock()
+
+		snapshot := store.snapshot()
+		defer func() {
+			if p := recover(); p != nil {
+				store.restore(snapshot)
+				panic(p)
+			}
+			if err != nil {
+				store.restore(snapshot)
+			}
+		}()
+
+		txModels := *models
+		txModels.withTx = nestedTx(&txModels)
+		return fn(&txModels)
+	}
+}
+
+// snapshot deep copies the store
+func (s *MemoryStore) snapshot() *MemoryStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	copied := NewMemoryStore()
+	for id, user := range s.users {
+		copied.users[id] = user
+	}
+	for id, post := range s.posts {
+		post := *post
+		copied.posts[id] = &post
+	}
+	for id, comment := range s.comments {
+		comment := *comment
+		copied.comments[id] = &comment
+	}
+	for key, likedAt := range s.likes {
+		copied.likes[key] = likedAt
+	}
+	copied.spamScores = append([]SpamScore(nil), s.spamScores...)
+	for id, notification := range s.notifications {
+		notification := *notification
+		copied.notifications[id] = &notification
+	}
+	for id, actors := range s.notificationActors {
+		copied.notificationActors[id] = make(map[string]bool, len(actors))
+		for actorID := range actors {
+			copied.notificationActors[id][actorID] = true
+		}
+	}
+	for userID, preferences := range s.notificationPrefs {
+		copied.notificationPrefs[userID] = make(NotificationPreferences, len(preferences))
+		for notificationType, channels := range preferences {
+			copied.notificationPrefs[userID][notificationType] = channels
+		}
+	}
+	copied.mentions = append([]Mention(nil), s.mentions...)
+	for id, endpoint := range s.webhookEndpoints {
+		endpoint := *endpoint
+		copied.webhookEndpoints[id] = &endpoint
+	}
+	for id, event := range s.outboxEvents {
+		event := *event
+		copied.outboxEvents[id] = &event
+	}
+	for id, delivery := range s.webhookDeliveries {
+		delivery := *delivery
+		copied.webhookDeliveries[id] = &delivery
+	}
+	for userID, preference := range s.digestPreferences {
+		preference := *preference
+		copied.digestPreferences[userID] = &preference
+	}
+	copied.nextPostID = s.nextPostID
+	copied.nextCommentID = s.nextCommentID
+	copied.nextSpamID = s.nextSpamID
+	copied.nextNotificationID = s.nextNotificationID
+	copied.nextWebhookEndpointID = s.nextWebhookEndpointID
+	copied.nextOutboxEventID = s.nextOutboxEventID
+	copied.nextWebhookDeliveryID = s.nextWebhookDeliveryID
+
+	return copied
+}
+
+// restore replaces the store's data with a snapshot
+func (s *MemoryStore) restore(snapshot *MemoryStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = snapshot.users
+	s.posts = snapshot.posts
+	s.comments = snapshot.comments
+	s.likes = snapshot.likes
+	s.spamScores = snapshot.spamScores
+	s.notifications = snapshot.notifications
+	s.notificationActors = snapshot.notificationActors
+	s.notificationPrefs = snapshot.notificationPrefs
+	s.mentions = snapshot.mentions
+	s.webhookEndpoints = snapshot.webhookEndpoints
+	s.outboxEvents = snapshot.outboxEvents
+	s.webhookDeliveries = snapshot.webhookDeliveries
+	s.digestPreferences = snapshot.digestPreferences
+	s.nextPostID = snapshot.nextPostID
+	s.nextCommentID = snapshot.nextCommentID
+	s.nextSpamID = snapshot.nextSpamID
+	s.nextNotificationID = snapshot.nextNotificationID
+	s.nextWebhookEndpointID = snapshot.nextWebhookEndpointID
+	s.nextOutboxEventID = snapshot.nextOutboxEventID
+	s.nextWebhookDeliveryID = snapshot.nextWebhookDeliveryID
+}
+
+// publishedComments returns the published comments of a post in insertion order.
+// The caller must hold the lock.
+func (s *MemoryStore) publishedComments(postID uint) []*Comment {
+	var comments []*Comment
+	for _, comment := range s.comments {
+		if comment.PostID == postID && comment.Status == StatusPublished {
+			comments = append(comments, comment)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].ID < comments[j].ID
+	})
+	return comments
+}
+
+// likeCount counts the likes of a post. The caller must hold the lock.
+func (s *MemoryStore) likeCount(postID uint) int {
+	count := 0
+	for key := range s.likes {
+		if key.postID == postID {
+			count++
+		}
+	}
+	return count
+}
+
+// postResponse builds the feed representation of a post. The caller must hold the lock.
+func (s *MemoryStore) postResponse(post *Post) PostResponse {
+	return PostResponse{
+		ID:           post.ID,
+		Title:        post.Title,
+		Content:      post.Content,
+		Views:        post.Views,
+		Author:       s.users[post.UserID].Username,
+		LikeCount:    s.likeCount(post.ID),
+		CommentCount: len(s.publishedComments(post.ID)),
+		CreatedAt:    timeago.English.Format(post.CreatedAt),
+		Mentions:     s.mentionsOf(post.ID, 0),
+	}
+}
+
+// mentionsOf returns the mentions in a post, or in one of its comments when
+// commentID isn't 0, with the current usernames. The caller must hold the lock.
+func (s *MemoryStore) mentionsOf(postID uint, commentID uint) []Mention {
+	mentions := []Mention{}
+	for _, mention := range s.mentions {
+		if mention.PostID != postID || memoryCommentID(mention.CommentID) != commentID {
+			continue
+		}
+		mention.Username = s.users[mention.UserID].Username
+		mentions = append(mentions, mention)
+	}
+	sort.Slice(mentions, func(i, j int) bool {
+		return mentions[i].Offset < mentions[j].Offset
+	})
+	return mentions
+}
+
+// memoryCommentID maps a nullable comment ID to 0 for NULL
+func memoryCommentID(commentID *uint) uint {
+	if commentID == nil {
+		return 0
+	}
+	return *commentID
+}
+
+// MemoryPostRepository stores posts in a MemoryStore
+type MemoryPostRepository struct {
+	store *MemoryStore
+}
+
+func (p *MemoryPostRepository) CreatePost(ctx context.Context, req *CreatePostRequest) (PostResponse, error) {
+	s := p.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	author, ok := s.users[req.UserID]
+	if !ok {
+		return PostResponse{}, fmt.Errorf("user %w", ErrNotFound)
+	}
+
+	status := req.Status
+	if status == "" {
+		status = StatusPublished
+	}
+
+	s.nextPostID++
+	now := time.Now()
+	post := &Post{
+		ID:        s.nextPostID,
+		UserID:    req.UserID,
+		Title:     req.Title,
+		Content:   req.Content,
+		Status:    status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.posts[post.ID] = post
+
+	return PostResponse{
+		ID:        post.ID,
+		Title:     post.Title,
+		Content:   post.Content,
+		Views:     post.Views,
+		Author:    author.Username,
+		CreatedAt: timeago.English.Format(post.CreatedAt),
+		Mentions:  []Mention{},
+	}, nil
+}
+
+func (p *MemoryPostRepository) GetPaginatedPosts(ctx context.Context, query PaginatedFeedQuery) ([]PostResponse, error) {
+	s := p.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type feedItem struct {
+		post      *Post
+		likeCount int
+	}
+
+	var items []feedItem
+	for _, post := range s.posts {
+		if post.Status == StatusPublished {
+			items = append(items, feedItem{post: post, likeCount: s.likeCount(post.ID)})
+		}
+	}
+
+	// Sort ascending by the requested key, then flip for descending order
+	var less func(a, b feedItem) bool
+	switch query.SortType {
+	case "trend":
+		less = func(a, b feedItem) bool {
+			if a.likeCount != b.likeCount {
+				return a.likeCount < b.likeCount
+			}
+			return a.post.ID < b.post.ID
+		}
+	case "latest":
+		less = func(a, b feedItem) bool {
+			if !a.post.CreatedAt.Equal(b.post.CreatedAt) {
+				return a.post.CreatedAt.Before(b.post.CreatedAt)
+			}
+			return a.post.ID < b.post.ID
+		}
+	default:
+		return nil, fmt.Errorf("unexpected sortType: %s", query.SortType)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if query.Sort == "desc" {
+			return less(items[j], items[i])
+		}
+		return less(items[i], items[j])
+	})
+
+	var posts []PostResponse
+	for i := query.Offset; i < len(items) && len(posts) < query.Limit; i++ {
+		posts = append(posts, s.postResponse(items[i].post))
+	}
+
+	return posts, nil
+}
+
+func (p *MemoryPostRepository) GetPostDetailWithComments(ctx context.Context, postID uint) (*PostResponse, []*CommentResponse, error) {
+	s := p.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[postID]
+	if !ok || post.Status != StatusPublished {
+		return nil, nil, fmt.Errorf("post %w", ErrNotFound)
+	}
+
+	postDetail := s.postResponse(post)
+
+	var comments []*CommentResponse
+	for _, comment := range s.publishedComments(postID) {
+		comments = append(comments, &CommentResponse{
+			ID:        comment.ID,
+			ParentID:  comment.ParentID,
+			Username:  s.users[comment.UserID].Username,
+			Content:   comment.Content,
+			CreatedAt: timeago.English.Format(comment.CreatedAt),
+			Mentions:  s.mentionsOf(postID, comment.ID),
+		})
+	}
+
+	return &postDetail, comments, nil
+}
+
+func (p *MemoryPostRepository) GetPostByID(ctx context.Context, postID uint) (*Post, error) {
+	s := p.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[postID]
+	if !ok {
+		return nil, fmt.Errorf("post %w", ErrNotFound)
+	}
+	copied := *post
+	return &copied, nil
+}
+
+func (p *MemoryPostRepository) CheckPostByID(ctx context.Context, postID uint) (bool, error) {
+	s := p.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.posts[postID]
+	return ok, nil
+}
+
+func (p *MemoryPostRepository) IncrementPostViews(ctx context.Context, postID uint) error {
+	s := p.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if post, ok := s.posts[postID]; ok {
+		post.Views++
+	}
+	return nil
+}
+
+func (p *MemoryPostRepository) IncrementPostViewsBy(ctx context.Context, views map[uint]int) error {
+	s := p.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for postID, count := range views {
+		if post, ok := s.posts[postID]; ok {
+			post.Views += count
+		}
+	}
+	return nil
+}
+
+func (p *MemoryPostRepository) DeletePost(ctx context.Context, postID uint) error {
+	s := p.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[postID]; !ok {
+		return fmt.Errorf("post %w", ErrNotFound)
+	}
+
+	// Cascade like the foreign keys do
+	delete(s.posts, postID)
+	for id, comment := range s.comments {
+		if comment.PostID == postID {
+			delete(s.comments, id)
+		}
+	}
+	for key := range s.likes {
+		if key.postID == postID {
+			delete(s.likes, key)
+		}
+	}
+	for id, notification := range s.notifications {
+		if notification.PostID == postID {
+			delete(s.notifications, id)
+			delete(s.notificationActors, id)
+		}
+	}
+	s.mentions = removeMentions(s.mentions, func(mention Mention) bool {
+		return mention.PostID == postID
+	})
+
+	return nil
+}
+
+// ReconcileCounters has nothing to correct because the memory store counts
+// likes and comments on every read
+func (p *MemoryPostRepository) ReconcileCounters(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// MemoryCommentRepository stores comments in a MemoryStore
+type MemoryCommentRepository struct {
+	store *MemoryStore
+}
+
+func (c *MemoryCommentRepository) GetComments(ctx context.Context, postID uint) ([]CommentResponse, error) {
+	s := c.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	published := s.publishedComments(postID)
+
+	// Newest first
+	comments := make([]CommentResponse, 0, len(published))
+	for i := len(published) - 1; i >= 0; i-- {
+		comment := published[i]
+		comments = append(comments, CommentResponse{
+			ID:        comment.ID,
+			ParentID:  comment.ParentID,
+			Username:  s.users[comment.UserID].Username,
+			Content:   comment.Content,
+			CreatedAt: comment.CreatedAt.Format(time.RFC3339Nano),
+			Mentions:  s.mentionsOf(postID, comment.ID),
+		})
+	}
+
+	return comments, nil
+}
+
+func (c *MemoryCommentRepository) GetCommentCount(ctx context.Context, postID int) (int, error) {
+	s := c.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.publishedComments(uint(postID))), nil
+}
+
+func (c *MemoryCommentRepository) CreateComment(ctx context.Context, req *CreateCommentRequest) (CommentResponse, error) {
+	s := c.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if post, ok := s.posts[req.PostID]; !ok || post.Status != StatusPublished {
+		return CommentResponse{}, fmt.Errorf("post %w", ErrNotFound)
+	}
+	author, ok := s.users[req.UserID]
+	if !ok {
+		return CommentResponse{}, fmt.Errorf("user %w", ErrNotFound)
+	}
+	if req.ParentID != nil {
+		parent, ok := s.comments[*req.ParentID]
+		if !ok || parent.Status != StatusPublished || parent.PostID != req.PostID {
+			return CommentResponse{}, fmt.Errorf("parent comment %w", ErrNotFound)
+		}
+	}
+
+	status := req.Status
+	if status == "" {
+		status = StatusPublished
+	}
+
+	s.nextCommentID++
+	comment := &Comment{
+		ID:        s.nextCommentID,
+		PostID:    req.PostID,
+		UserID:    req.UserID,
+		ParentID:  req.ParentID,
+		Content:   req.Content,
+		Status:    status,
+		CreatedAt: time.Now(),
+	}
+	s.comments[comment.ID] = comment
+
+	return CommentResponse{
+		ID:        comment.ID,
+		ParentID:  comment.ParentID,
+		Username:  author.Username,
+		Content:   comment.Content,
+		CreatedAt: timeago.English.Format(comment.CreatedAt),
+		Mentions:  []Mention{},
+	}, nil
+}
+
+func (c *MemoryCommentRepository) UpdateComment(ctx context.Context, req *UpdateCommentRequest) (*Comment, error) {
+	s := c.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[req.CommentID]
+	if !ok {
+		return nil, fmt.Errorf("comment %w", ErrNotFound)
+	}
+	if comment.UserID != req.UserID {
+		return nil, fmt.Errorf("%w: you are not the owner of this comment", ErrForbidden)
+	}
+
+	comment.Content = req.Content
+	if req.Status != "" {
+		comment.Status = req.Status
+	}
+	updated := *comment
+	return &updated, nil
+}
+
+func (c *MemoryCommentRepository) DeleteComment(ctx context.Context, commentID uint, userID string) (*Comment, error) {
+	s := c.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[commentID]
+	if !ok {
+		return nil, fmt.Errorf("comment %w", ErrNotFound)
+	}
+	if comment.UserID != userID {
+		return nil, fmt.Errorf("%w: you are not the owner of this comment", ErrForbidden)
+	}
+
+	// Detach replies and notifications like the foreign keys do
+	delete(s.comments, commentID)
+	for _, reply := range s.comments {
+		if reply.ParentID != nil && *reply.ParentID == commentID {
+			reply.ParentID = nil
+		}
+	}
+	for _, notification := range s.notifications {
+		if notification.CommentID != nil && *notification.CommentID == commentID {
+			notification.CommentID = nil
+		}
+	}
+	s.mentions = removeMentions(s.mentions, func(mention Mention) bool {
+		return memoryCommentID(mention.CommentID) == commentID
+	})
+
+	deleted := *comment
+	return &deleted, nil
+}
+
+func (c *MemoryCommentRepository) GetCommentByID(ctx context.Context, commentID uint) (*Comment, error) {
+	s := c.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	comment, ok := s.comments[commentID]
+	if !ok {
+		return nil, fmt.Errorf("comment %w", ErrNotFound)
+	}
+	copied := *comment
+	return &copied, nil
+}
+
+// MemoryLikeRepository stores likes in a MemoryStore
+type MemoryLikeRepository struct {
+	store *MemoryStore
+}
+
+func (l *MemoryLikeRepository) AddLike(ctx context.Context, userID string, postID int) (bool, error) {
+	s := l.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[uint(postID)]; !ok {
+		return false, fmt.Errorf("post or user %w", ErrNotFound)
+	}
+	if _, ok := s.users[userID]; !ok {
+		return false, fmt.Errorf("post or user %w", ErrNotFound)
+	}
+
+	// Liking twice is a no-op
+	key := memoryLikeKey{userID: userID, postID: uint(postID)}
+	if _, ok := s.likes[key]; ok {
+		return false, nil
+	}
+	s.likes[key] = time.Now()
+	return true, nil
+}
+
+func (l *MemoryLikeRepository) RemoveLike(ctx context.Context, userID string, postID int) (bool, error) {
+	s := l.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryLikeKey{userID: userID, postID: uint(postID)}
+	if _, ok := s.likes[key]; !ok {
+		return false, nil
+	}
+	delete(s.likes, key)
+	return true, nil
+}
+
+func (l *MemoryLikeRepository) CountLikes(ctx context.Context, postID int) (int, error) {
+	s := l.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.likeCount(uint(postID)), nil
+}
+
+// MemorySpamRepository stores spam scores in a MemoryStore
+type MemorySpamRepository struct {
+	store *MemoryStore
+}
+
+func (r *MemorySpamRepository) GetUserActivity(ctx context.Context, userID string, since time.Time) (*UserActivity, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
+	}
+
+	activity := &UserActivity{AccountCreatedAt: user.CreatedAt}
+	for _, post := range s.posts {
+		if post.UserID == userID && !post.CreatedAt.Before(since) {
+			activity.RecentContents = append(activity.RecentContents, post.Title+"\n"+post.Content)
+		}
+	}
+	for _, comment := range s.comments {
+		if comment.UserID == userID && !comment.CreatedAt.Before(since) {
+			activity.RecentContents = append(activity.RecentContents, comment.Content)
+		}
+	}
+
+	return activity, nil
+}
+
+func (r *MemorySpamRepository) RecordSpamScore(ctx context.Context, contentType string, contentID uint, userID string, score int, reasons []string, decision string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextSpamID++
+	spamScore := SpamScore{
+		ID:          s.nextSpamID,
+		ContentType: contentType,
+		UserID:      userID,
+		Score:       score,
+		Reasons:     strings.Join(reasons, ", "),
+		Decision:    decision,
+		CreatedAt:   time.Now(),
+	}
+	if contentID != 0 {
+		spamScore.ContentID = &contentID
+	}
+	s.spamScores = append(s.spamScores, spamScore)
+
+	return nil
+}
+
+// MemoryModerationRepository reviews the pending content of a MemoryStore
+type MemoryModerationRepository struct {
+	store *MemoryStore
+}
+
+func (m *MemoryModerationRepository) GetPendingContent(ctx context.Context, query PendingContentQuery) ([]PendingContent, error) {
+	s := m.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matching []PendingContent
+	if query.ContentType == "" || query.ContentType == ContentTypePost {
+		for _, post := range s.posts {
+			if post.Status == StatusPending {
+				matching = append(matching, s.pendingContent(PendingContent{
+					ContentType: ContentTypePost,
+					ID:          post.ID,
+					PostID:      post.ID,
+					UserID:      post.UserID,
+					Title:       post.Title,
+					Content:     post.Content,
+					CreatedAt:   post.CreatedAt,
+				}))
+			}
+		}
+	}
+	if query.ContentType == "" || query.ContentType == ContentTypeComment {
+		for _, comment := range s.comments {
+			if comment.Status == StatusPending {
+				matching = append(matching, s.pendingContent(PendingContent{
+					ContentType: ContentTypeComment,
+					ID:          comment.ID,
+					PostID:      comment.PostID,
+					ParentID:    comment.ParentID,
+					UserID:      comment.UserID,
+					Content:     comment.Content,
+					CreatedAt:   comment.CreatedAt,
+				}))
+			}
+		}
+	}
+
+	// Oldest first
+	sort.Slice(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		if a.ContentType != b.ContentType {
+			return a.ContentType < b.ContentType
+		}
+		return a.ID < b.ID
+	})
+
+	contents := []PendingContent{}
+	for i := query.Offset; i < len(matching) && len(contents) < query.Limit; i++ {
+		contents = append(contents, matching[i])
+	}
+	return contents, nil
+}
+
+// pendingContent adds the latest spam score of the content. Callers must
+// hold s.mu.
+func (s *MemoryStore) pendingContent(content PendingContent) PendingContent {
+	for i := len(s.spamScores) - 1; i >= 0; i-- {
+		spamScore := s.spamScores[i]
+		if spamScore.ContentType == content.ContentType && spamScore.ContentID != nil && *spamScore.ContentID == content.ID {
+			score, reasons := spamScore.Score, spamScore.Reasons
+			content.SpamScore, content.SpamReasons = &score, &reasons
+			break
+		}
+	}
+	return content
+}
+
+func (m *MemoryModerationRepository) ModeratePost(ctx context.Context, postID uint, status string) (*Post, error) {
+	s := m.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[postID]
+	if !ok {
+		return nil, fmt.Errorf("post %w", ErrNotFound)
+	}
+	if post.Status != StatusPending {
+		return nil, fmt.Errorf("%w: post is %s, not pending", ErrConflict, post.Status)
+	}
+
+	post.Status = status
+	post.UpdatedAt = time.Now()
+	moderated := *post
+	return &moderated, nil
+}
+
+func (m *MemoryModerationRepository) ModerateComment(ctx context.Context, commentID uint, status string) (*Comment, error) {
+	s := m.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[commentID]
+	if !ok {
+		return nil, fmt.Errorf("comment %w", ErrNotFound)
+	}
+	if comment.Status != StatusPending {
+		return nil, fmt.Errorf("%w: comment is %s, not pending", ErrConflict, comment.Status)
+	}
+
+	comment.Status = status
+	moderated := *comment
+	return &moderated, nil
+}
+
+// MemoryNotificationRepository stores notifications in a MemoryStore
+type MemoryNotificationRepository struct {
+	store *MemoryStore
+}
+
+func (n *MemoryNotificationRepository) CreateNotification(ctx context.Context, notification *NewNotification) error {
+	s := n.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[notification.PostID]; !ok {
+		return fmt.Errorf("post or user %w", ErrNotFound)
+	}
+	if _, ok := s.users[notification.UserID]; !ok {
+		return fmt.Errorf("post or user %w", ErrNotFound)
+	}
+	if _, ok := s.users[notification.ActorID]; !ok {
+		return fmt.Errorf("post or user %w", ErrNotFound)
+	}
+
+	var commentID *uint
+	if notification.CommentID != 0 {
+		id := notification.CommentID
+		commentID = &id
+	}
+	now := time.Now()
+
+	// Aggregate with the unread notification of the same group
+	for id, existing := range s.notifications {
+		if existing.UserID != notification.UserID || existing.GroupKey != notification.GroupKey || existing.ReadAt != nil {
+			continue
+		}
+		existing.LatestActorID = notification.ActorID
+		if commentID != nil {
+			existing.CommentID = commentID
+		}
+		if !s.notificationActors[id][notification.ActorID] {
+			s.notificationActors[id][notification.ActorID] = true
+			existing.ActorCount++
+		}
+		existing.UpdatedAt = now
+		return nil
+	}
+
+	s.nextNotificationID++
+	s.notifications[s.nextNotificationID] = &Notification{
+		ID:            s.nextNotificationID,
+		UserID:        notification.UserID,
+		Type:          notification.Type,
+		PostID:        notification.PostID,
+		CommentID:     commentID,
+		GroupKey:      notification.GroupKey,
+		LatestActorID: notification.ActorID,
+		ActorCount:    1,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	s.notificationActors[s.nextNotificationID] = map[string]bool{notification.ActorID: true}
+
+	return nil
+}
+
+func (n *MemoryNotificationRepository) GetNotifications(ctx context.Context, userID string, query NotificationQuery) ([]NotificationResponse, error) {
+	s := n.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matching []*Notification
+	for _, notification := range s.notifications {
+		if notification.UserID != userID || (query.Unread && notification.ReadAt != nil) {
+			continue
+		}
+		matching = append(matching, notification)
+	}
+
+	// Latest activity first
+	sort.Slice(matching, func(i, j int) bool {
+		if !matching[i].UpdatedAt.Equal(matching[j].UpdatedAt) {
+			return matching[i].UpdatedAt.After(matching[j].UpdatedAt)
+		}
+		return matching[i].ID > matching[j].ID
+	})
+
+	notifications := []NotificationResponse{}
+	for i := query.Offset; i < len(matching) && len(notifications) < query.Limit; i++ {
+		notification := matching[i]
+		response := NotificationResponse{
+			ID:         notification.ID,
+			Type:       notification.Type,
+			PostID:     notification.PostID,
+			PostTitle:  s.posts[notification.PostID].Title,
+			CommentID:  notification.CommentID,
+			ActorID:    notification.LatestActorID,
+			ActorName:  s.users[notification.LatestActorID].Username,
+			ActorCount: notification.ActorCount,
+			Read:       notification.ReadAt != nil,
+			UpdatedAt:  notification.UpdatedAt,
+		}
+		response.finish()
+		notifications = append(notifications, response)
+	}
+
+	return notifications, nil
+}
+
+func (n *MemoryNotificationRepository) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	s := n.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, notification := range s.notifications {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (n *MemoryNotificationRepository) MarkNotificationRead(ctx context.Context, userID string, notificationID uint) error {
+	s := n.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notification, ok := s.notifications[notificationID]
+	if !ok || notification.UserID != userID {
+		return fmt.Errorf("notification %w", ErrNotFound)
+	}
+	if notification.ReadAt == nil {
+		now := time.Now()
+		notification.ReadAt = &now
+	}
+	return nil
+}
+
+func (n *MemoryNotificationRepository) MarkAllNotificationsRead(ctx context.Context, userID string) (int, error) {
+	s := n.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	updated := 0
+	for _, notification := range s.notifications {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			notification.ReadAt = &now
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (n *MemoryNotificationRepository) GetNotificationPreferences(ctx context.Context, userID string) (NotificationPreferences, error) {
+	s := n.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	preferences := DefaultNotificationPreferences()
+	for notificationType, channels := range s.notificationPrefs[userID] {
+		preferences[notificationType] = channels
+	}
+	return preferences, nil
+}
+
+func (n *MemoryNotificationRepository) UpdateNotificationPreferences(ctx context.Context, userID string, preferences NotificationPreferences) error {
+	s := n.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+
+	stored, ok := s.notificationPrefs[userID]
+	if !ok {
+		stored = make(NotificationPreferences)
+		s.notificationPrefs[userID] = stored
+	}
+	for notificationType, channels := range preferences {
+		stored[notificationType] = channels
+	}
+	return nil
+}
+
+// MemoryUserRepository reads the users of a MemoryStore
+type MemoryUserRepository struct {
+	store *MemoryStore
+}
+
+func (u *MemoryUserRepository) GetUser(ctx context.Context, userID string) (*User, error) {
+	s := u.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
+	}
+	return &user, nil
+}
+
+func (u *MemoryUserRepository) FindUsersByUsernames(ctx context.Context, usernames []string) ([]User, error) {
+	s := u.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(usernames))
+	for _, username := range usernames {
+		wanted[strings.ToLower(username)] = true
+	}
+
+	var users []User
+	for _, user := range s.users {
+		if wanted[strings.ToLower(user.Username)] {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (u *MemoryUserRepository) SearchUsers(ctx context.Context, prefix string, limit int) ([]UserSummary, error) {
+	s := u.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefix = strings.ToLower(prefix)
+
+	type match struct {
+		user      UserSummary
+		name      string
+		wholeName bool
+	}
+
+	var matches []match
+	for _, user := range s.users {
+		name := strings.ToLower(user.Username)
+		wholeName := strings.HasPrefix(name, prefix)
+		if wholeName || strings.Contains(name, " "+prefix) {
+			matches = append(matches, match{
+				user:      UserSummary{ID: user.ID, Username: user.Username},
+				name:      name,
+				wholeName: wholeName,
+			})
+		}
+	}
+
+	// Whole-name matches first, like the PostgreSQL repository
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].wholeName != matches[j].wholeName {
+			return matches[i].wholeName
+		}
+		if matches[i].name != matches[j].name {
+			return matches[i].name < matches[j].name
+		}
+		return matches[i].user.ID < matches[j].user.ID
+	})
+
+	users := []UserSummary{}
+	for i := 0; i < len(matches) && len(users) < limit; i++ {
+		users = append(users, matches[i].user)
+	}
+	return users, nil
+}
+
+// MemoryMentionRepository stores mentions in a MemoryStore
+type MemoryMentionRepository struct {
+	store *MemoryStore
+}
+
+func (m *MemoryMentionRepository) ReplaceMentions(ctx context.Context, postID uint, commentID uint, mentions []Mention) ([]string, error) {
+	s := m.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[postID]; !ok {
+		return nil, fmt.Errorf("post, comment or user %w", ErrNotFound)
+	}
+	if _, ok := s.comments[commentID]; commentID != 0 && !ok {
+		return nil, fmt.Errorf("post, comment or user %w", ErrNotFound)
+	}
+	for _, mention := range mentions {
+		if _, ok := s.users[mention.UserID]; !ok {
+			return nil, fmt.Errorf("post, comment or user %w", ErrNotFound)
+		}
+	}
+
+	var previous []string
+	s.mentions = removeMentions(s.mentions, func(mention Mention) bool {
+		if mention.PostID == postID && memoryCommentID(mention.CommentID) == commentID {
+			previous = append(previous, mention.UserID)
+			return true
+		}
+		return false
+	})
+
+	for _, mention := range mentions {
+		mention.PostID = postID
+		mention.CommentID = nil
+		if commentID != 0 {
+			id := commentID
+			mention.CommentID = &id
+		}
+		s.mentions = append(s.mentions, mention)
+	}
+
+	return distinct(previous), nil
+}
+
+// removeMentions returns mentions without those matching remove. It doesn't
+// modify mentions, which may be shared with a snapshot.
+func removeMentions(mentions []Mention, remove func(Mention) bool) []Mention {
+	var kept []Mention
+	for _, mention := range mentions {
+		if !remove(mention) {
+			kept = append(kept, mention)
+		}
+	}
+	return kept
+}
+
+// MemoryWebhookRepository stores the outbox and the webhook endpoints and
+// deliveries in a MemoryStore
+type MemoryWebhookRepository struct {
+	store *MemoryStore
+}
+
+func (w *MemoryWebhookRepository) AddOutboxEvent(ctx context.Context, eventType string, postID uint, payload interface{}) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	s := w.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextOutboxEventID++
+	event := &OutboxEvent{
+		ID:        s.nextOutboxEventID,
+		Type:      eventType,
+		PostID:    postID,
+		Payload:   encoded,
+		CreatedAt: time.Now(),
+	}
+	s.outboxEvents[event.ID] = event
+
+	for _, endpoint := range s.webhookEndpoints {
+		if subscribed(endpoint, eventType) {
+			s.queueDelivery(event, endpoint.ID)
+		}
+	}
+	return nil
+}
+
+func (w *MemoryWebhookRepository) CreateWebhookEndpoint(ctx context.Context, req *CreateWebhookEndpointRequest) (*WebhookEndpoint, error) {
+	s := w.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	eventTypes := append([]string{}, req.EventTypes...)
+
+	s.nextWebhookEndpointID++
+	endpoint := &WebhookEndpoint{
+		ID:         s.nextWebhookEndpointID,
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: eventTypes,
+		CreatedAt:  time.Now(),
+	}
+	s.webhookEndpoints[endpoint.ID] = endpoint
+
+	created := *endpoint
+	return &created, nil
+}
+
+func (w *MemoryWebhookRepository) GetWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	s := w.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	endpoints := make([]WebhookEndpoint, 0, len(s.webhookEndpoints))
+	for _, endpoint := range s.webhookEndpoints {
+		endpoint := *endpoint
+		endpoint.Secret = ""
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].ID < endpoints[j].ID
+	})
+	return endpoints, nil
+}
+
+func (w *MemoryWebhookRepository) DeleteWebhookEndpoint(ctx context.Context, endpointID uint) error {
+	s := w.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhookEndpoints[endpointID]; !ok {
+		return fmt.Errorf("webhook endpoint %w", ErrNotFound)
+	}
+
+	// Cascade like the foreign key does
+	delete(s.webhookEndpoints, endpointID)
+	for id, delivery := range s.webhookDeliveries {
+		if delivery.EndpointID == endpointID {
+			delete(s.webhookDeliveries, id)
+		}
+	}
+	return nil
+}
+
+func (w *MemoryWebhookRepository) GetWebhookDeliveries(ctx context.Context, query WebhookDeliveryQuery) ([]WebhookDelivery, error) {
+	s := w.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matching []WebhookDelivery
+	for _, delivery := range s.webhookDeliveries {
+		if query.Status != "" && delivery.Status != query.Status {
+			continue
+		}
+		if query.EndpointID != 0 && delivery.EndpointID != query.EndpointID {
+			continue
+		}
+		matching = append(matching, *delivery)
+	}
+
+	// Newest first
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].ID > matching[j].ID
+	})
+
+	deliveries := []WebhookDelivery{}
+	for i := query.Offset; i < len(matching) && len(deliveries) < query.Limit; i++ {
+		deliveries = append(deliveries, matching[i])
+	}
+	return deliveries, nil
+}
+
+func (w *MemoryWebhookRepository) ReplayOutboxEvent(ctx context.Context, eventID uint, endpointID uint) (int, error) {
+	s := w.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, ok := s.outboxEvents[eventID]
+	if !ok {
+		return 0, fmt.Errorf("event %w", ErrNotFound)
+	}
+	if _, ok := s.webhookEndpoints[endpointID]; endpointID != 0 && !ok {
+		return 0, fmt.Errorf("webhook endpoint %w", ErrNotFound)
+	}
+
+	replayed := 0
+	for _, endpoint := range s.webhookEndpoints {
+		if (endpointID == 0 || endpoint.ID == endpointID) && subscribed(endpoint, event.Type) {
+			s.queueDelivery(event, endpoint.ID)
+			replayed++
+		}
+	}
+	return replayed, nil
+}
+
+func (w *MemoryWebhookRepository) ReplayWebhookEndpoint(ctx context.Context, endpointID uint, since *time.Time) (int, error) {
+	s := w.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	endpoint, ok := s.webhookEndpoints[endpointID]
+	if !ok {
+		return 0, fmt.Errorf("webhook endpoint %w", ErrNotFound)
+	}
+
+	replayed := 0
+	if since != nil {
+		for _, event := range s.outboxEvents {
+			if !event.CreatedAt.Before(*since) && subscribed(endpoint, event.Type) {
+				s.queueDelivery(event, endpointID)
+				replayed++
+			}
+		}
+		return replayed, nil
+	}
+
+	// Without a starting time only the dead deliveries are sent again
+	for _, delivery := range s.webhookDeliveries {
+		if delivery.EndpointID == endpointID && delivery.Status == DeliveryDead {
+			delivery.Status = DeliveryPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = time.Now()
+			delivery.LastStatusCode = nil
+			delivery.LastError = ""
+			replayed++
+		}
+	}
+	return replayed, nil
+}
+
+func (w *MemoryWebhookRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueWebhookDelivery, error) {
+	s := w.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var due []*WebhookDelivery
+	for _, delivery := range s.webhookDeliveries {
+		if delivery.Status == DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]DueWebhookDelivery, 0, len(due))
+	for _, delivery := range due {
+		delivery.Attempts++
+		delivery.NextAttemptAt = now.Add(lease)
+
+		endpoint := s.webhookEndpoints[delivery.EndpointID]
+		claimed = append(claimed, DueWebhookDelivery{
+			ID:       delivery.ID,
+			Attempts: delivery.Attempts,
+			URL:      endpoint.URL,
+			Secret:   endpoint.Secret,
+			Event:    *s.outboxEvents[delivery.EventID],
+		})
+	}
+	return claimed, nil
+}
+
+func (w *MemoryWebhookRepository) MarkWebhookDelivered(ctx context.Context, deliveryID uint, statusCode int) error {
+	s := w.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if delivery, ok := s.webhookDeliveries[deliveryID]; ok {
+		now := time.Now()
+		delivery.Status = DeliveryDelivered
+		delivery.LastStatusCode = &statusCode
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	}
+	return nil
+}
+
+func (w *MemoryWebhookRepository) MarkWebhookFailed(ctx context.Context, deliveryID uint, statusCode int, message string, retryAt *time.Time) error {
+	s := w.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.webhookDeliveries[deliveryID]
+	if !ok {
+		return nil
+	}
+
+	delivery.Status = DeliveryDead
+	if retryAt != nil {
+		delivery.Status = DeliveryPending
+		delivery.NextAttemptAt = *retryAt
+	}
+	delivery.LastStatusCode = nil
+	if statusCode != 0 {
+		delivery.LastStatusCode = &statusCode
+	}
+	delivery.LastError = message
+	return nil
+}
+
+// queueDelivery schedules the event for the endpoint, resetting an earlier
+// delivery of the same event. The caller must hold the lock.
+func (s *MemoryStore) queueDelivery(event *OutboxEvent, endpointID uint) {
+	now := time.Now()
+	for _, delivery := range s.webhookDeliveries {
+		if delivery.EventID == event.ID && delivery.EndpointID == endpointID {
+			delivery.Status = DeliveryPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = now
+			delivery.LastStatusCode = nil
+			delivery.LastError = ""
+			delivery.DeliveredAt = nil
+			return
+		}
+	}
+
+	s.nextWebhookDeliveryID++
+	s.webhookDeliveries[s.nextWebhookDeliveryID] = &WebhookDelivery{
+		ID:            s.nextWebhookDeliveryID,
+		EventID:       event.ID,
+		EventType:     event.Type,
+		EndpointID:    endpointID,
+		Status:        DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
+
+// subscribed reports whether the endpoint receives events of eventType
+func subscribed(endpoint *WebhookEndpoint, eventType string) bool {
+	if len(endpoint.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range endpoint.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryDigestRepository stores digest preferences in a MemoryStore
+type MemoryDigestRepository struct {
+	store *MemoryStore
+}
+
+func (d *MemoryDigestRepository) GetDigestPreference(ctx context.Context, userID string) (*DigestPreference, error) {
+	s := d.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	preference := DigestPreference{Frequency: DefaultDigestFrequency}
+	if stored, ok := s.digestPreferences[userID]; ok {
+		preference.Frequency = stored.frequency
+	}
+	return &preference, nil
+}
+
+func (d *MemoryDigestRepository) UpdateDigestPreference(ctx context.Context, userID string, frequency string) error {
+	s := d.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+
+	s.digestPreference(userID).frequency = frequency
+	return nil
+}
+
+func (d *MemoryDigestRepository) UnsubscribeDigest(ctx context.Context, token string) error {
+	s := d.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, preference := range s.digestPreferences {
+		if preference.unsubscribeToken == token {
+			preference.frequency = DigestOff
+			return nil
+		}
+	}
+	return fmt.Errorf("unsubscribe token %w", ErrNotFound)
+}
+
+func (d *MemoryDigestRepository) ClaimDigestRecipients(ctx context.Context, limit int) ([]DigestRecipient, error) {
+	s := d.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type candidate struct {
+		user       User
+		lastSentAt *time.Time
+	}
+
+	now := time.Now()
+	var due []candidate
+	for _, user := range s.users {
+		frequency, lastSentAt := DefaultDigestFrequency, (*time.Time)(nil)
+		if preference, ok := s.digestPreferences[user.ID]; ok {
+			frequency, lastSentAt = preference.frequency, preference.lastSentAt
+		}
+		if frequency == DigestOff || (lastSentAt != nil && lastSentAt.After(now.Add(-DigestPeriod(frequency)))) {
+			continue
+		}
+		due = append(due, candidate{user: user, lastSentAt: lastSentAt})
+	}
+
+	// Never sent first, then the longest waiting, like the PostgreSQL repository
+	sort.Slice(due, func(i, j int) bool {
+		a, b := due[i].lastSentAt, due[j].lastSentAt
+		if (a == nil) != (b == nil) {
+			return a == nil
+		}
+		if a != nil && !a.Equal(*b) {
+			return a.Before(*b)
+		}
+		return due[i].user.ID < due[j].user.ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	recipients := make([]DigestRecipient, 0, len(due))
+	for _, candidate := range due {
+		preference := s.digestPreference(candidate.user.ID)
+		sentAt := now
+		preference.lastSentAt = &sentAt
+
+		recipients = append(recipients, DigestRecipient{
+			UserID:           candidate.user.ID,
+			Email:            candidate.user.Email,
+			Username:         candidate.user.Username,
+			Frequency:        preference.frequency,
+			UnsubscribeToken: preference.unsubscribeToken,
+		})
+	}
+	sort.Slice(recipients, func(i, j int) bool {
+		return recipients[i].UserID < recipients[j].UserID
+	})
+	return recipients, nil
+}
+
+func (d *MemoryDigestRepository) GetDigest(ctx context.Context, userID string, query DigestQuery) (*Digest, error) {
+	s := d.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	digest := Digest{Replies: []DigestReply{}, TopPosts: []DigestPost{}}
+
+	// Comments by others on the user's posts and replies to their comments,
+	// as far as the query asks for them
+	for _, comment := range s.comments {
+		post := s.posts[comment.PostID]
+		if comment.UserID == userID || comment.Status != StatusPublished || post.Status != StatusPublished ||
+			comment.CreatedAt.Before(query.Since) {
+			continue
+		}
+		parent, isReply := s.comments[memoryCommentID(comment.ParentID)]
+		if !(query.Comments && post.UserID == userID) && !(query.Replies && isReply && parent.UserID == userID) {
+			continue
+		}
+
+		digest.ReplyCount++
+		digest.Replies = append(digest.Replies, DigestReply{
+			CommentID: comment.ID,
+			PostID:    post.ID,
+			PostTitle: post.Title,
+			Author:    s.users[comment.UserID].Username,
+			Content:   comment.Content,
+			CreatedAt: comment.CreatedAt,
+		})
+	}
+	sort.Slice(digest.Replies, func(i, j int) bool {
+		a, b := digest.Replies[i], digest.Replies[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.CommentID > b.CommentID
+	})
+	if len(digest.Replies) > query.Limit {
+		digest.Replies = digest.Replies[:query.Limit]
+	}
+
+	// The most liked and discussed posts of users sharing the recipient's
+	// country or major
+	recipient := s.users[userID]
+	for _, post := range s.posts {
+		author := s.users[post.UserID]
+		if post.UserID == userID || post.Status != StatusPublished || post.CreatedAt.Before(query.Since) ||
+			!(sameValue(author.Country, recipient.Country) || sameValue(author.Major, recipient.Major)) {
+			continue
+		}
+
+		digest.TopPosts = append(digest.TopPosts, DigestPost{
+			PostID:       post.ID,
+			Title:        post.Title,
+			Author:       author.Username,
+			LikeCount:    s.likeCount(post.ID),
+			CommentCount: len(s.publishedComments(post.ID)),
+		})
+	}
+	sort.Slice(digest.TopPosts, func(i, j int) bool {
+		a, b := digest.TopPosts[i], digest.TopPosts[j]
+		if a.LikeCount+a.CommentCount != b.LikeCount+b.CommentCount {
+			return a.LikeCount+a.CommentCount > b.LikeCount+b.CommentCount
+		}
+		return a.PostID > b.PostID
+	})
+	if len(digest.TopPosts) > query.Limit {
+		digest.TopPosts = digest.TopPosts[:query.Limit]
+	}
+
+	return &digest, nil
+}
+
+// digestPreference returns the stored preference of a user, creating the
+// default one. The caller must hold the lock.
+func (s *MemoryStore) digestPreference(userID string) *memoryDigestPreference {
+	preference, ok := s.digestPreferences[userID]
+	if !ok {
+		token := make([]byte, 16)
+		_, _ = rand.Read(token)
+		preference = &memoryDigestPreference{
+			frequency:        DefaultDigestFrequency,
+			unsubscribeToken: hex.EncodeToString(token),
+		}
+		s.digestPreferences[userID] = preference
+	}
+	return preference
+}
+
+// sameValue reports whether two nullable columns are equal, NULL matching
+// nothing like in SQL
+func sameValue(a, b *string) bool {
+	return a != nil && b != nil && *a == *b
+}
@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+// Mention is a reference to a user in the content of a post or comment.
+// Offset and Length count Unicode code points and include the @.
+type Mention struct {
+	PostID    uint   `json:"-" db:"post_id"`           // Post the content belongs to
+	CommentID *uint  `json:"-" db:"comment_id"`        // NULL for mentions in the post itself
+	UserID    string `json:"user_id" db:"user_id"`     // Mentioned user
+	Username  string `json:"username" db:"username"`   // Display name of the mentioned user
+	Offset    int    `json:"offset" db:"start_offset"` // Position of the @ in the content
+	Length    int    `json:"length" db:"length"`       // Length of the mention in the content
+}
+
+// MentionRepository stores mentions in PostgreSQL
+type MentionRepository struct {
+	db sqlx.ExtContext
+}
+
+func (m *MentionRepository) ReplaceMentions(ctx context.Context, postID uint, commentID uint, mentions []Mention) ([]string, error) {
+	defer observe(ctx, "mention", "ReplaceMentions")()
+
+	// Comment 0 stands for the post itself
+	deleteQuery := `
+        DELETE FROM mentions
+        WHERE post_id = $1 AND comment_id IS NOT DISTINCT FROM NULLIF($2, 0)
+        RETURNING user_id;
+    `
+
+	var deleted []string
+	err := sqlx.SelectContext(ctx, m.db, &deleted, deleteQuery, postID, commentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete mentions: %w", err)
+	}
+
+	insertQuery := `
+        INSERT INTO mentions (post_id, comment_id, user_id, start_offset, length)
+        VALUES ($1, NULLIF($2, 0), $3, $4, $5);
+    `
+	for _, mention := range mentions {
+		_, err := m.db.ExecContext(ctx, insertQuery, postID, commentID, mention.UserID, mention.Offset, mention.Length)
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				return nil, fmt.Errorf("post, comment or user %w", ErrNotFound)
+			}
+			return nil, fmt.Errorf("failed to create mention: %w", err)
+		}
+	}
+
+	return distinct(deleted), nil
+}
+
+// postMentions loads the mentions in the content of the given posts, by post
+func postMentions(ctx context.Context, db sqlx.ExtContext, postIDs []uint) (map[uint][]Mention, error) {
+	byPost := make(map[uint][]Mention)
+	if len(postIDs) == 0 {
+		return byPost, nil
+	}
+
+	query, args, err := sqlx.In(`
+        SELECT mentions.post_id, mentions.comment_id, mentions.user_id, users.username, mentions.start_offset, mentions.length
+        FROM mentions
+                 JOIN users ON users.id = mentions.user_id
+        WHERE mentions.post_id IN (?) AND mentions.comment_id IS NULL
+        ORDER BY mentions.start_offset;
+    `, postIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build mentions query: %w", err)
+	}
+
+	var mentions []Mention
+	err = sqlx.SelectContext(ctx, db, &mentions, db.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch mentions: %w", err)
+	}
+
+	for _, mention := range mentions {
+		byPost[mention.PostID] = append(byPost[mention.PostID], mention)
+	}
+	return byPost, nil
+}
+
+// commentMentions loads the mentions in the content of the given comments, by comment
+func commentMentions(ctx context.Context, db sqlx.ExtContext, commentIDs []uint) (map[uint][]Mention, error) {
+	byComment := make(map[uint][]Mention)
+	if len(commentIDs) == 0 {
+		return byComment, nil
+	}
+
+	query, args, err := sqlx.In(`
+        SELECT mentions.post_id, mentions.comment_id, mentions.user_id, users.username, mentions.start_offset, mentions.length
+        FROM mentions
+                 JOIN users ON users.id = mentions.user_id
+        WHERE mentions.comment_id IN (?)
+        ORDER BY mentions.start_offset;
+    `, commentIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build mentions query: %w", err)
+	}
+
+	var mentions []Mention
+	err = sqlx.SelectContext(ctx, db, &mentions, db.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch mentions: %w", err)
+	}
+
+	for _, mention := range mentions {
+		byComment[*mention.CommentID] = append(byComment[*mention.CommentID], mention)
+	}
+	return byComment, nil
+}
+
+// orNoMentions makes responses list mentions as [] rather than null
+func orNoMentions(mentions []Mention) []Mention {
+	if mentions == nil {
+		return []Mention{}
+	}
+	return mentions
+}
+
+// distinct returns values without duplicates, in order of first appearance
+func distinct(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
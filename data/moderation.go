@@ -0,0 +1,156 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ModerationRepository reviews pending content in PostgreSQL
+type ModerationRepository struct {
+	db sqlx.ExtContext
+}
+
+// PendingContent is a post or comment waiting for a moderator
+type PendingContent struct {
+	ContentType string    `json:"content_type" db:"content_type"` // "post" or "comment"
+	ID          uint      `json:"id" db:"id"`
+	PostID      uint      `json:"post_id" db:"post_id"`     // The post itself for posts
+	ParentID    *uint     `json:"parent_id" db:"parent_id"` // Comment a reply answers
+	UserID      string    `json:"user_id" db:"user_id"`
+	Title       string    `json:"title,omitempty" db:"title"` // Empty for comments
+	Content     string    `json:"content" db:"content"`
+	SpamScore   *int      `json:"spam_score" db:"spam_score"`     // Empty when held by the content filter
+	SpamReasons *string   `json:"spam_reasons" db:"spam_reasons"` // Of the latest score
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+type PendingContentQuery struct {
+	ContentType string `json:"content_type"` // Empty for both
+	Limit       int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset      int    `json:"offset" validate:"gte=0"`
+}
+
+func (pq *PendingContentQuery) Parse(c echo.Context) error {
+	qs := c.QueryParams()
+
+	pq.ContentType = qs.Get("content_type")
+	switch pq.ContentType {
+	case "", ContentTypePost, ContentTypeComment:
+	default:
+		return fmt.Errorf("unknown content type %q", pq.ContentType)
+	}
+
+	pq.Limit = 50
+	if limit, err := strconv.Atoi(qs.Get("limit")); err == nil && limit >= 1 && limit <= 100 {
+		pq.Limit = limit
+	}
+
+	pq.Offset = 0
+	if offset, err := strconv.Atoi(qs.Get("offset")); err == nil && offset >= 0 {
+		pq.Offset = offset
+	}
+
+	return nil
+}
+
+func (m *ModerationRepository) GetPendingContent(ctx context.Context, query PendingContentQuery) ([]PendingContent, error) {
+	defer observe(ctx, "moderation", "GetPendingContent")()
+
+	// Oldest first, each with its latest spam score
+	selectQuery := `
+        SELECT pending.*, latest.score AS spam_score, latest.reasons AS spam_reasons
+        FROM (
+            SELECT 'post' AS content_type, id, id AS post_id, NULL::INT AS parent_id, user_id, title, content, created_at
+            FROM posts
+            WHERE status = 'pending'
+            UNION ALL
+            SELECT 'comment', id, post_id, parent_id, user_id, '', content, created_at
+            FROM comments
+            WHERE status = 'pending'
+        ) pending
+        LEFT JOIN LATERAL (
+            SELECT score, reasons
+            FROM spam_scores
+            WHERE spam_scores.content_type = pending.content_type
+              AND spam_scores.content_id = pending.id
+            ORDER BY spam_scores.id DESC
+            LIMIT 1
+        ) latest ON TRUE
+        WHERE $1 = '' OR pending.content_type = $1
+        ORDER BY pending.created_at, pending.content_type, pending.id
+        LIMIT $2 OFFSET $3;
+    `
+	contents := []PendingContent{}
+	err := sqlx.SelectContext(ctx, m.db, &contents, selectQuery, query.ContentType, query.Limit, query.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pending content: %w", err)
+	}
+
+	return contents, nil
+}
+
+func (m *ModerationRepository) ModeratePost(ctx context.Context, postID uint, status string) (*Post, error) {
+	defer observe(ctx, "moderation", "ModeratePost")()
+
+	query := `
+        UPDATE posts
+        SET status = $2, updated_at = NOW()
+        WHERE id = $1 AND status = 'pending'
+        RETURNING id, user_id, title, content, views, status, created_at, updated_at;
+    `
+	post := new(Post)
+	err := sqlx.GetContext(ctx, m.db, post, query, postID, status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, m.notPending(ctx, "posts", postID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate post: %w", err)
+	}
+
+	return post, nil
+}
+
+func (m *ModerationRepository) ModerateComment(ctx context.Context, commentID uint, status string) (*Comment, error) {
+	defer observe(ctx, "moderation", "ModerateComment")()
+
+	// Updating the status runs the comment_count trigger of the post
+	query := `
+        UPDATE comments
+        SET status = $2, updated_at = NOW()
+        WHERE id = $1 AND status = 'pending'
+        RETURNING id, post_id, user_id, parent_id, content, status, created_at;
+    `
+	comment := new(Comment)
+	err := sqlx.GetContext(ctx, m.db, comment, query, commentID, status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, m.notPending(ctx, "comments", commentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate comment: %w", err)
+	}
+
+	return comment, nil
+}
+
+// notPending tells why content of table couldn't be moderated: it is missing,
+// or a moderator already decided on it
+func (m *ModerationRepository) notPending(ctx context.Context, table string, id uint) error {
+	name := strings.TrimSuffix(table, "s")
+
+	var status string
+	err := sqlx.GetContext(ctx, m.db, &status, fmt.Sprintf(`SELECT status FROM %s WHERE id = $1;`, table), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s %w", name, ErrNotFound)
+		}
+		return fmt.Errorf("failed to check %s status: %w", name, err)
+	}
+	return fmt.Errorf("%w: %s is %s, not pending", ErrConflict, name, status)
+}
@@ -0,0 +1,243 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/xeonx/timeago"
+	"strconv"
+	"time"
+)
+
+// Notification types
+const (
+	NotificationComment = "comment" // Someone commented on your post
+	NotificationReply   = "reply"   // Someone replied to your comment
+	NotificationLike    = "like"    // Someone liked your post
+	NotificationMention = "mention" // Someone mentioned you
+)
+
+type Notification struct {
+	ID            uint       `json:"id" db:"id"`                           // Primary key
+	UserID        string     `json:"user_id" db:"user_id"`                 // Recipient
+	Type          string     `json:"type" db:"type"`                       // One of the Notification* types
+	PostID        uint       `json:"post_id" db:"post_id"`                 // Post the activity happened on
+	CommentID     *uint      `json:"comment_id" db:"comment_id"`           // Latest comment involved, if any
+	GroupKey      string     `json:"group_key" db:"group_key"`             // Unread notifications sharing a key are aggregated
+	LatestActorID string     `json:"latest_actor_id" db:"latest_actor_id"` // User who acted last
+	ActorCount    int        `json:"actor_count" db:"actor_count"`         // Distinct users who acted
+	ReadAt        *time.Time `json:"read_at" db:"read_at"`                 // NULL while unread
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`           // Timestamp for record creation
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`           // Timestamp for latest activity
+}
+
+// NewNotification describes one user acting on something another user owns
+type NewNotification struct {
+	UserID    string // Recipient
+	Type      string
+	PostID    uint
+	CommentID uint // 0 when the activity isn't about a comment
+	GroupKey  string
+	ActorID   string
+}
+
+type NotificationResponse struct {
+	ID         uint      `json:"id" db:"id"`
+	Type       string    `json:"type" db:"type"`
+	PostID     uint      `json:"post_id" db:"post_id"`
+	PostTitle  string    `json:"post_title" db:"post_title"`
+	CommentID  *uint     `json:"comment_id" db:"comment_id"`
+	ActorID    string    `json:"actor_id" db:"actor_id"`
+	ActorName  string    `json:"actor_name" db:"actor_name"`
+	ActorCount int       `json:"actor_count" db:"actor_count"`
+	Message    string    `json:"message" db:"-"`
+	Read       bool      `json:"read" db:"read"`
+	CreatedAt  string    `json:"created_at" db:"-"`
+	UpdatedAt  time.Time `json:"-" db:"updated_at"`
+}
+
+type NotificationQuery struct {
+	Limit  int  `json:"limit" validate:"gte=1,lte=50"`
+	Offset int  `json:"offset" validate:"gte=0"`
+	Unread bool `json:"unread"`
+}
+
+func (nq *NotificationQuery) Parse(c echo.Context) error {
+	qs := c.QueryParams()
+
+	nq.Limit = 20
+	if limit, err := strconv.Atoi(qs.Get("limit")); err == nil && limit >= 1 && limit <= 50 {
+		nq.Limit = limit
+	}
+
+	nq.Offset = 0
+	if offset, err := strconv.Atoi(qs.Get("offset")); err == nil && offset >= 0 {
+		nq.Offset = offset
+	}
+
+	nq.Unread, _ = strconv.ParseBool(qs.Get("unread"))
+
+	return nil
+}
+
+// finish fills in the fields derived from the stored ones
+func (n *NotificationResponse) finish() {
+	n.Message = notificationMessage(n)
+	n.CreatedAt = timeago.English.Format(n.UpdatedAt)
+}
+
+// notificationMessage renders a notification, e.g.
+// `Jane and 4 others liked your post "Title"`
+func notificationMessage(n *NotificationResponse) string {
+	actors := n.ActorName
+	switch {
+	case n.ActorCount == 2:
+		actors += " and 1 other"
+	case n.ActorCount > 2:
+		actors += fmt.Sprintf(" and %d others", n.ActorCount-1)
+	}
+
+	switch n.Type {
+	case NotificationLike:
+		return fmt.Sprintf("%s liked your post %q", actors, n.PostTitle)
+	case NotificationComment:
+		return fmt.Sprintf("%s commented on your post %q", actors, n.PostTitle)
+	case NotificationReply:
+		return fmt.Sprintf("%s replied to your comment on %q", actors, n.PostTitle)
+	case NotificationMention:
+		if n.CommentID != nil {
+			return fmt.Sprintf("%s mentioned you in a comment on %q", actors, n.PostTitle)
+		}
+		return fmt.Sprintf("%s mentioned you in %q", actors, n.PostTitle)
+	}
+	return actors
+}
+
+// NotificationRepository stores notifications in PostgreSQL
+type NotificationRepository struct {
+	db sqlx.ExtContext
+}
+
+func (n *NotificationRepository) CreateNotification(ctx context.Context, notification *NewNotification) error {
+	defer observe(ctx, "notification", "CreateNotification")()
+
+	// Add the actor to the unread notification of the same group, or start a
+	// new one. The actor is counted once however often they act.
+	query := `
+        WITH notification AS (
+            INSERT INTO notifications (user_id, type, post_id, comment_id, group_key, latest_actor_id, actor_count, created_at, updated_at)
+            VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, 1, NOW(), NOW())
+            ON CONFLICT (user_id, group_key) WHERE read_at IS NULL
+            DO UPDATE SET latest_actor_id = EXCLUDED.latest_actor_id,
+                          comment_id      = COALESCE(EXCLUDED.comment_id, notifications.comment_id),
+                          actor_count     = notifications.actor_count +
+                                            CASE
+                                                WHEN EXISTS (SELECT 1
+                                                             FROM notification_actors
+                                                             WHERE notification_id = notifications.id
+                                                               AND actor_id = EXCLUDED.latest_actor_id) THEN 0
+                                                ELSE 1 END,
+                          updated_at      = NOW()
+            RETURNING id
+        )
+        INSERT INTO notification_actors (notification_id, actor_id, created_at)
+        SELECT id, $6, NOW() FROM notification
+        ON CONFLICT DO NOTHING;
+    `
+
+	_, err := n.db.ExecContext(ctx, query,
+		notification.UserID, notification.Type, notification.PostID, notification.CommentID,
+		notification.GroupKey, notification.ActorID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("post or user %w", ErrNotFound)
+		}
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	return nil
+}
+
+func (n *NotificationRepository) GetNotifications(ctx context.Context, userID string, query NotificationQuery) ([]NotificationResponse, error) {
+	defer observe(ctx, "notification", "GetNotifications")()
+
+	selectQuery := `
+        SELECT notifications.id,
+               notifications.type,
+               notifications.post_id,
+               posts.title                       AS post_title,
+               notifications.comment_id,
+               notifications.latest_actor_id     AS actor_id,
+               users.username                    AS actor_name,
+               notifications.actor_count,
+               notifications.read_at IS NOT NULL AS read,
+               notifications.updated_at
+        FROM notifications
+                 JOIN posts ON posts.id = notifications.post_id
+                 JOIN users ON users.id = notifications.latest_actor_id
+        WHERE notifications.user_id = $1
+          AND ($2::BOOLEAN IS FALSE OR notifications.read_at IS NULL)
+        ORDER BY notifications.updated_at DESC, notifications.id DESC
+        LIMIT $3 OFFSET $4;
+    `
+
+	notifications := []NotificationResponse{}
+	err := sqlx.SelectContext(ctx, n.db, &notifications, selectQuery, userID, query.Unread, query.Limit, query.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch notifications: %w", err)
+	}
+
+	for i := range notifications {
+		notifications[i].finish()
+	}
+	return notifications, nil
+}
+
+func (n *NotificationRepository) CountUnreadNotifications(ctx context.Context, userID string) (int, error) {
+	defer observe(ctx, "notification", "CountUnreadNotifications")()
+
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL;`
+
+	var count int
+	err := sqlx.GetContext(ctx, n.db, &count, query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+func (n *NotificationRepository) MarkNotificationRead(ctx context.Context, userID string, notificationID uint) error {
+	defer observe(ctx, "notification", "MarkNotificationRead")()
+
+	query := `
+        UPDATE notifications
+        SET read_at = COALESCE(read_at, NOW())
+        WHERE id = $1 AND user_id = $2;
+    `
+
+	result, err := n.db.ExecContext(ctx, query, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+
+	// Other users' notifications are reported as missing, not forbidden
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("notification %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (n *NotificationRepository) MarkAllNotificationsRead(ctx context.Context, userID string) (int, error) {
+	defer observe(ctx, "notification", "MarkAllNotificationsRead")()
+
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL;`
+
+	result, err := n.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return int(rowsAffected), nil
+}
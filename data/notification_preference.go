@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+// NotificationFollow is reserved for following users, which the service
+// doesn't offer yet. Users can already choose how they want to hear about it.
+const NotificationFollow = "follow"
+
+// NotificationTypes lists the types users set preferences for
+var NotificationTypes = []string{
+	NotificationComment, NotificationReply, NotificationLike, NotificationMention, NotificationFollow,
+}
+
+// Notification channels
+const (
+	ChannelInApp = "in_app" // GET /me/notifications
+	ChannelEmail = "email"  // The email digest
+	ChannelPush  = "push"   // Push notifications, not sent yet
+)
+
+// ChannelPreferences tells on which channels a user gets one notification type
+type ChannelPreferences struct {
+	InApp bool `json:"in_app" db:"in_app"`
+	Email bool `json:"email" db:"email"`
+	Push  bool `json:"push" db:"push"`
+}
+
+// Set turns a channel on or off and reports whether the channel exists
+func (cp *ChannelPreferences) Set(channel string, enabled bool) bool {
+	switch channel {
+	case ChannelInApp:
+		cp.InApp = enabled
+	case ChannelEmail:
+		cp.Email = enabled
+	case ChannelPush:
+		cp.Push = enabled
+	default:
+		return false
+	}
+	return true
+}
+
+// NotificationPreferences maps every notification type to its channels
+type NotificationPreferences map[string]ChannelPreferences
+
+// DefaultNotificationPreferences applies to the types a user never changed.
+// Everything shows in the app, likes aren't emailed or pushed and follows
+// aren't emailed.
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{
+		NotificationComment: {InApp: true, Email: true, Push: true},
+		NotificationReply:   {InApp: true, Email: true, Push: true},
+		NotificationLike:    {InApp: true, Email: false, Push: false},
+		NotificationMention: {InApp: true, Email: true, Push: true},
+		NotificationFollow:  {InApp: true, Email: false, Push: true},
+	}
+}
+
+// Enabled reports whether the user gets notificationType on channel
+func (np NotificationPreferences) Enabled(notificationType string, channel string) bool {
+	preferences, ok := np[notificationType]
+	if !ok {
+		preferences = DefaultNotificationPreferences()[notificationType]
+	}
+
+	switch channel {
+	case ChannelInApp:
+		return preferences.InApp
+	case ChannelEmail:
+		return preferences.Email
+	case ChannelPush:
+		return preferences.Push
+	}
+	return false
+}
+
+// notificationPreferenceRow is a changed notification type as stored
+type notificationPreferenceRow struct {
+	Type string `db:"type"`
+	ChannelPreferences
+}
+
+func (n *NotificationRepository) GetNotificationPreferences(ctx context.Context, userID string) (NotificationPreferences, error) {
+	defer observe(ctx, "notification", "GetNotificationPreferences")()
+
+	query := `
+        SELECT type, in_app, email, push
+        FROM notification_preferences
+        WHERE user_id = $1;
+    `
+
+	var rows []notificationPreferenceRow
+	if err := sqlx.SelectContext(ctx, n.db, &rows, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to fetch notification preferences: %w", err)
+	}
+
+	preferences := DefaultNotificationPreferences()
+	for _, row := range rows {
+		preferences[row.Type] = row.ChannelPreferences
+	}
+	return preferences, nil
+}
+
+func (n *NotificationRepository) UpdateNotificationPreferences(ctx context.Context, userID string, preferences NotificationPreferences) error {
+	defer observe(ctx, "notification", "UpdateNotificationPreferences")()
+
+	query := `
+        INSERT INTO notification_preferences (user_id, type, in_app, email, push, updated_at)
+        VALUES ($1, $2, $3, $4, $5, NOW())
+        ON CONFLICT (user_id, type) DO UPDATE SET in_app     = EXCLUDED.in_app,
+                                                  email      = EXCLUDED.email,
+                                                  push       = EXCLUDED.push,
+                                                  updated_at = NOW();
+    `
+
+	for notificationType, channels := range preferences {
+		_, err := n.db.ExecContext(ctx, query, userID, notificationType, channels.InApp, channels.Email, channels.Push)
+		if isForeignKeyViolation(err) {
+			return fmt.Errorf("user %w", ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update notification preferences: %w", err)
+		}
+	}
+	return nil
+}
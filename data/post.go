@@ -2,9 +2,13 @@ package data
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/Ahmad-mufied/iducate-community-service/utils"
+	"github.com/jmoiron/sqlx"
 	"github.com/xeonx/timeago"
+	"sort"
 	"time"
 )
 
@@ -14,19 +18,21 @@ type Post struct {
 	Title     string    `json:"title" db:"title"`           // Post title
 	Content   string    `json:"content" db:"content"`       // Post content
 	Views     int       `json:"views" db:"views"`           // Number of views
+	Status    string    `json:"status" db:"status"`         // Moderation status
 	CreatedAt time.Time `json:"created_at" db:"created_at"` // Timestamp for record creation
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"` // Timestamp for last update
 }
 
 type PostResponse struct {
-	ID           uint   `db:"id" json:"id"`
-	Title        string `db:"title" json:"title"`
-	Content      string `db:"content" json:"content"`
-	Views        int    `db:"views" json:"views"`
-	Author       string `db:"author" json:"author"`
-	LikeCount    int    `db:"like_count" json:"like_count"`
-	CommentCount int    `db:"comment_count" json:"comment_count"`
-	CreatedAt    string `db:"created_at" json:"created_at"`
+	ID           uint      `db:"id" json:"id"`
+	Title        string    `db:"title" json:"title"`
+	Content      string    `db:"content" json:"content"`
+	Views        int       `db:"views" json:"views"`
+	Author       string    `db:"author" json:"author"`
+	LikeCount    int       `db:"like_count" json:"like_count"`
+	CommentCount int       `db:"comment_count" json:"comment_count"`
+	CreatedAt    string    `db:"created_at" json:"created_at"`
+	Mentions     []Mention `db:"-" json:"mentions"`
 }
 
 type PostAndCommentResponse struct {
@@ -38,25 +44,46 @@ type PostAndCommentResponse struct {
 	LikeCount    int                `db:"like_count" json:"like_count"`
 	CommentCount int                `db:"comment_count" json:"comment_count"`
 	CreatedAt    string             `db:"created_at" json:"created_at"`
+	Mentions     []Mention          `db:"-" json:"mentions"`
 	Comments     []*CommentResponse `json:"comments"`
 }
 
 type CreatePostRequest struct {
 	UserID  string `json:"user_id" validate:"required"`
-	Title   string `json:"title" validate:"required,max=255"`
-	Content string `json:"content" validate:"required"`
+	Title   string `json:"title" validate:"required,max=255,clean"`
+	Content string `json:"content" validate:"required,clean"`
+	Status  string `json:"-"` // Set by the handler, defaults to published
 }
 
-func (p *Post) CreatePost(ctx context.Context, req *CreatePostRequest) (PostResponse, error) {
+// PostRepository stores posts in PostgreSQL
+type PostRepository struct {
+	db sqlx.ExtContext
+}
+
+func (p *PostRepository) CreatePost(ctx context.Context, req *CreatePostRequest) (PostResponse, error) {
+	defer observe(ctx, "post", "CreatePost")()
+
 	query := `
-        INSERT INTO posts (user_id, title, content, created_at, updated_at)
-        VALUES ($1, $2, $3, NOW(), NOW())
-        RETURNING id, user_id, title, content, views, created_at, updated_at;
+        INSERT INTO posts (user_id, title, content, status, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, NOW(), NOW())
+        RETURNING id, user_id, title, content, views, status, created_at, updated_at,
+            (SELECT username FROM users WHERE id = $1) AS author;
     `
 
-	var post Post
-	err := db.GetContext(ctx, &post, query, req.UserID, req.Title, req.Content)
+	status := req.Status
+	if status == "" {
+		status = StatusPublished
+	}
+
+	var post struct {
+		Post
+		Author string `db:"author"`
+	}
+	err := sqlx.GetContext(ctx, p.db, &post, query, req.UserID, req.Title, req.Content, status)
 	if err != nil {
+		if isForeignKeyViolation(err) {
+			return PostResponse{}, fmt.Errorf("user %w", ErrNotFound)
+		}
 		return PostResponse{}, fmt.Errorf("failed to create post: %w", err)
 	}
 
@@ -69,26 +96,29 @@ func (p *Post) CreatePost(ctx context.Context, req *CreatePostRequest) (PostResp
 	postResponse.Title = post.Title
 	postResponse.Content = post.Content
 	postResponse.Views = post.Views
-	postResponse.Author = post.UserID
+	postResponse.Author = post.Author
 	postResponse.CreatedAt = timestring
+	postResponse.Mentions = []Mention{}
 
 	return postResponse, nil
 }
 
-func (p *Post) GetPaginatedPosts(query PaginatedFeedQuery) ([]PostResponse, error) {
+func (p *PostRepository) GetPaginatedPosts(ctx context.Context, query PaginatedFeedQuery) ([]PostResponse, error) {
+	defer observe(ctx, "post", "GetPaginatedPosts")()
+
 	// Dynamically construct the ORDER BY clause
 	orderBy := ""
 	switch query.SortType {
 	case "trend":
-		orderBy = fmt.Sprintf("COUNT(DISTINCT likes.id) %s", query.Sort)
+		orderBy = fmt.Sprintf("posts.like_count %[1]s, posts.id %[1]s", query.Sort)
 	case "latest":
-		orderBy = fmt.Sprintf("MAX(posts.created_at) %s", query.Sort)
+		orderBy = fmt.Sprintf("posts.created_at %[1]s, posts.id %[1]s", query.Sort)
 	default:
 		// This should never happen because `query.SortType` is already validated
 		return nil, fmt.Errorf("unexpected sortType: %s", query.SortType)
 	}
 
-	// Construct the SQL query
+	// Construct the SQL query, the counters are kept up to date by triggers
 	sqlQuery := fmt.Sprintf(`
         SELECT 
             posts.id,
@@ -96,21 +126,19 @@ func (p *Post) GetPaginatedPosts(query PaginatedFeedQuery) ([]PostResponse, erro
             posts.content,
             posts.views,
             users.username AS author,
-            COUNT(DISTINCT likes.id) AS like_count,
-            COUNT(DISTINCT comments.id) AS comment_count,
+            posts.like_count,
+            posts.comment_count,
             posts.created_at
         FROM posts
-        LEFT JOIN likes ON likes.post_id = posts.id
-        LEFT JOIN comments ON comments.post_id = posts.id
         JOIN users ON posts.user_id = users.id
-        GROUP BY posts.id, users.username, posts.created_at
+        WHERE posts.status = 'published'
         ORDER BY %s
         LIMIT $1 OFFSET $2;
     `, orderBy)
 
 	// Execute the query
 	var posts []PostResponse
-	err := db.Select(&posts, sqlQuery, query.Limit, query.Offset)
+	err := sqlx.SelectContext(ctx, p.db, &posts, sqlQuery, query.Limit, query.Offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch posts: %w", err)
 	}
@@ -122,10 +150,25 @@ func (p *Post) GetPaginatedPosts(query PaginatedFeedQuery) ([]PostResponse, erro
 		posts[i].CreatedAt = timeago.English.Format(timestring)
 	}
 
+	// Attach the mentions of the page in one query
+	postIDs := make([]uint, len(posts))
+	for i := range posts {
+		postIDs[i] = posts[i].ID
+	}
+	mentions, err := postMentions(ctx, p.db, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].Mentions = orNoMentions(mentions[posts[i].ID])
+	}
+
 	return posts, nil
 }
 
-func (p *Post) GetPostDetailWithComments(ctx context.Context, postID uint) (*PostResponse, []*CommentResponse, error) {
+func (p *PostRepository) GetPostDetailWithComments(ctx context.Context, postID uint) (*PostResponse, []*CommentResponse, error) {
+	defer observe(ctx, "post", "GetPostDetailWithComments")()
+
 	query1 := `
         SELECT
     posts.id,
@@ -133,20 +176,21 @@ func (p *Post) GetPostDetailWithComments(ctx context.Context, postID uint) (*Pos
     posts.content,
     posts.views,
     users.username AS author,
-    COUNT(DISTINCT likes.id) AS like_count,
-    COUNT(DISTINCT comments.id) AS comment_count,
+    posts.like_count,
+    posts.comment_count,
     posts.created_at
 FROM posts
-         LEFT JOIN likes ON likes.post_id = posts.id
-         LEFT JOIN comments ON comments.post_id = posts.id
          JOIN users ON posts.user_id = users.id
-WHERE posts.id = $1
-GROUP BY posts.id, users.username, posts.created_at;
+WHERE posts.id = $1 AND posts.status = 'published';
     `
 
 	postDetail := new(PostResponse)
-	err := db.GetContext(ctx, postDetail, query1, postID)
+	err := sqlx.GetContext(ctx, p.db, postDetail, query1, postID)
 	if err != nil {
+		// Posts held for moderation are hidden like missing ones
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, fmt.Errorf("post %w", ErrNotFound)
+		}
 		return nil, nil, fmt.Errorf("failed to fetch post details: %w", err)
 	}
 
@@ -156,14 +200,15 @@ GROUP BY posts.id, users.username, posts.created_at;
 	postDetail.CreatedAt = timeago.English.Format(timestring)
 
 	query2 := `
-SELECT comments.id, users.username, comments.content, comments.created_at
+SELECT comments.id, comments.parent_id, users.username, comments.content, comments.created_at
 FROM comments
     JOIN posts ON comments.post_id = posts.id
     JOIN users ON comments.user_id = users.id
-         WHERE posts.id = $1;`
+         WHERE posts.id = $1 AND comments.status = 'published'
+ORDER BY comments.created_at, comments.id;`
 
 	var comments []*CommentResponse
-	err = db.SelectContext(ctx, &comments, query2, postID)
+	err = sqlx.SelectContext(ctx, p.db, &comments, query2, postID)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to fetch comments: %w", err)
 	}
@@ -175,13 +220,33 @@ FROM comments
 		comments[i].CreatedAt = timeago.English.Format(timestring)
 	}
 
+	postMentionsByID, err := postMentions(ctx, p.db, []uint{postID})
+	if err != nil {
+		return nil, nil, err
+	}
+	postDetail.Mentions = orNoMentions(postMentionsByID[postID])
+
+	commentIDs := make([]uint, len(comments))
+	for i := range comments {
+		commentIDs[i] = comments[i].ID
+	}
+	commentMentionsByID, err := commentMentions(ctx, p.db, commentIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range comments {
+		comments[i].Mentions = orNoMentions(commentMentionsByID[comments[i].ID])
+	}
+
 	return postDetail, comments, nil
 }
 
-func (p *Post) IncrementPostViews(ctx context.Context, postID uint) error {
+func (p *PostRepository) IncrementPostViews(ctx context.Context, postID uint) error {
+	defer observe(ctx, "post", "IncrementPostViews")()
+
 	query := `UPDATE posts SET views = views + 1 WHERE id = $1;`
 
-	_, err := db.ExecContext(ctx, query, postID)
+	_, err := p.db.ExecContext(ctx, query, postID)
 	if err != nil {
 		return fmt.Errorf("failed to increment views for post ID %d: %w", postID, err)
 	}
@@ -189,30 +254,122 @@ func (p *Post) IncrementPostViews(ctx context.Context, postID uint) error {
 	return nil
 }
 
-func (p *Post) CheckPostByID(ctx context.Context, postID uint) (bool, error) {
+func (p *PostRepository) IncrementPostViewsBy(ctx context.Context, views map[uint]int) error {
+	defer observe(ctx, "post", "IncrementPostViewsBy")()
+
+	if len(views) == 0 {
+		return nil
+	}
+
+	// Update in ID order so concurrent batches lock rows consistently
+	postIDs := make([]uint, 0, len(views))
+	for postID := range views {
+		postIDs = append(postIDs, postID)
+	}
+	sort.Slice(postIDs, func(i, j int) bool { return postIDs[i] < postIDs[j] })
+
+	ids := make([]int64, 0, len(postIDs))
+	counts := make([]int64, 0, len(postIDs))
+	for _, postID := range postIDs {
+		ids = append(ids, int64(postID))
+		counts = append(counts, int64(views[postID]))
+	}
+
+	// Two array parameters whatever the batch size, a parameter per post
+	// would fail past PostgreSQL's limit of 65535
+	query := `
+        UPDATE posts
+        SET views = posts.views + batch.count
+        FROM unnest($1::int[], $2::int[]) AS batch (id, count)
+        WHERE posts.id = batch.id;
+    `
+
+	_, err := p.db.ExecContext(ctx, query, ids, counts)
+	if err != nil {
+		return fmt.Errorf("failed to increment views for %d post(s): %w", len(postIDs), err)
+	}
+
+	return nil
+}
+
+func (p *PostRepository) GetPostByID(ctx context.Context, postID uint) (*Post, error) {
+	defer observe(ctx, "post", "GetPostByID")()
+
+	query := `
+        SELECT id, user_id, title, content, views, status, created_at, updated_at
+        FROM posts
+        WHERE id = $1;
+    `
+
+	post := new(Post)
+	err := sqlx.GetContext(ctx, p.db, post, query, postID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("post %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to fetch post: %w", err)
+	}
+	return post, nil
+}
+
+func (p *PostRepository) CheckPostByID(ctx context.Context, postID uint) (bool, error) {
+	defer observe(ctx, "post", "CheckPostByID")()
+
 	query := `SELECT 1 FROM posts WHERE id = $1;`
 
 	var exists bool
-	err := db.GetContext(ctx, &exists, query, postID)
+	err := sqlx.GetContext(ctx, p.db, &exists, query, postID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
 		return false, fmt.Errorf("failed to check post existence: %w", err)
 	}
 
 	return exists, nil
 }
 
-func (p *Post) DeletePost(ctx context.Context, postID uint) error {
+func (p *PostRepository) DeletePost(ctx context.Context, postID uint) error {
+	defer observe(ctx, "post", "DeletePost")()
+
 	query := `DELETE FROM posts WHERE id = $1;`
 
-	result, err := db.ExecContext(ctx, query, postID)
+	result, err := p.db.ExecContext(ctx, query, postID)
 	if err != nil {
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("no post found with the given ID")
+		return fmt.Errorf("post %w", ErrNotFound)
 	}
 
 	return nil
 }
+
+func (p *PostRepository) ReconcileCounters(ctx context.Context) (int, error) {
+	defer observe(ctx, "post", "ReconcileCounters")()
+
+	query := `
+        UPDATE posts
+        SET like_count    = counts.like_count,
+            comment_count = counts.comment_count
+        FROM (SELECT posts.id,
+                     (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id) AS like_count,
+                     (SELECT COUNT(*)
+                      FROM comments
+                      WHERE comments.post_id = posts.id
+                        AND comments.status = 'published')                     AS comment_count
+              FROM posts) AS counts
+        WHERE posts.id = counts.id
+          AND (posts.like_count <> counts.like_count OR posts.comment_count <> counts.comment_count);
+    `
+
+	result, err := p.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reconcile post counters: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return int(rowsAffected), nil
+}
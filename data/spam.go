@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"strings"
+	"time"
+)
+
+// SpamRepository stores spams in PostgreSQL
+type SpamRepository struct {
+	db sqlx.ExtContext
+}
+
+// SpamScore is the spam score stored for moderator review
+type SpamScore struct {
+	ID          uint      `json:"id" db:"id"`
+	ContentType string    `json:"content_type" db:"content_type"` // "post" or "comment"
+	ContentID   *uint     `json:"content_id" db:"content_id"`     // Empty for rejected content
+	UserID      string    `json:"user_id" db:"user_id"`
+	Score       int       `json:"score" db:"score"`
+	Reasons     string    `json:"reasons" db:"reasons"`
+	Decision    string    `json:"decision" db:"decision"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserActivity is what the spam heuristics need to know about an author
+type UserActivity struct {
+	AccountCreatedAt time.Time // Zero when unknown
+	RecentContents   []string  // Posts as title and content on two lines, the way they are scored
+}
+
+// Content types stored with spam scores
+const (
+	ContentTypePost    = "post"
+	ContentTypeComment = "comment"
+)
+
+func (s *SpamRepository) GetUserActivity(ctx context.Context, userID string, since time.Time) (*UserActivity, error) {
+	defer observe(ctx, "spam", "GetUserActivity")()
+
+	activity := new(UserActivity)
+
+	// The creation time stays zero when it is unknown
+	var createdAt sql.NullTime
+	userQuery := `SELECT created_at FROM users WHERE id = $1;`
+	err := sqlx.GetContext(ctx, s.db, &createdAt, userQuery, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	activity.AccountCreatedAt = createdAt.Time
+
+	recentQuery := `
+        SELECT title || E'\n' || content FROM posts WHERE user_id = $1 AND created_at >= $2
+        UNION ALL
+        SELECT content FROM comments WHERE user_id = $1 AND created_at >= $2;
+    `
+	err = sqlx.SelectContext(ctx, s.db, &activity.RecentContents, recentQuery, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch recent activity: %w", err)
+	}
+
+	return activity, nil
+}
+
+func (s *SpamRepository) RecordSpamScore(ctx context.Context, contentType string, contentID uint, userID string, score int, reasons []string, decision string) error {
+	defer observe(ctx, "spam", "RecordSpamScore")()
+
+	query := `
+        INSERT INTO spam_scores (content_type, content_id, user_id, score, reasons, decision, created_at)
+        VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, NOW());
+    `
+	_, err := s.db.ExecContext(ctx, query, contentType, contentID, userID, score, strings.Join(reasons, ", "), decision)
+	if err != nil {
+		return fmt.Errorf("failed to record spam score: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+// txFunc runs fn inside a transaction
+type txFunc func(ctx context.Context, fn func(tx *Models) error) error
+
+// WithTx runs fn with repositories bound to a single transaction. The
+// transaction is committed when fn returns nil and rolled back when it returns
+// an error or panics; the panic is re-raised after the rollback. Calling WithTx
+// on the Models passed to fn reuses the running transaction.
+func (m *Models) WithTx(ctx context.Context, fn func(tx *Models) error) error {
+	return m.withTx(ctx, fn)
+}
+
+// postgresTx begins a transaction on the pool for every call
+func postgresTx(db *sqlx.DB) txFunc {
+	return func(ctx context.Context, fn func(tx *Models) error) (err error) {
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+
+		defer func() {
+			if p := recover(); p != nil {
+				_ = tx.Rollback()
+				panic(p)
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				return
+			}
+			if commitErr := tx.Commit(); commitErr != nil {
+				err = fmt.Errorf("failed to commit transaction: %w", commitErr)
+			}
+		}()
+
+		models := newModels(tx)
+		models.withTx = nestedTx(models)
+		return fn(models)
+	}
+}
+
+// nestedTx runs fn within the transaction already bound to models
+func nestedTx(models *Models) txFunc {
+	return func(ctx context.Context, fn func(tx *Models) error) error {
+		return fn(models)
+	}
+}
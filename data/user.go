@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"strings"
+	"time"
+)
+
+type User struct {
+	ID        string    `json:"id" db:"id"`                 // Cognito subject
+	Email     string    `json:"email" db:"email"`           // Unique email address
+	Username  string    `json:"username" db:"username"`     // Display name
+	Country   *string   `json:"country" db:"country"`       // NULL when unknown
+	Major     *string   `json:"major" db:"major"`           // NULL when unknown
+	CreatedAt time.Time `json:"created_at" db:"created_at"` // Timestamp for account creation
+}
+
+// UserSummary is the public part of a user, safe to show to other users
+type UserSummary struct {
+	ID       string `json:"id" db:"id"`
+	Username string `json:"username" db:"username"`
+}
+
+// UserRepository reads users from PostgreSQL. Users are owned by another
+// service, so it never writes them.
+type UserRepository struct {
+	db sqlx.ExtContext
+}
+
+func (u *UserRepository) GetUser(ctx context.Context, userID string) (*User, error) {
+	defer observe(ctx, "user", "GetUser")()
+
+	query := `SELECT id, email, username, created_at FROM users WHERE id = $1;`
+	user := new(User)
+	err := sqlx.GetContext(ctx, u.db, user, query, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("user %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	return user, nil
+}
+
+func (u *UserRepository) FindUsersByUsernames(ctx context.Context, usernames []string) ([]User, error) {
+	defer observe(ctx, "user", "FindUsersByUsernames")()
+
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	lowered := make([]string, len(usernames))
+	for i, username := range usernames {
+		lowered[i] = strings.ToLower(username)
+	}
+
+	query, args, err := sqlx.In(`
+        SELECT id, email, username, created_at
+        FROM users
+        WHERE LOWER(username) IN (?);
+    `, lowered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build users query: %w", err)
+	}
+
+	var users []User
+	err = sqlx.SelectContext(ctx, u.db, &users, u.db.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+	return users, nil
+}
+
+func (u *UserRepository) SearchUsers(ctx context.Context, prefix string, limit int) ([]UserSummary, error) {
+	defer observe(ctx, "user", "SearchUsers")()
+
+	// Match the start of the name or of any later word, whole-name matches first
+	query := `
+        SELECT id, username
+        FROM users
+        WHERE LOWER(username) LIKE $1 ESCAPE '\'
+           OR LOWER(username) LIKE $2 ESCAPE '\'
+        ORDER BY LOWER(username) LIKE $1 ESCAPE '\' DESC, LOWER(username), id
+        LIMIT $3;
+    `
+
+	pattern := escapeLike(strings.ToLower(prefix)) + "%"
+	users := []UserSummary{}
+	err := sqlx.SelectContext(ctx, u.db, &users, query, pattern, "% "+pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	return users, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
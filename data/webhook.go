@@ -0,0 +1,420 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"   // Waiting for its next attempt
+	DeliveryDelivered = "delivered" // Acknowledged with a 2xx response
+	DeliveryDead      = "dead"      // Out of attempts, only a replay sends it again
+)
+
+type WebhookEndpoint struct {
+	ID         uint      `json:"id"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"` // Only returned on registration
+	EventTypes []string  `json:"event_types"`      // Empty subscribes to every type
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreateWebhookEndpointRequest struct {
+	URL        string   `json:"url" validate:"required,url,max=2048"`
+	Secret     string   `json:"secret" validate:"omitempty,min=16,max=100"` // Generated by the handler when empty
+	EventTypes []string `json:"event_types"`
+}
+
+// OutboxEvent is a change recorded for the webhook endpoints. It is written in
+// the transaction making the change and delivered after the commit.
+type OutboxEvent struct {
+	ID        uint            `json:"id" db:"id"`
+	Type      string          `json:"type" db:"type"`
+	PostID    uint            `json:"post_id" db:"post_id"`
+	Payload   json.RawMessage `json:"data" db:"payload"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             uint       `json:"id" db:"id"`
+	EventID        uint       `json:"event_id" db:"event_id"`
+	EventType      string     `json:"event_type" db:"event_type"`
+	EndpointID     uint       `json:"endpoint_id" db:"endpoint_id"`
+	Status         string     `json:"status" db:"status"`
+	Attempts       int        `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatusCode *int       `json:"last_status_code" db:"last_status_code"`
+	LastError      string     `json:"last_error" db:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at" db:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// DueWebhookDelivery is a delivery claimed by the dispatcher, with everything
+// needed to send it
+type DueWebhookDelivery struct {
+	ID       uint        `db:"id"`
+	Attempts int         `db:"attempts"` // Including the one about to be made
+	URL      string      `db:"url"`
+	Secret   string      `db:"secret"`
+	Event    OutboxEvent `db:"event"`
+}
+
+type WebhookDeliveryQuery struct {
+	Status     string `json:"status"`
+	EndpointID uint   `json:"endpoint_id"`
+	Limit      int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset     int    `json:"offset" validate:"gte=0"`
+}
+
+func (wq *WebhookDeliveryQuery) Parse(c echo.Context) error {
+	qs := c.QueryParams()
+
+	wq.Status = qs.Get("status")
+	switch wq.Status {
+	case "", DeliveryPending, DeliveryDelivered, DeliveryDead:
+	default:
+		return fmt.Errorf("unknown delivery status %q", wq.Status)
+	}
+
+	wq.EndpointID = 0
+	if endpointID := qs.Get("endpoint_id"); endpointID != "" {
+		id, err := strconv.Atoi(endpointID)
+		if err != nil || id < 1 {
+			return fmt.Errorf("invalid endpoint_id %q", endpointID)
+		}
+		wq.EndpointID = uint(id)
+	}
+
+	wq.Limit = 50
+	if limit, err := strconv.Atoi(qs.Get("limit")); err == nil && limit >= 1 && limit <= 100 {
+		wq.Limit = limit
+	}
+
+	wq.Offset = 0
+	if offset, err := strconv.Atoi(qs.Get("offset")); err == nil && offset >= 0 {
+		wq.Offset = offset
+	}
+
+	return nil
+}
+
+// webhookEndpointRow is a webhook endpoint as stored, with its event types
+// comma separated
+type webhookEndpointRow struct {
+	ID         uint      `db:"id"`
+	URL        string    `db:"url"`
+	Secret     string    `db:"secret"`
+	EventTypes string    `db:"event_types"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+func (r webhookEndpointRow) endpoint() WebhookEndpoint {
+	eventTypes := []string{}
+	if r.EventTypes != "" {
+		eventTypes = strings.Split(r.EventTypes, ",")
+	}
+	return WebhookEndpoint{ID: r.ID, URL: r.URL, Secret: r.Secret, EventTypes: eventTypes, CreatedAt: r.CreatedAt}
+}
+
+// subscribedCondition matches the endpoints subscribed to the type of the event
+const subscribedCondition = `(webhook_endpoints.event_types = '' OR outbox_events.type = ANY (string_to_array(webhook_endpoints.event_types, ',')))`
+
+// WebhookRepository stores the outbox and the webhook endpoints and
+// deliveries in PostgreSQL
+type WebhookRepository struct {
+	db sqlx.ExtContext
+}
+
+func (w *WebhookRepository) AddOutboxEvent(ctx context.Context, eventType string, postID uint, payload interface{}) error {
+	defer observe(ctx, "webhook", "AddOutboxEvent")()
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	// Queue a delivery for every subscribed endpoint with the event
+	query := `
+        WITH event AS (
+            INSERT INTO outbox_events (type, post_id, payload, created_at)
+            VALUES ($1, $2, $3::JSONB, NOW())
+            RETURNING id
+        )
+        INSERT INTO webhook_deliveries (event_id, endpoint_id, status, next_attempt_at, created_at)
+        SELECT event.id, webhook_endpoints.id, 'pending', NOW(), NOW()
+        FROM event, webhook_endpoints
+        WHERE webhook_endpoints.event_types = ''
+           OR $1 = ANY (string_to_array(webhook_endpoints.event_types, ','));
+    `
+
+	_, err = w.db.ExecContext(ctx, query, eventType, postID, string(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to add %s event to the outbox: %w", eventType, err)
+	}
+	return nil
+}
+
+func (w *WebhookRepository) CreateWebhookEndpoint(ctx context.Context, req *CreateWebhookEndpointRequest) (*WebhookEndpoint, error) {
+	defer observe(ctx, "webhook", "CreateWebhookEndpoint")()
+
+	query := `
+        INSERT INTO webhook_endpoints (url, secret, event_types, created_at)
+        VALUES ($1, $2, $3, NOW())
+        RETURNING id, url, secret, event_types, created_at;
+    `
+
+	var row webhookEndpointRow
+	err := sqlx.GetContext(ctx, w.db, &row, query, req.URL, req.Secret, strings.Join(req.EventTypes, ","))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+
+	endpoint := row.endpoint()
+	return &endpoint, nil
+}
+
+func (w *WebhookRepository) GetWebhookEndpoints(ctx context.Context) ([]WebhookEndpoint, error) {
+	defer observe(ctx, "webhook", "GetWebhookEndpoints")()
+
+	query := `SELECT id, url, '' AS secret, event_types, created_at FROM webhook_endpoints ORDER BY id;`
+
+	var rows []webhookEndpointRow
+	err := sqlx.SelectContext(ctx, w.db, &rows, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook endpoints: %w", err)
+	}
+
+	endpoints := make([]WebhookEndpoint, len(rows))
+	for i, row := range rows {
+		endpoints[i] = row.endpoint()
+	}
+	return endpoints, nil
+}
+
+func (w *WebhookRepository) DeleteWebhookEndpoint(ctx context.Context, endpointID uint) error {
+	defer observe(ctx, "webhook", "DeleteWebhookEndpoint")()
+
+	query := `DELETE FROM webhook_endpoints WHERE id = $1;`
+
+	result, err := w.db.ExecContext(ctx, query, endpointID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("webhook endpoint %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (w *WebhookRepository) GetWebhookDeliveries(ctx context.Context, query WebhookDeliveryQuery) ([]WebhookDelivery, error) {
+	defer observe(ctx, "webhook", "GetWebhookDeliveries")()
+
+	selectQuery := `
+        SELECT webhook_deliveries.id,
+               webhook_deliveries.event_id,
+               outbox_events.type AS event_type,
+               webhook_deliveries.endpoint_id,
+               webhook_deliveries.status,
+               webhook_deliveries.attempts,
+               webhook_deliveries.next_attempt_at,
+               webhook_deliveries.last_status_code,
+               webhook_deliveries.last_error,
+               webhook_deliveries.delivered_at,
+               webhook_deliveries.created_at
+        FROM webhook_deliveries
+                 JOIN outbox_events ON outbox_events.id = webhook_deliveries.event_id
+        WHERE ($1 = '' OR webhook_deliveries.status = $1)
+          AND ($2 = 0 OR webhook_deliveries.endpoint_id = $2)
+        ORDER BY webhook_deliveries.id DESC
+        LIMIT $3 OFFSET $4;
+    `
+
+	deliveries := []WebhookDelivery{}
+	err := sqlx.SelectContext(ctx, w.db, &deliveries, selectQuery, query.Status, query.EndpointID, query.Limit, query.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (w *WebhookRepository) ReplayOutboxEvent(ctx context.Context, eventID uint, endpointID uint) (int, error) {
+	defer observe(ctx, "webhook", "ReplayOutboxEvent")()
+
+	checkQuery := `SELECT id FROM outbox_events WHERE id = $1;`
+	var existingEventID uint
+	err := sqlx.GetContext(ctx, w.db, &existingEventID, checkQuery, eventID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("event %w", ErrNotFound)
+		}
+		return 0, fmt.Errorf("failed to validate event existence: %w", err)
+	}
+	if err := w.checkEndpoint(ctx, endpointID); err != nil {
+		return 0, err
+	}
+
+	return w.replay(ctx, `outbox_events.id = $1 AND ($2 = 0 OR webhook_endpoints.id = $2)`, eventID, endpointID)
+}
+
+func (w *WebhookRepository) ReplayWebhookEndpoint(ctx context.Context, endpointID uint, since *time.Time) (int, error) {
+	defer observe(ctx, "webhook", "ReplayWebhookEndpoint")()
+
+	if err := w.checkEndpoint(ctx, endpointID); err != nil {
+		return 0, err
+	}
+
+	if since != nil {
+		return w.replay(ctx, `webhook_endpoints.id = $1 AND outbox_events.created_at >= $2`, endpointID, *since)
+	}
+
+	// Without a starting time only the dead deliveries are sent again
+	query := `
+        UPDATE webhook_deliveries
+        SET status           = 'pending',
+            attempts         = 0,
+            next_attempt_at  = NOW(),
+            last_status_code = NULL,
+            last_error       = ''
+        WHERE endpoint_id = $1 AND status = 'dead';
+    `
+	result, err := w.db.ExecContext(ctx, query, endpointID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay webhook deliveries: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return int(rowsAffected), nil
+}
+
+// replay queues the events matching condition again for their subscribed
+// endpoints, resetting the deliveries made before
+func (w *WebhookRepository) replay(ctx context.Context, condition string, args ...interface{}) (int, error) {
+	query := `
+        INSERT INTO webhook_deliveries (event_id, endpoint_id, status, next_attempt_at, created_at)
+        SELECT outbox_events.id, webhook_endpoints.id, 'pending', NOW(), NOW()
+        FROM outbox_events, webhook_endpoints
+        WHERE ` + condition + ` AND ` + subscribedCondition + `
+        ON CONFLICT (event_id, endpoint_id) DO UPDATE
+            SET status           = 'pending',
+                attempts         = 0,
+                next_attempt_at  = NOW(),
+                last_status_code = NULL,
+                last_error       = '',
+                delivered_at     = NULL;
+    `
+
+	result, err := w.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay events: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return int(rowsAffected), nil
+}
+
+// checkEndpoint reports a missing endpoint, 0 standing for every endpoint
+func (w *WebhookRepository) checkEndpoint(ctx context.Context, endpointID uint) error {
+	if endpointID == 0 {
+		return nil
+	}
+
+	query := `SELECT id FROM webhook_endpoints WHERE id = $1;`
+	var existingEndpointID uint
+	err := sqlx.GetContext(ctx, w.db, &existingEndpointID, query, endpointID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("webhook endpoint %w", ErrNotFound)
+		}
+		return fmt.Errorf("failed to validate webhook endpoint existence: %w", err)
+	}
+	return nil
+}
+
+func (w *WebhookRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueWebhookDelivery, error) {
+	defer observe(ctx, "webhook", "ClaimWebhookDeliveries")()
+
+	// Postpone the claimed deliveries by the lease so other dispatchers skip
+	// them while they are sent. A dispatcher dying mid-send leaves them to be
+	// retried once the lease expires.
+	query := `
+        WITH claimed AS (
+            UPDATE webhook_deliveries
+            SET attempts        = attempts + 1,
+                next_attempt_at = NOW() + MAKE_INTERVAL(secs => $2)
+            WHERE id IN (SELECT id
+                         FROM webhook_deliveries
+                         WHERE status = 'pending'
+                           AND next_attempt_at <= NOW()
+                         ORDER BY next_attempt_at, id
+                         LIMIT $1 FOR UPDATE SKIP LOCKED)
+            RETURNING id, event_id, endpoint_id, attempts
+        )
+        SELECT claimed.id,
+               claimed.attempts,
+               webhook_endpoints.url,
+               webhook_endpoints.secret,
+               outbox_events.id         AS "event.id",
+               outbox_events.type       AS "event.type",
+               outbox_events.post_id    AS "event.post_id",
+               outbox_events.payload    AS "event.payload",
+               outbox_events.created_at AS "event.created_at"
+        FROM claimed
+                 JOIN webhook_endpoints ON webhook_endpoints.id = claimed.endpoint_id
+                 JOIN outbox_events ON outbox_events.id = claimed.event_id
+        ORDER BY claimed.id;
+    `
+
+	var deliveries []DueWebhookDelivery
+	err := sqlx.SelectContext(ctx, w.db, &deliveries, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (w *WebhookRepository) MarkWebhookDelivered(ctx context.Context, deliveryID uint, statusCode int) error {
+	defer observe(ctx, "webhook", "MarkWebhookDelivered")()
+
+	query := `
+        UPDATE webhook_deliveries
+        SET status = 'delivered', last_status_code = $2, last_error = '', delivered_at = NOW()
+        WHERE id = $1;
+    `
+
+	_, err := w.db.ExecContext(ctx, query, deliveryID, statusCode)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivery as delivered: %w", err)
+	}
+	return nil
+}
+
+func (w *WebhookRepository) MarkWebhookFailed(ctx context.Context, deliveryID uint, statusCode int, message string, retryAt *time.Time) error {
+	defer observe(ctx, "webhook", "MarkWebhookFailed")()
+
+	// Without a retry time the delivery is dead
+	query := `
+        UPDATE webhook_deliveries
+        SET status           = CASE WHEN $4::TIMESTAMPTZ IS NULL THEN 'dead' ELSE 'pending' END,
+            next_attempt_at  = COALESCE($4::TIMESTAMPTZ, next_attempt_at),
+            last_status_code = NULLIF($2, 0),
+            last_error       = $3
+        WHERE id = $1;
+    `
+
+	_, err := w.db.ExecContext(ctx, query, deliveryID, statusCode, message, retryAt)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivery as failed: %w", err)
+	}
+	return nil
+}
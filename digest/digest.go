@@ -0,0 +1,301 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/mailer"
+	htmltemplate "html/template"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var (
+	templateFuncs = map[string]interface{}{"plural": plural}
+	htmlTemplates = htmltemplate.Must(htmltemplate.New("").Funcs(templateFuncs).ParseFS(templateFiles, "templates/*.html"))
+	textTemplates = texttemplate.Must(texttemplate.New("").Funcs(templateFuncs).ParseFS(templateFiles, "templates/*.txt"))
+)
+
+// maxSnippet bounds the runes of a reply quoted in the digest
+const maxSnippet = 200
+
+// Store picks the recipients and gathers their digests
+type Store interface {
+	ClaimDigestRecipients(ctx context.Context, limit int) ([]data.DigestRecipient, error)
+	GetDigest(ctx context.Context, userID string, query data.DigestQuery) (*data.Digest, error)
+}
+
+// Preferences tells which notification types users want by email
+type Preferences interface {
+	GetNotificationPreferences(ctx context.Context, userID string) (data.NotificationPreferences, error)
+}
+
+// Config tunes the sender
+type Config struct {
+	// Interval is how often due digests are looked for
+	Interval time.Duration
+	// BatchSize caps the recipients claimed at once
+	BatchSize int
+	// Items caps the replies and top posts listed in one digest
+	Items int
+	// AppURL links to posts as <AppURL>/posts/<id>, no links when empty
+	AppURL string
+	// UnsubscribeURL is the unsubscribe endpoint the token is appended to
+	UnsubscribeURL string
+}
+
+// Sender mails the daily and weekly digests. Users are claimed before their
+// digest is sent, so a failed email isn't retried before the next period.
+type Sender struct {
+	store       Store
+	preferences Preferences
+	mailer      mailer.Mailer
+	config      Config
+
+	started  atomic.Bool
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSender creates a sender mailing the digests of store through mailer.
+// Comments and replies are left out for users who don't want them by email.
+func NewSender(store Store, preferences Preferences, mailer mailer.Mailer, config Config) *Sender {
+	if config.Interval <= 0 {
+		config.Interval = time.Hour
+	}
+	if config.BatchSize < 1 {
+		config.BatchSize = 50
+	}
+	if config.Items < 1 {
+		config.Items = 5
+	}
+	config.AppURL = strings.TrimRight(config.AppURL, "/")
+
+	return &Sender{
+		store:       store,
+		preferences: preferences,
+		mailer:      mailer,
+		config:      config,
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+}
+
+// Start sends the due digests every interval until Close is called
+func (s *Sender) Start() {
+	if s.started.Swap(true) {
+		return
+	}
+
+	go func() {
+		defer close(s.stopped)
+
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// Keep going while full batches come back
+				for {
+					claimed, err := s.Send(context.Background())
+					if err != nil {
+						slog.Error("Failed to send digests", "error", err)
+					}
+					if err != nil || claimed < s.config.BatchSize || s.stopping() {
+						break
+					}
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Send mails one batch of due digests and returns how many users were
+// claimed. Users without any news are claimed but not mailed.
+func (s *Sender) Send(ctx context.Context) (int, error) {
+	recipients, err := s.store.ClaimDigestRecipients(ctx, s.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, recipient := range recipients {
+		if err := s.send(ctx, recipient); err != nil {
+			slog.ErrorContext(ctx, "Failed to send digest", "recipient", recipient.UserID, "error", err)
+		}
+	}
+	return len(recipients), nil
+}
+
+func (s *Sender) send(ctx context.Context, recipient data.DigestRecipient) error {
+	preferences, err := s.preferences.GetNotificationPreferences(ctx, recipient.UserID)
+	if err != nil {
+		return err
+	}
+
+	digest, err := s.store.GetDigest(ctx, recipient.UserID, data.DigestQuery{
+		Since:    time.Now().Add(-data.DigestPeriod(recipient.Frequency)),
+		Limit:    s.config.Items,
+		Comments: preferences.Enabled(data.NotificationComment, data.ChannelEmail),
+		Replies:  preferences.Enabled(data.NotificationReply, data.ChannelEmail),
+	})
+	if err != nil {
+		return err
+	}
+	if digest.Empty() {
+		return nil
+	}
+
+	message, err := s.Render(recipient, digest)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, *message)
+}
+
+// templateData is what the digest templates render
+type templateData struct {
+	Username       string
+	Period         string // "day" or "week"
+	Replies        []templateReply
+	MoreReplies    int
+	TopPosts       []templatePost
+	UnsubscribeURL string
+}
+
+type templateReply struct {
+	data.DigestReply
+	Snippet string
+	URL     string
+}
+
+type templatePost struct {
+	data.DigestPost
+	URL string
+}
+
+// Render builds the digest email of a recipient
+func (s *Sender) Render(recipient data.DigestRecipient, digest *data.Digest) (*mailer.Message, error) {
+	unsubscribeURL := s.config.UnsubscribeURL + "?token=" + url.QueryEscape(recipient.UnsubscribeToken)
+
+	view := templateData{
+		Username:       recipient.Username,
+		Period:         "week",
+		MoreReplies:    digest.ReplyCount - len(digest.Replies),
+		UnsubscribeURL: unsubscribeURL,
+	}
+	if recipient.Frequency == data.DigestDaily {
+		view.Period = "day"
+	}
+	for _, reply := range digest.Replies {
+		view.Replies = append(view.Replies, templateReply{DigestReply: reply, Snippet: snippet(reply.Content), URL: s.postURL(reply.PostID)})
+	}
+	for _, post := range digest.TopPosts {
+		view.TopPosts = append(view.TopPosts, templatePost{DigestPost: post, URL: s.postURL(post.PostID)})
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, "digest.txt", view); err != nil {
+		return nil, fmt.Errorf("failed to render digest: %w", err)
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, "digest.html", view); err != nil {
+		return nil, fmt.Errorf("failed to render digest: %w", err)
+	}
+
+	subject := fmt.Sprintf("Your %s iducate community digest", recipient.Frequency)
+	switch {
+	case digest.ReplyCount == 1:
+		subject = "1 new reply in your " + recipient.Frequency + " iducate digest"
+	case digest.ReplyCount > 1:
+		subject = fmt.Sprintf("%d new replies in your %s iducate digest", digest.ReplyCount, recipient.Frequency)
+	}
+
+	return &mailer.Message{
+		To:      recipient.Email,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+		// One-click unsubscribe, RFC 8058
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
+
+// UnsubscribePage renders the page behind the unsubscribe link, asking for
+// confirmation until unsubscribed is true
+func UnsubscribePage(token string, unsubscribed bool) (string, error) {
+	var page bytes.Buffer
+	err := htmlTemplates.ExecuteTemplate(&page, "unsubscribe.html", map[string]interface{}{
+		"Token":        token,
+		"Unsubscribed": unsubscribed,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render unsubscribe page: %w", err)
+	}
+	return page.String(), nil
+}
+
+func (s *Sender) postURL(postID uint) string {
+	if s.config.AppURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/posts/%d", s.config.AppURL, postID)
+}
+
+// plural formats a count with the singular or plural noun, e.g. "1 like"
+func plural(count int, singular string, pluralForm string) string {
+	if count == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", count, pluralForm)
+}
+
+// snippet shortens content to maxSnippet runes on one line
+func snippet(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) <= maxSnippet {
+		return content
+	}
+	return strings.TrimSpace(string(runes[:maxSnippet])) + "…"
+}
+
+func (s *Sender) stopping() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the send loop, waiting for the batch in progress
+func (s *Sender) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+	if s.started.Load() {
+		select {
+		case <-s.stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published by the handlers
+const (
+	TypePostCreated    = "post.created"
+	TypePostDeleted    = "post.deleted"
+	TypeCommentCreated = "comment.created"
+	TypeCommentUpdated = "comment.updated"
+	TypeCommentDeleted = "comment.deleted"
+	TypeLikesUpdated   = "likes.updated"
+)
+
+// Event is something that happened to a post. Its ID is the epoch of the bus
+// and a sequence number increasing by one for every published event, e.g.
+// "1710950400000000000-42", so subscribers can resume after a reconnect to
+// the same process. Sequence numbers restart in every process, the epoch
+// tells them apart.
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	PostID    uint            `json:"post_id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+
+	seq uint64
+}
+
+// Filter selects the events a subscriber receives
+type Filter func(event Event) bool
+
+// ForPost selects the events of a single post
+func ForPost(postID uint) Filter {
+	return func(event Event) bool {
+		return event.PostID == postID
+	}
+}
+
+// Bus fans published events out to subscribers in process. The most recent
+// events are kept in a ring buffer so reconnecting subscribers can replay
+// what they missed.
+type Bus struct {
+	mu          sync.Mutex
+	epoch       string // Start time in nanoseconds, prefixing every event ID
+	nextID      uint64
+	history     []Event // Ring buffer of the last len(history) events
+	size        int     // Number of events held in history
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Subscription receives the events matching its filter on C. C is closed when
+// the bus shuts down, or when the subscriber falls too far behind; the
+// subscriber is expected to reconnect and replay in that case.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	filter Filter
+	bus    *Bus
+	once   sync.Once
+}
+
+// NewBus creates a bus remembering the last replaySize events
+func NewBus(replaySize int) *Bus {
+	if replaySize < 1 {
+		replaySize = 1
+	}
+	return &Bus{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 10),
+		history:     make([]Event, replaySize),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the event an ID and delivers it to the matching subscribers
+// without blocking. data is encoded as JSON.
+func (b *Bus) Publish(eventType string, postID uint, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	b.nextID++
+	event := Event{
+		ID:        b.epoch + "-" + strconv.FormatUint(b.nextID, 10),
+		Type:      eventType,
+		PostID:    postID,
+		Data:      payload,
+		CreatedAt: time.Now(),
+		seq:       b.nextID,
+	}
+	b.history[(event.seq-1)%uint64(len(b.history))] = event
+	if b.size < len(b.history) {
+		b.size++
+	}
+
+	for sub := range b.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// Drop subscribers that can't keep up instead of blocking publishers
+			b.removeLocked(sub)
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a subscriber buffering up to buffer events. Events
+// published after lastID that are still in the replay buffer are returned
+// first; complete is false when some of them were already dropped, or when
+// lastID is unknown because it comes from another process or replica. An
+// empty lastID subscribes to new events only.
+func (b *Bus) Subscribe(filter Filter, lastID string, buffer int) (sub *Subscription, replay []Event, complete bool) {
+	ch := make(chan Event, buffer)
+	sub = &Subscription{C: ch, ch: ch, filter: filter, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		sub.once.Do(func() { close(ch) })
+		return sub, nil, true
+	}
+
+	replay, complete = b.sinceLocked(lastID, filter)
+	b.subscribers[sub] = struct{}{}
+	return sub, replay, complete
+}
+
+// sinceLocked returns the buffered events after lastID matching filter
+func (b *Bus) sinceLocked(lastEventID string, filter Filter) ([]Event, bool) {
+	if lastEventID == "" {
+		return nil, true
+	}
+
+	// IDs of another epoch say nothing about the events of this one
+	epoch, seq, ok := strings.Cut(lastEventID, "-")
+	if !ok || epoch != b.epoch {
+		return nil, false
+	}
+	lastID, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || lastID > b.nextID {
+		return nil, false
+	}
+	if lastID == b.nextID {
+		return nil, true
+	}
+
+	oldest := b.nextID - uint64(b.size) + 1
+	complete := lastID+1 >= oldest
+	from := lastID + 1
+	if from < oldest {
+		from = oldest
+	}
+
+	var events []Event
+	for id := from; id <= b.nextID; id++ {
+		event := b.history[(id-1)%uint64(len(b.history))]
+		if filter == nil || filter(event) {
+			events = append(events, event)
+		}
+	}
+	return events, complete
+}
+
+// Close stops delivering events to the subscription
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.removeLocked(s)
+}
+
+func (b *Bus) removeLocked(sub *Subscription) {
+	sub.once.Do(func() {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	})
+}
+
+// Close disconnects every subscriber and ignores later publishes
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.removeLocked(sub)
+	}
+}
@@ -0,0 +1,166 @@
+package events
+
+import (
+	"strconv"
+	"testing"
+)
+
+// publishN publishes n comment events of postID
+func publishN(t *testing.T, b *Bus, postID uint, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := b.Publish(TypeCommentCreated, postID, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// eventID is the ID of the seq-th event published on b
+func eventID(b *Bus, seq int) string {
+	return b.epoch + "-" + strconv.Itoa(seq)
+}
+
+func expectIDs(t *testing.T, b *Bus, got []Event, seqs ...int) {
+	t.Helper()
+	if len(got) != len(seqs) {
+		t.Fatalf("got %d events, want %d", len(got), len(seqs))
+	}
+	for i, seq := range seqs {
+		if got[i].ID != eventID(b, seq) {
+			t.Fatalf("event %d is %s, want %s", i, got[i].ID, eventID(b, seq))
+		}
+	}
+}
+
+func TestPublishAssignsSequentialIDs(t *testing.T) {
+	b := NewBus(4)
+	sub, _, _ := b.Subscribe(nil, "", 4)
+	defer sub.Close()
+
+	publishN(t, b, 1, 2)
+	for seq := 1; seq <= 2; seq++ {
+		event := <-sub.C
+		if event.ID != eventID(b, seq) || event.Type != TypeCommentCreated || event.PostID != 1 {
+			t.Fatalf("got %+v, want event %s", event, eventID(b, seq))
+		}
+	}
+}
+
+func TestSubscribeReplaysMissedEvents(t *testing.T) {
+	b := NewBus(4)
+	publishN(t, b, 1, 3)
+
+	sub, replay, complete := b.Subscribe(nil, eventID(b, 1), 4)
+	defer sub.Close()
+	if !complete {
+		t.Fatal("replay reported incomplete")
+	}
+	expectIDs(t, b, replay, 2, 3)
+
+	// Up to date subscribers replay nothing
+	_, replay, complete = b.Subscribe(nil, eventID(b, 3), 4)
+	if !complete || len(replay) != 0 {
+		t.Fatalf("got %d events and complete %v, want none and true", len(replay), complete)
+	}
+
+	// No ID means new events only
+	_, replay, complete = b.Subscribe(nil, "", 4)
+	if !complete || len(replay) != 0 {
+		t.Fatalf("got %d events and complete %v, want none and true", len(replay), complete)
+	}
+}
+
+func TestSubscribeAfterRingWrapped(t *testing.T) {
+	b := NewBus(3)
+	publishN(t, b, 1, 5)
+
+	// Events 1 and 2 were overwritten, 3 to 5 are left
+	_, replay, complete := b.Subscribe(nil, eventID(b, 1), 4)
+	if complete {
+		t.Fatal("replay reported complete though event 2 was dropped")
+	}
+	expectIDs(t, b, replay, 3, 4, 5)
+
+	// Resuming from the event just before the oldest one misses nothing
+	_, replay, complete = b.Subscribe(nil, eventID(b, 2), 4)
+	if !complete {
+		t.Fatal("replay reported incomplete")
+	}
+	expectIDs(t, b, replay, 3, 4, 5)
+}
+
+func TestSubscribeFiltersReplay(t *testing.T) {
+	b := NewBus(4)
+	publishN(t, b, 1, 1)
+	publishN(t, b, 2, 1)
+	publishN(t, b, 1, 1)
+
+	_, replay, complete := b.Subscribe(ForPost(1), eventID(b, 0), 4)
+	if !complete {
+		t.Fatal("replay reported incomplete")
+	}
+	expectIDs(t, b, replay, 1, 3)
+}
+
+func TestSubscribeWithUnknownIDs(t *testing.T) {
+	b := NewBus(4)
+	publishN(t, b, 1, 2)
+
+	for name, lastID := range map[string]string{
+		"other epoch": "1-1",
+		"future":      eventID(b, 3),
+		"no epoch":    "1",
+		"not numeric": b.epoch + "-x",
+	} {
+		_, replay, complete := b.Subscribe(nil, lastID, 4)
+		if complete || len(replay) != 0 {
+			t.Errorf("%s: got %d events and complete %v, want none and false", name, len(replay), complete)
+		}
+	}
+}
+
+func TestPublishDropsLaggingSubscribers(t *testing.T) {
+	b := NewBus(4)
+	slow, _, _ := b.Subscribe(nil, "", 1)
+	other, _, _ := b.Subscribe(ForPost(2), "", 1)
+
+	publishN(t, b, 1, 2)
+
+	// The buffered event is still delivered, then C is closed
+	if _, ok := <-slow.C; !ok {
+		t.Fatal("buffered event lost")
+	}
+	if _, ok := <-slow.C; ok {
+		t.Fatal("lagging subscriber wasn't dropped")
+	}
+
+	// Subscribers filtering the events out are unaffected
+	publishN(t, b, 2, 1)
+	if event, ok := <-other.C; !ok || event.PostID != 2 {
+		t.Fatalf("got %+v and %v, want the event of post 2", event, ok)
+	}
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	b := NewBus(4)
+	sub, _, _ := b.Subscribe(nil, "", 1)
+
+	sub.Close()
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatal("closed subscription received an event")
+	}
+
+	live, _, _ := b.Subscribe(nil, "", 1)
+	b.Close()
+	if _, ok := <-live.C; ok {
+		t.Fatal("subscription outlived the bus")
+	}
+
+	// Publishing to and subscribing on a closed bus do nothing
+	publishN(t, b, 1, 1)
+	late, _, _ := b.Subscribe(nil, "", 1)
+	if _, ok := <-late.C; ok {
+		t.Fatal("subscription on a closed bus is open")
+	}
+}
@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/migrations"
+	"github.com/jackc/pgconn"
+	"github.com/jmoiron/sqlx"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check results
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Report is the outcome of a readiness check, with the result of every
+// single check by name
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Checker tells whether the service can take traffic: the database answers
+// in time, its schema is up to date, the registered checks pass and the
+// server isn't shutting down
+type Checker struct {
+	db       *sqlx.DB
+	migrator *migrations.Migrator
+	timeout  time.Duration
+	draining atomic.Bool
+	checks   map[string]func(ctx context.Context) error
+}
+
+// NewChecker builds a Checker giving the database timeout to answer,
+// 2 seconds when zero
+func NewChecker(db *sqlx.DB, migrator *migrations.Migrator, timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Checker{db: db, migrator: migrator, timeout: timeout, checks: map[string]func(ctx context.Context) error{}}
+}
+
+// Register adds a check reported under name. Call it before serving.
+func (ch *Checker) Register(name string, check func(ctx context.Context) error) {
+	ch.checks[name] = check
+}
+
+// Drain makes every readiness check fail from now on, so load balancers
+// stop sending requests before the server shuts down
+func (ch *Checker) Drain() {
+	ch.draining.Store(true)
+}
+
+// Ready runs the checks concurrently and reports whether all passed
+func (ch *Checker) Ready(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, ch.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: map[string]string{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	run := func(name string, check func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.Status = StatusUnavailable
+				report.Checks[name] = err.Error()
+				return
+			}
+			report.Checks[name] = StatusOK
+		}()
+	}
+
+	run("shutdown", ch.checkShutdown)
+	run("database", ch.checkDatabase)
+	run("migrations", ch.checkMigrations)
+	for name, check := range ch.checks {
+		run(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (ch *Checker) checkShutdown(_ context.Context) error {
+	if ch.draining.Load() {
+		return fmt.Errorf("shutting down")
+	}
+	return nil
+}
+
+func (ch *Checker) checkDatabase(ctx context.Context) error {
+	if err := ch.db.PingContext(ctx); err != nil {
+		// The driver error may name hosts and users, it is only logged
+		slog.WarnContext(ctx, "Database ping failed", "error", err)
+		return fmt.Errorf("unreachable")
+	}
+	return nil
+}
+
+// checkMigrations passes once the schema has every migration of this build.
+// A newer schema is fine, a new release may have migrated it during a
+// rolling update.
+func (ch *Checker) checkMigrations(ctx context.Context) error {
+	version, err := ch.schemaVersion(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "Reading schema version failed", "error", err)
+		return fmt.Errorf("unknown schema version")
+	}
+	if latest := ch.migrator.Latest(); version < latest {
+		return fmt.Errorf("schema at version %d, expected %d", version, latest)
+	}
+	return nil
+}
+
+// schemaVersion reads the applied version without the migrator, which
+// creates schema_migrations first. A database without the table is at
+// version 0.
+func (ch *Checker) schemaVersion(ctx context.Context) (int64, error) {
+	var version int64
+	err := ch.db.GetContext(ctx, &version, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P01" { // undefined_table
+		return 0, nil
+	}
+	return version, err
+}
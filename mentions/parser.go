@@ -0,0 +1,130 @@
+package mentions
+
+import (
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"strings"
+	"unicode"
+)
+
+// maxWords is the longest display name, in words, an @ can refer to.
+// Display names contain spaces, so "@Jane Smith" may mean "Jane" or "Jane
+// Smith"; the longest name belonging to a user wins.
+const maxWords = 4
+
+// candidate is one way to read the text after an @
+type candidate struct {
+	offset int    // Position of the @, in runes
+	length int    // Length including the @, in runes
+	name   string // Lowercased name
+}
+
+// Candidates returns the lowercased names content may mention, to be looked
+// up with data.UserInterfaces.FindUsersByUsernames
+func Candidates(content string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, c := range candidates(content) {
+		if !seen[c.name] {
+			seen[c.name] = true
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+// Resolve finds the mentions of users in content. Each @ resolves to the
+// longest following name matching exactly one user, case-insensitively;
+// names shared by several users are ambiguous and ignored. Offsets and
+// lengths count Unicode code points and include the @.
+func Resolve(content string, users []data.User) []data.Mention {
+	byName := make(map[string][]data.User)
+	for _, user := range users {
+		name := strings.ToLower(user.Username)
+		byName[name] = append(byName[name], user)
+	}
+
+	mentions := []data.Mention{}
+	var current *data.Mention
+	for _, c := range candidates(content) {
+		matches := byName[c.name]
+		if len(matches) != 1 {
+			continue
+		}
+
+		// Candidates of the same @ come shortest first, keep the longest
+		if current != nil && current.Offset == c.offset {
+			current.UserID = matches[0].ID
+			current.Username = matches[0].Username
+			current.Length = c.length
+			continue
+		}
+
+		mentions = append(mentions, data.Mention{
+			UserID:   matches[0].ID,
+			Username: matches[0].Username,
+			Offset:   c.offset,
+			Length:   c.length,
+		})
+		current = &mentions[len(mentions)-1]
+	}
+	return mentions
+}
+
+// UserIDs returns the distinct mentioned users in order of appearance
+func UserIDs(mentions []data.Mention) []string {
+	seen := make(map[string]bool)
+	var userIDs []string
+	for _, mention := range mentions {
+		if !seen[mention.UserID] {
+			seen[mention.UserID] = true
+			userIDs = append(userIDs, mention.UserID)
+		}
+	}
+	return userIDs
+}
+
+// candidates lists, for every @ starting a mention, the names made of its
+// next one to maxWords words, shortest first
+func candidates(content string) []candidate {
+	runes := []rune(content)
+
+	var found []candidate
+	for i, r := range runes {
+		// An @ inside a word is part of something else, like an email address
+		if r != '@' || (i > 0 && isNameRune(runes[i-1])) {
+			continue
+		}
+
+		end := i + 1
+		for words := 0; words < maxWords; words++ {
+			start := end
+			if words > 0 {
+				// Words are separated by a single space
+				if end >= len(runes) || runes[end] != ' ' {
+					break
+				}
+				start = end + 1
+			}
+
+			wordEnd := start
+			for wordEnd < len(runes) && isNameRune(runes[wordEnd]) {
+				wordEnd++
+			}
+			if wordEnd == start {
+				break
+			}
+
+			end = wordEnd
+			found = append(found, candidate{
+				offset: i,
+				length: end - i,
+				name:   strings.ToLower(string(runes[i+1 : end])),
+			})
+		}
+	}
+	return found
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' || r == '\''
+}
@@ -0,0 +1,67 @@
+package mentions
+
+import (
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"reflect"
+	"testing"
+)
+
+var testUsers = []data.User{
+	{ID: "u1", Username: "Jane"},
+	{ID: "u2", Username: "Jane Smith"},
+	{ID: "u3", Username: "Budi"},
+	{ID: "u4", Username: "Sam"},
+	{ID: "u5", Username: "sam"},
+	{ID: "u6", Username: "Zoë"},
+}
+
+func TestCandidates(t *testing.T) {
+	got := Candidates("@Jane Smith and @jane, mail jane@example.com @")
+	want := []string{"jane", "jane smith", "jane smith and"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestCandidatesStopAtMaxWords(t *testing.T) {
+	got := Candidates("@a b c d e")
+	want := []string{"a", "a b", "a b c", "a b c d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []data.Mention
+	}{
+		{"no mentions", []data.Mention{}},
+		{"hi @budi!", []data.Mention{{UserID: "u3", Username: "Budi", Offset: 3, Length: 5}}},
+		// The longest matching name wins
+		{"@Jane Smith, hello", []data.Mention{{UserID: "u2", Username: "Jane Smith", Offset: 0, Length: 11}}},
+		{"@Jane Doe", []data.Mention{{UserID: "u1", Username: "Jane", Offset: 0, Length: 5}}},
+		// Ambiguous and unknown names are ignored
+		{"@sam @nobody", []data.Mention{}},
+		// Offsets count code points
+		{"héllo @zoë @Budi", []data.Mention{
+			{UserID: "u6", Username: "Zoë", Offset: 6, Length: 4},
+			{UserID: "u3", Username: "Budi", Offset: 11, Length: 5},
+		}},
+		// An @ inside a word isn't a mention
+		{"budi@budi.com", []data.Mention{}},
+	}
+
+	for _, tt := range tests {
+		if got := Resolve(tt.content, testUsers); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Resolve(%q) = %+v, want %+v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestUserIDs(t *testing.T) {
+	mentions := Resolve("@Budi @Jane @budi", testUsers)
+	if got, want := UserIDs(mentions), []string{"u3", "u1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS users;
+
+DROP TYPE IF EXISTS major;
+DROP TYPE IF EXISTS country;
+DROP TYPE IF EXISTS degree;
+DROP TYPE IF EXISTS gender;
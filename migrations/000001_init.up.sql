@@ -0,0 +1,69 @@
+-- Baseline schema. Written idempotently so databases created from the old
+-- sql/DDL.sql can adopt the migrations without being recreated.
+
+-- Enum Definitions
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'gender') THEN
+        CREATE TYPE gender AS ENUM ('Man', 'Women');
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'degree') THEN
+        CREATE TYPE degree AS ENUM ('Diploma', 'Bachelor', 'Master', 'Doctoral');
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'country') THEN
+        CREATE TYPE country AS ENUM ('Germany', 'US', 'Malaysia', 'Australia');
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'major') THEN
+        CREATE TYPE major AS ENUM ('Art', 'Science', 'Social');
+    END IF;
+END
+$$;
+
+-- Table: Users
+CREATE TABLE IF NOT EXISTS users
+(
+    id       VARCHAR(100) PRIMARY KEY,
+    email    VARCHAR(50) UNIQUE NOT NULL,
+    username VARCHAR(100)       NOT NULL,
+    gender   gender,
+    country  country,
+    degree   degree,
+    major    major
+);
+
+-- Table: Posts
+CREATE TABLE IF NOT EXISTS posts
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    VARCHAR(100)                NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title      VARCHAR(255)                NOT NULL,
+    content    TEXT                        NOT NULL,
+    views      INT                                  DEFAULT 0,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- Creation timestamp
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()  -- Last update timestamp
+);
+
+-- Table: Comments
+CREATE TABLE IF NOT EXISTS comments
+(
+    id         SERIAL PRIMARY KEY,
+    post_id    INT                         NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id    VARCHAR(100)                NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    content    TEXT                        NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(), -- Creation timestamp
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()  -- Last update timestamp
+);
+
+-- Table: Likes
+CREATE TABLE IF NOT EXISTS likes
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    VARCHAR(100)                NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    post_id    INT                         NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Indexes used by the feed, detail and count queries
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts (user_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id);
+CREATE INDEX IF NOT EXISTS idx_likes_post_id ON likes (post_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS spam_scores;
+
+ALTER TABLE users DROP COLUMN IF EXISTS created_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS status;
+ALTER TABLE posts DROP COLUMN IF EXISTS status;
@@ -0,0 +1,24 @@
+-- Moderation status for the content filter and spam heuristics
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published'; -- 'published' or 'pending' moderation
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published'; -- 'published' or 'pending' moderation
+
+-- Account creation, used by spam heuristics
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+-- Table: Spam Scores
+CREATE TABLE IF NOT EXISTS spam_scores
+(
+    id           SERIAL PRIMARY KEY,
+    content_type VARCHAR(20)                 NOT NULL, -- 'post' or 'comment'
+    content_id   INT,                                  -- NULL when the content was rejected
+    user_id      VARCHAR(100)                NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    score        INT                         NOT NULL,
+    reasons      TEXT                        NOT NULL,
+    decision     VARCHAR(20)                 NOT NULL, -- 'allow', 'review' or 'reject'
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_spam_scores_decision ON spam_scores (decision, created_at);
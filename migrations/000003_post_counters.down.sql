@@ -0,0 +1,25 @@
+DROP INDEX IF EXISTS idx_posts_status_created_at;
+DROP INDEX IF EXISTS idx_posts_status_like_count;
+
+DROP TRIGGER IF EXISTS comments_count ON comments;
+DROP FUNCTION IF EXISTS posts_comment_count_trigger();
+
+DROP TRIGGER IF EXISTS likes_count ON likes;
+DROP FUNCTION IF EXISTS posts_like_count_trigger();
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS comment_count,
+    DROP COLUMN IF EXISTS like_count;
+
+DROP INDEX IF EXISTS idx_likes_user_id_post_id;
+
+-- Put back the duplicate likes the up migration deleted, unless their post
+-- or user is gone since
+INSERT INTO likes (id, user_id, post_id, created_at)
+SELECT backup.id, backup.user_id, backup.post_id, backup.created_at
+FROM likes_duplicates_backup backup
+WHERE EXISTS (SELECT 1 FROM posts WHERE posts.id = backup.post_id)
+  AND EXISTS (SELECT 1 FROM users WHERE users.id = backup.user_id)
+ON CONFLICT (id) DO NOTHING;
+
+DROP TABLE IF EXISTS likes_duplicates_backup;
@@ -0,0 +1,82 @@
+-- Likes are unique per user and post, which AddLike's ON CONFLICT relies on.
+-- Duplicate likes are deleted, keeping the oldest, and copied to
+-- likes_duplicates_backup first; the down migration puts them back. Drop the
+-- backup table once the upgrade is settled.
+CREATE TABLE IF NOT EXISTS likes_duplicates_backup
+(
+    id         INT                         NOT NULL,
+    user_id    VARCHAR(100)                NOT NULL,
+    post_id    INT                         NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+WITH duplicates AS (
+    DELETE FROM likes a
+        USING likes b
+    WHERE a.user_id = b.user_id
+      AND a.post_id = b.post_id
+      AND a.id > b.id
+    RETURNING a.id, a.user_id, a.post_id, a.created_at
+)
+INSERT INTO likes_duplicates_backup (id, user_id, post_id, created_at)
+SELECT id, user_id, post_id, created_at
+FROM duplicates;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_likes_user_id_post_id ON likes (user_id, post_id);
+
+-- Denormalized counters read by the feed and detail queries
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS like_count    INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS comment_count INT NOT NULL DEFAULT 0; -- Published comments only
+
+UPDATE posts
+SET like_count    = (SELECT COUNT(*) FROM likes WHERE likes.post_id = posts.id),
+    comment_count = (SELECT COUNT(*)
+                     FROM comments
+                     WHERE comments.post_id = posts.id
+                       AND comments.status = 'published');
+
+-- Keep like_count in sync with the likes table
+CREATE OR REPLACE FUNCTION posts_like_count_trigger() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE posts SET like_count = like_count + 1 WHERE id = NEW.post_id;
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE posts SET like_count = like_count - 1 WHERE id = OLD.post_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS likes_count ON likes;
+CREATE TRIGGER likes_count
+    AFTER INSERT OR DELETE
+    ON likes
+    FOR EACH ROW
+EXECUTE FUNCTION posts_like_count_trigger();
+
+-- Keep comment_count in sync with the published comments
+CREATE OR REPLACE FUNCTION posts_comment_count_trigger() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP IN ('DELETE', 'UPDATE') AND OLD.status = 'published' THEN
+        UPDATE posts SET comment_count = comment_count - 1 WHERE id = OLD.post_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.status = 'published' THEN
+        UPDATE posts SET comment_count = comment_count + 1 WHERE id = NEW.post_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS comments_count ON comments;
+CREATE TRIGGER comments_count
+    AFTER INSERT OR DELETE OR UPDATE OF status, post_id
+    ON comments
+    FOR EACH ROW
+EXECUTE FUNCTION posts_comment_count_trigger();
+
+-- Feed sort orders
+CREATE INDEX IF NOT EXISTS idx_posts_status_like_count ON posts (status, like_count, id);
+CREATE INDEX IF NOT EXISTS idx_posts_status_created_at ON posts (status, created_at, id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS notification_actors;
+DROP TABLE IF EXISTS notifications;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,31 @@
+-- Replies point at the comment they answer
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES comments (id) ON DELETE SET NULL;
+
+-- Table: Notifications
+CREATE TABLE IF NOT EXISTS notifications
+(
+    id              SERIAL PRIMARY KEY,
+    user_id         VARCHAR(100)                NOT NULL REFERENCES users (id) ON DELETE CASCADE, -- Recipient
+    type            VARCHAR(20)                 NOT NULL, -- 'comment', 'reply', 'like' or 'mention'
+    post_id         INT                         NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    comment_id      INT REFERENCES comments (id) ON DELETE SET NULL, -- Latest comment, if any
+    group_key       VARCHAR(100)                NOT NULL, -- Unread notifications sharing a key are aggregated
+    latest_actor_id VARCHAR(100)                NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    actor_count     INT                         NOT NULL DEFAULT 1,
+    read_at         TIMESTAMP(0) WITH TIME ZONE,
+    created_at      TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()  -- Latest activity
+);
+
+-- Users who contributed to an aggregated notification
+CREATE TABLE IF NOT EXISTS notification_actors
+(
+    notification_id INT                         NOT NULL REFERENCES notifications (id) ON DELETE CASCADE,
+    actor_id        VARCHAR(100)                NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at      TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (notification_id, actor_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread_group ON notifications (user_id, group_key) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_updated_at ON notifications (user_id, updated_at DESC, id DESC);
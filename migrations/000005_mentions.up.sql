@@ -0,0 +1,16 @@
+-- Table: Mentions
+CREATE TABLE IF NOT EXISTS mentions
+(
+    id           SERIAL PRIMARY KEY,
+    post_id      INT          NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    comment_id   INT REFERENCES comments (id) ON DELETE CASCADE, -- NULL for mentions in the post itself
+    user_id      VARCHAR(100) NOT NULL REFERENCES users (id) ON DELETE CASCADE, -- Mentioned user
+    start_offset INT          NOT NULL, -- Position of the @ in the content, in Unicode code points
+    length       INT          NOT NULL  -- Length including the @, in Unicode code points
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_post_id ON mentions (post_id) WHERE comment_id IS NULL;
+CREATE INDEX IF NOT EXISTS idx_mentions_comment_id ON mentions (comment_id);
+
+-- Mention lookup and autocomplete match usernames case-insensitively by prefix
+CREATE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username) text_pattern_ops);
@@ -0,0 +1,39 @@
+-- Table: Webhook Endpoints
+CREATE TABLE IF NOT EXISTS webhook_endpoints
+(
+    id          SERIAL PRIMARY KEY,
+    url         TEXT                        NOT NULL,
+    secret      VARCHAR(100)                NOT NULL, -- HMAC key signing the deliveries
+    event_types TEXT                        NOT NULL DEFAULT '', -- Comma separated, empty for every type
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Table: Outbox Events. Written in the transaction of the change they
+-- describe, so an event exists if and only if the change was committed.
+CREATE TABLE IF NOT EXISTS outbox_events
+(
+    id         SERIAL PRIMARY KEY,
+    type       VARCHAR(50)                 NOT NULL, -- e.g. 'post.created'
+    post_id    INT                         NOT NULL, -- No foreign key, events outlive deleted posts
+    payload    JSONB                       NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Table: Webhook Deliveries, one per event and subscribed endpoint
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id               SERIAL PRIMARY KEY,
+    event_id         INT                         NOT NULL REFERENCES outbox_events (id) ON DELETE CASCADE,
+    endpoint_id      INT                         NOT NULL REFERENCES webhook_endpoints (id) ON DELETE CASCADE,
+    status           VARCHAR(20)                 NOT NULL DEFAULT 'pending', -- 'pending', 'delivered' or 'dead'
+    attempts         INT                         NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_status_code INT,                                                   -- HTTP status of the last attempt
+    last_error       TEXT                        NOT NULL DEFAULT '',
+    delivered_at     TIMESTAMP(0) WITH TIME ZONE,
+    created_at       TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (event_id, endpoint_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint ON webhook_deliveries (endpoint_id, status);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_comments_parent_id;
+DROP TABLE IF EXISTS digest_preferences;
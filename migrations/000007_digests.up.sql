@@ -0,0 +1,12 @@
+-- Email digest settings. Users without a row get the weekly digest.
+CREATE TABLE IF NOT EXISTS digest_preferences
+(
+    user_id           VARCHAR(100) PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    frequency         VARCHAR(10)                 NOT NULL DEFAULT 'weekly', -- 'daily', 'weekly' or 'off'
+    unsubscribe_token VARCHAR(64)                 NOT NULL UNIQUE DEFAULT REPLACE(gen_random_uuid()::TEXT, '-', ''),
+    last_sent_at      TIMESTAMP(0) WITH TIME ZONE, -- Last digest claimed for the user
+    updated_at        TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Replies to a user's comments
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
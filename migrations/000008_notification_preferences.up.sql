@@ -0,0 +1,12 @@
+-- Channels a user gets each notification type on. Types without a row use
+-- the defaults of the service.
+CREATE TABLE IF NOT EXISTS notification_preferences
+(
+    user_id    VARCHAR(100)                NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type       VARCHAR(20)                 NOT NULL, -- 'comment', 'reply', 'like', 'mention' or 'follow'
+    in_app     BOOLEAN                     NOT NULL,
+    email      BOOLEAN                     NOT NULL,
+    push       BOOLEAN                     NOT NULL,
+    updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, type)
+);
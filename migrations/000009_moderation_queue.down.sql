@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_comments_pending;
+DROP INDEX IF EXISTS idx_spam_scores_content;
@@ -0,0 +1,3 @@
+-- Latest spam score of each pending post and comment for the moderation queue
+CREATE INDEX IF NOT EXISTS idx_spam_scores_content ON spam_scores (content_type, content_id, id);
+CREATE INDEX IF NOT EXISTS idx_comments_pending ON comments (created_at, id) WHERE status = 'pending';
@@ -0,0 +1,2 @@
+-- The backfilled accounts never had a real creation time, there is nothing to restore
+SELECT 1;
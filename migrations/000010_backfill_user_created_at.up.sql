@@ -0,0 +1,8 @@
+-- 000002 stamped the accounts that existed before it with the time it ran,
+-- which made every established user a new account for the spam heuristics.
+-- Both run in the migration's transaction, so those accounts are the ones
+-- created exactly when 000002 was applied. Move them back to 1970 so they
+-- count as old ones.
+UPDATE users
+SET created_at = '1970-01-01 00:00:00+00'
+WHERE created_at = (SELECT applied_at FROM schema_migrations WHERE version = 2);
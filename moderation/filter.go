@@ -0,0 +1,154 @@
+package moderation
+
+import (
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FilterMode decides what happens to content that contains banned words
+type FilterMode string
+
+const (
+	// FilterModeReject fails validation so the request is answered with 400
+	FilterModeReject FilterMode = "reject"
+	// FilterModeMask replaces every banned word with asterisks
+	FilterModeMask FilterMode = "mask"
+	// FilterModeQueue stores the content untouched but holds it for moderation
+	FilterModeQueue FilterMode = "queue"
+)
+
+// ValidationTag is the validator tag that runs the content filter on a field
+const ValidationTag = "clean"
+
+// ContentFilter checks user submitted text against a list of banned words
+type ContentFilter struct {
+	mode    FilterMode
+	pattern *regexp.Regexp
+}
+
+// NewContentFilter builds a filter from the built-in lists of the given
+// languages plus any extra words. Unknown languages are ignored.
+func NewContentFilter(mode FilterMode, languages []string, extraWords []string) (*ContentFilter, error) {
+	switch mode {
+	case FilterModeReject, FilterModeMask, FilterModeQueue:
+	default:
+		return nil, fmt.Errorf("unknown content filter mode: %q", mode)
+	}
+
+	// Collect the unique words in lower case
+	unique := make(map[string]struct{})
+	for _, lang := range languages {
+		for _, word := range defaultWordLists[strings.TrimSpace(strings.ToLower(lang))] {
+			unique[word] = struct{}{}
+		}
+	}
+	for _, word := range extraWords {
+		word = strings.TrimSpace(strings.ToLower(word))
+		if word != "" {
+			unique[word] = struct{}{}
+		}
+	}
+
+	filter := &ContentFilter{mode: mode}
+	if len(unique) == 0 {
+		return filter, nil
+	}
+
+	// Longest words first so "motherfucker" wins over "fucker"
+	words := make([]string, 0, len(unique))
+	for word := range unique {
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+
+	filter.pattern = regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+	return filter, nil
+}
+
+// NewContentFilterFromConfig builds a filter from the CONTENT_FILTER_* settings
+func NewContentFilterFromConfig(v *viper.Viper) (*ContentFilter, error) {
+	mode := FilterMode(v.GetString("CONTENT_FILTER_MODE"))
+	if mode == "" {
+		mode = FilterModeReject
+	}
+
+	languages := splitList(v.GetString("CONTENT_FILTER_LANGUAGES"))
+	if len(languages) == 0 {
+		languages = []string{"en", "id"}
+	}
+
+	return NewContentFilter(mode, languages, splitList(v.GetString("CONTENT_FILTER_WORDS")))
+}
+
+// Mode returns the configured filter mode
+func (f *ContentFilter) Mode() FilterMode {
+	return f.mode
+}
+
+// Contains reports whether the text has at least one banned word
+func (f *ContentFilter) Contains(text string) bool {
+	if f.pattern == nil {
+		return false
+	}
+	return f.pattern.MatchString(text)
+}
+
+// Mask replaces every banned word with asterisks of the same length
+func (f *ContentFilter) Mask(text string) string {
+	if f.pattern == nil {
+		return text
+	}
+	return f.pattern.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", len([]rune(word)))
+	})
+}
+
+// Apply runs the filter according to its mode. It returns the text to store
+// and whether the content has to be held for moderation.
+func (f *ContentFilter) Apply(text string) (string, bool) {
+	if !f.Contains(text) {
+		return text, false
+	}
+
+	switch f.mode {
+	case FilterModeMask:
+		return f.Mask(text), false
+	case FilterModeQueue:
+		return text, true
+	default:
+		// Reject mode is enforced by the validator tag
+		return text, false
+	}
+}
+
+// RegisterValidation registers the `clean` tag on the validator. In reject
+// mode the tag fails for fields containing banned words, in the other modes
+// the field passes and the handler applies the filter afterward.
+func (f *ContentFilter) RegisterValidation(v *validator.Validate) error {
+	return v.RegisterValidation(ValidationTag, func(fl validator.FieldLevel) bool {
+		if f.mode != FilterModeReject {
+			return true
+		}
+		return !f.Contains(fl.Field().String())
+	})
+}
+
+// splitList splits a comma separated setting into trimmed, non-empty values
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
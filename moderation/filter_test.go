@@ -0,0 +1,131 @@
+package moderation
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func newFilter(t *testing.T, mode FilterMode) *ContentFilter {
+	t.Helper()
+	f, err := NewContentFilter(mode, []string{"en", "ID "}, []string{" Blocked ", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestContentFilterContains(t *testing.T) {
+	f := newFilter(t, FilterModeReject)
+
+	for text, want := range map[string]bool{
+		"hello world":         false,
+		"what the FUCK":       true,
+		"dasar goblok":        true,
+		"this is blocked":     true,
+		"Shitake mushrooms":   false, // Words match on boundaries only
+		"scunthorpe united":   false,
+		"bastard, he said":    true,
+		"nothing to see here": false,
+	} {
+		if got := f.Contains(text); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestContentFilterMask(t *testing.T) {
+	f := newFilter(t, FilterModeMask)
+
+	for text, want := range map[string]string{
+		"you motherfucker":  "you ************",
+		"Fuck this, fucker": "**** this, ******",
+		"clean text":        "clean text",
+	} {
+		if got := f.Mask(text); got != want {
+			t.Errorf("Mask(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestContentFilterApply(t *testing.T) {
+	text := "well shit"
+
+	for mode, want := range map[FilterMode]struct {
+		text string
+		held bool
+	}{
+		FilterModeReject: {text, false},
+		FilterModeMask:   {"well ****", false},
+		FilterModeQueue:  {text, true},
+	} {
+		got, held := newFilter(t, mode).Apply(text)
+		if got != want.text || held != want.held {
+			t.Errorf("%s: got %q and held %v, want %q and %v", mode, got, held, want.text, want.held)
+		}
+
+		// Clean text is never touched or held
+		if got, held := newFilter(t, mode).Apply("well done"); got != "well done" || held {
+			t.Errorf("%s: clean text changed to %q, held %v", mode, got, held)
+		}
+	}
+}
+
+func TestContentFilterValidation(t *testing.T) {
+	type request struct {
+		Content string `validate:"clean"`
+	}
+
+	for mode, wantValid := range map[FilterMode]bool{
+		FilterModeReject: false,
+		FilterModeMask:   true,
+		FilterModeQueue:  true,
+	} {
+		v := validator.New()
+		if err := newFilter(t, mode).RegisterValidation(v); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Struct(request{Content: "shit happens"}); (err == nil) != wantValid {
+			t.Errorf("%s: got %v, want valid %v", mode, err, wantValid)
+		}
+		if err := v.Struct(request{Content: "it happens"}); err != nil {
+			t.Errorf("%s: clean content failed: %v", mode, err)
+		}
+	}
+}
+
+func TestNewContentFilter(t *testing.T) {
+	if _, err := NewContentFilter("drop", nil, nil); err == nil {
+		t.Fatal("unknown mode accepted")
+	}
+
+	// Without words nothing matches
+	f, err := NewContentFilter(FilterModeMask, []string{"xx"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Contains("shit") || f.Mask("shit") != "shit" {
+		t.Fatal("empty filter matched")
+	}
+}
+
+func TestNewContentFilterFromConfig(t *testing.T) {
+	v := viper.New()
+	f, err := NewContentFilterFromConfig(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Mode() != FilterModeReject || !f.Contains("shit") || !f.Contains("goblok") {
+		t.Fatal("defaults aren't reject mode with the English and Indonesian lists")
+	}
+
+	v.Set("CONTENT_FILTER_MODE", "queue")
+	v.Set("CONTENT_FILTER_LANGUAGES", "id")
+	v.Set("CONTENT_FILTER_WORDS", "spam, eggs")
+	if f, err = NewContentFilterFromConfig(v); err != nil {
+		t.Fatal(err)
+	}
+	if f.Mode() != FilterModeQueue || f.Contains("shit") || !f.Contains("goblok") || !f.Contains("green eggs") {
+		t.Fatal("settings weren't applied")
+	}
+}
@@ -0,0 +1,149 @@
+package moderation
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SpamDecision is the outcome of scoring a piece of content
+type SpamDecision string
+
+const (
+	SpamDecisionAllow  SpamDecision = "allow"
+	SpamDecisionReview SpamDecision = "review"
+	SpamDecisionReject SpamDecision = "reject"
+)
+
+// SpamConfig holds the thresholds used by the SpamScorer
+type SpamConfig struct {
+	ReviewThreshold int           // Score from which content needs moderator approval
+	RejectThreshold int           // Score from which content is refused
+	NewAccountAge   time.Duration // Accounts younger than this are considered new
+	VelocityWindow  time.Duration // Window used for duplicate and velocity checks
+	VelocityLimit   int           // Posts and comments allowed within the window
+}
+
+// SpamInput describes the content being created and its author's recent activity
+type SpamInput struct {
+	Content        string
+	AccountAge     time.Duration // Zero when unknown, which counts as an old account
+	RecentContents []string      // Posts and comments by the same user within the velocity window
+}
+
+// SpamResult is the score given to a piece of content with the reasons behind it
+type SpamResult struct {
+	Score    int
+	Reasons  []string
+	Decision SpamDecision
+}
+
+// SpamScorer scores new content with simple heuristics
+type SpamScorer struct {
+	config SpamConfig
+}
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+// NewSpamScorer creates a scorer with the given thresholds
+func NewSpamScorer(config SpamConfig) *SpamScorer {
+	return &SpamScorer{config: config}
+}
+
+// NewSpamScorerFromConfig creates a scorer from the SPAM_* settings
+func NewSpamScorerFromConfig(v *viper.Viper) *SpamScorer {
+	config := SpamConfig{
+		ReviewThreshold: 4,
+		RejectThreshold: 8,
+		NewAccountAge:   72 * time.Hour,
+		VelocityWindow:  10 * time.Minute,
+		VelocityLimit:   5,
+	}
+
+	if v.IsSet("SPAM_REVIEW_THRESHOLD") {
+		config.ReviewThreshold = v.GetInt("SPAM_REVIEW_THRESHOLD")
+	}
+	if v.IsSet("SPAM_REJECT_THRESHOLD") {
+		config.RejectThreshold = v.GetInt("SPAM_REJECT_THRESHOLD")
+	}
+	if v.IsSet("SPAM_NEW_ACCOUNT_AGE") {
+		config.NewAccountAge = v.GetDuration("SPAM_NEW_ACCOUNT_AGE")
+	}
+	if v.IsSet("SPAM_VELOCITY_WINDOW") {
+		config.VelocityWindow = v.GetDuration("SPAM_VELOCITY_WINDOW")
+	}
+	if v.IsSet("SPAM_VELOCITY_LIMIT") {
+		config.VelocityLimit = v.GetInt("SPAM_VELOCITY_LIMIT")
+	}
+
+	return NewSpamScorer(config)
+}
+
+// VelocityWindow returns how far back the author's activity should be loaded
+func (s *SpamScorer) VelocityWindow() time.Duration {
+	return s.config.VelocityWindow
+}
+
+// Score rates the content and decides whether it can be published
+func (s *SpamScorer) Score(input SpamInput) SpamResult {
+	var result SpamResult
+
+	add := func(points int, reason string) {
+		result.Score += points
+		result.Reasons = append(result.Reasons, reason)
+	}
+
+	// Account age, established users are given the benefit of the doubt
+	newAccount := input.AccountAge > 0 && input.AccountAge < s.config.NewAccountAge
+	if newAccount {
+		add(2, "new account")
+	}
+
+	// Links, weighted more heavily for new accounts
+	if links := len(linkPattern.FindAllString(input.Content, -1)); links > 0 {
+		points := links
+		if points > 3 {
+			points = 3
+		}
+		if newAccount {
+			points += 2
+		}
+		add(points, fmt.Sprintf("%d link(s)", links))
+	}
+
+	// Same content posted again recently
+	normalized := normalizeContent(input.Content)
+	duplicates := 0
+	for _, recent := range input.RecentContents {
+		if normalizeContent(recent) == normalized {
+			duplicates++
+		}
+	}
+	if duplicates > 0 {
+		add(3*duplicates, fmt.Sprintf("%d duplicate(s) of recent content", duplicates))
+	}
+
+	// Posting velocity
+	if s.config.VelocityLimit > 0 && len(input.RecentContents) >= s.config.VelocityLimit {
+		add(3, fmt.Sprintf("%d posts or comments in %s", len(input.RecentContents), s.config.VelocityWindow))
+	}
+
+	switch {
+	case s.config.RejectThreshold > 0 && result.Score >= s.config.RejectThreshold:
+		result.Decision = SpamDecisionReject
+	case s.config.ReviewThreshold > 0 && result.Score >= s.config.ReviewThreshold:
+		result.Decision = SpamDecisionReview
+	default:
+		result.Decision = SpamDecisionAllow
+	}
+
+	return result
+}
+
+// normalizeContent lowercases the text and collapses whitespace so trivial
+// edits don't hide duplicates
+func normalizeContent(content string) string {
+	return strings.Join(strings.Fields(strings.ToLower(content)), " ")
+}
@@ -0,0 +1,91 @@
+package moderation
+
+import (
+	"github.com/spf13/viper"
+	"testing"
+	"time"
+)
+
+func testScorer() *SpamScorer {
+	return NewSpamScorer(SpamConfig{
+		ReviewThreshold: 4,
+		RejectThreshold: 8,
+		NewAccountAge:   72 * time.Hour,
+		VelocityWindow:  10 * time.Minute,
+		VelocityLimit:   5,
+	})
+}
+
+func TestSpamScore(t *testing.T) {
+	old := 365 * 24 * time.Hour
+	young := time.Hour
+
+	tests := []struct {
+		name     string
+		input    SpamInput
+		score    int
+		decision SpamDecision
+	}{
+		{"plain", SpamInput{Content: "hello", AccountAge: old}, 0, SpamDecisionAllow},
+		{"unknown age", SpamInput{Content: "hello"}, 0, SpamDecisionAllow},
+		{"new account", SpamInput{Content: "hello", AccountAge: young}, 2, SpamDecisionAllow},
+		{"one link", SpamInput{Content: "see https://example.com", AccountAge: old}, 1, SpamDecisionAllow},
+		{"links are capped", SpamInput{Content: "www.a.com www.b.com www.c.com www.d.com www.e.com", AccountAge: old}, 3, SpamDecisionAllow},
+		{"link from new account", SpamInput{Content: "see https://example.com", AccountAge: young}, 5, SpamDecisionReview},
+		{
+			"duplicates",
+			SpamInput{Content: "Buy  NOW", AccountAge: old, RecentContents: []string{"buy now", "other"}},
+			3, SpamDecisionAllow,
+		},
+		{
+			"velocity",
+			SpamInput{Content: "hello", AccountAge: old, RecentContents: []string{"a", "b", "c", "d", "e"}},
+			3, SpamDecisionAllow,
+		},
+		{
+			"everything",
+			SpamInput{Content: "buy http://x.io", AccountAge: young, RecentContents: []string{"buy http://x.io", "b", "c", "d", "e"}},
+			2 + 3 + 3 + 3, SpamDecisionReject,
+		},
+	}
+
+	for _, tt := range tests {
+		result := testScorer().Score(tt.input)
+		if result.Score != tt.score || result.Decision != tt.decision {
+			t.Errorf("%s: got %d (%s) for %v, want %d (%s)", tt.name, result.Score, result.Decision, result.Reasons, tt.score, tt.decision)
+		}
+		if (result.Score > 0) != (len(result.Reasons) > 0) {
+			t.Errorf("%s: score %d with reasons %v", tt.name, result.Score, result.Reasons)
+		}
+	}
+}
+
+func TestSpamScoreWithoutThresholds(t *testing.T) {
+	scorer := NewSpamScorer(SpamConfig{NewAccountAge: time.Hour})
+
+	result := scorer.Score(SpamInput{Content: "https://a.io https://b.io https://c.io", AccountAge: time.Minute})
+	if result.Decision != SpamDecisionAllow {
+		t.Fatalf("got %s with score %d, want allow when thresholds are off", result.Decision, result.Score)
+	}
+}
+
+func TestNewSpamScorerFromConfig(t *testing.T) {
+	v := viper.New()
+	if got := NewSpamScorerFromConfig(v).config; got != testScorer().config {
+		t.Fatalf("got defaults %+v, want %+v", got, testScorer().config)
+	}
+
+	v.Set("SPAM_REVIEW_THRESHOLD", 2)
+	v.Set("SPAM_REJECT_THRESHOLD", 0)
+	v.Set("SPAM_NEW_ACCOUNT_AGE", "24h")
+	v.Set("SPAM_VELOCITY_WINDOW", "1m")
+	v.Set("SPAM_VELOCITY_LIMIT", 2)
+	want := SpamConfig{ReviewThreshold: 2, NewAccountAge: 24 * time.Hour, VelocityWindow: time.Minute, VelocityLimit: 2}
+	scorer := NewSpamScorerFromConfig(v)
+	if scorer.config != want {
+		t.Fatalf("got %+v, want %+v", scorer.config, want)
+	}
+	if scorer.VelocityWindow() != time.Minute {
+		t.Fatalf("got velocity window %s, want 1m", scorer.VelocityWindow())
+	}
+}
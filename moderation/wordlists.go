@@ -0,0 +1,38 @@
+package moderation
+
+// defaultWordLists holds the built-in banned words grouped by language code.
+// Words are matched case-insensitively on word boundaries, so only the base
+// form needs to be listed here.
+var defaultWordLists = map[string][]string{
+	// English
+	"en": {
+		"asshole",
+		"bastard",
+		"bitch",
+		"bullshit",
+		"cunt",
+		"dick",
+		"fuck",
+		"fucker",
+		"fucking",
+		"motherfucker",
+		"shit",
+		"slut",
+		"whore",
+	},
+	// Indonesian
+	"id": {
+		"anjing",
+		"bajingan",
+		"bangsat",
+		"brengsek",
+		"goblok",
+		"jancok",
+		"kampret",
+		"kontol",
+		"memek",
+		"ngentot",
+		"perek",
+		"tolol",
+	},
+}
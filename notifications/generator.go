@@ -0,0 +1,147 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+)
+
+// Generator decides who hears about activity on posts and comments and
+// records their notifications. Pass it the models of the transaction making
+// the change so notifications are stored atomically with it.
+type Generator struct{}
+
+func NewGenerator() *Generator {
+	return &Generator{}
+}
+
+// PostLiked notifies the post author. Likes of a post are aggregated into
+// one unread notification.
+func (g *Generator) PostLiked(ctx context.Context, models *data.Models, postID uint, actorID string) error {
+	post, err := models.Post.GetPostByID(ctx, postID)
+	if err != nil {
+		return err
+	}
+
+	_, err = g.notify(ctx, models, &data.NewNotification{
+		UserID:   post.UserID,
+		Type:     data.NotificationLike,
+		PostID:   postID,
+		GroupKey: fmt.Sprintf("like:post:%d", postID),
+		ActorID:  actorID,
+	})
+	return err
+}
+
+// CommentCreated notifies the author of the parent comment of a reply and the
+// post author of a new comment, and returns the notified users. Someone who
+// is both hears about the reply only, or about the comment if they turned
+// replies off.
+func (g *Generator) CommentCreated(ctx context.Context, models *data.Models, comment *data.Comment) ([]string, error) {
+	var notified []string
+
+	if comment.ParentID != nil {
+		parent, err := models.Comment.GetCommentByID(ctx, *comment.ParentID)
+		if err != nil {
+			return nil, err
+		}
+
+		ok, err := g.notify(ctx, models, &data.NewNotification{
+			UserID:    parent.UserID,
+			Type:      data.NotificationReply,
+			PostID:    comment.PostID,
+			CommentID: comment.ID,
+			GroupKey:  fmt.Sprintf("reply:comment:%d", parent.ID),
+			ActorID:   comment.UserID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			notified = append(notified, parent.UserID)
+		}
+	}
+
+	post, err := models.Post.GetPostByID(ctx, comment.PostID)
+	if err != nil {
+		return nil, err
+	}
+	if contains(notified, post.UserID) {
+		return notified, nil
+	}
+
+	ok, err := g.notify(ctx, models, &data.NewNotification{
+		UserID:    post.UserID,
+		Type:      data.NotificationComment,
+		PostID:    comment.PostID,
+		CommentID: comment.ID,
+		GroupKey:  fmt.Sprintf("comment:post:%d", comment.PostID),
+		ActorID:   comment.UserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		notified = append(notified, post.UserID)
+	}
+	return notified, nil
+}
+
+// Mentioned notifies users mentioned in a post, or in a comment when
+// commentID isn't 0. Users in skip, typically those already notified about
+// the same content, are left out.
+func (g *Generator) Mentioned(ctx context.Context, models *data.Models, postID uint, commentID uint, userIDs []string, actorID string, skip []string) error {
+	groupKey := fmt.Sprintf("mention:post:%d", postID)
+	if commentID != 0 {
+		groupKey = fmt.Sprintf("mention:comment:%d", commentID)
+	}
+
+	for _, userID := range userIDs {
+		if contains(skip, userID) {
+			continue
+		}
+		_, err := g.notify(ctx, models, &data.NewNotification{
+			UserID:    userID,
+			Type:      data.NotificationMention,
+			PostID:    postID,
+			CommentID: commentID,
+			GroupKey:  groupKey,
+			ActorID:   actorID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notify records the notification unless users would be told about their
+// own activity or turned the type off in the app, and reports whether it was
+// recorded
+func (g *Generator) notify(ctx context.Context, models *data.Models, notification *data.NewNotification) (bool, error) {
+	if notification.UserID == "" || notification.UserID == notification.ActorID {
+		return false, nil
+	}
+
+	preferences, err := models.Notification.GetNotificationPreferences(ctx, notification.UserID)
+	if err != nil {
+		return false, err
+	}
+	if !preferences.Enabled(notification.Type, data.ChannelInApp) {
+		return false, nil
+	}
+
+	if err := models.Notification.CreateNotification(ctx, notification); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Ahmad-mufied/iducate-community-service/events"
+	"github.com/gorilla/websocket"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// TypeTyping is sent by clients while they write a comment and relayed to
+// the other subscribers of the post
+const TypeTyping = "typing"
+
+// ErrTooManyConnections is returned by Reserve when the user already has the
+// maximum number of open connections
+var ErrTooManyConnections = errors.New("too many open connections")
+
+// relayedTypes are the bus events forwarded to the thread subscribers
+var relayedTypes = map[string]bool{
+	events.TypeCommentCreated: true,
+	events.TypeCommentUpdated: true,
+	events.TypeCommentDeleted: true,
+	events.TypePostDeleted:    true,
+}
+
+const (
+	// maxMessageSize bounds what clients may send, they only send typing
+	maxMessageSize = 512
+	// typingInterval throttles the typing indicators of one connection
+	typingInterval = time.Second
+)
+
+// Config tunes the hub
+type Config struct {
+	// MaxConnectionsPerUser caps the open connections of one user, 0 disables
+	MaxConnectionsPerUser int
+	// SendBuffer is how many messages may queue for a connection before it is
+	// considered too slow and disconnected
+	SendBuffer int
+	// PingInterval is how often idle connections are pinged, a connection
+	// not answering within twice the interval is closed
+	PingInterval time.Duration
+	// WriteTimeout bounds every write to a connection
+	WriteTimeout time.Duration
+}
+
+// Hub keeps the WebSocket connections of live comment threads, grouped by
+// post. Comment events are taken from the event bus, typing indicators are
+// relayed between the connections of the same post.
+type Hub struct {
+	bus    *events.Bus
+	config Config
+
+	mu          sync.Mutex
+	rooms       map[uint]*room
+	connections map[string]int // Open connections per user
+	closed      bool
+}
+
+// room holds the connections subscribed to one post
+type room struct {
+	postID  uint
+	clients map[*client]struct{}
+	sub     *events.Subscription
+}
+
+type client struct {
+	hub      *Hub
+	room     *room
+	conn     *websocket.Conn
+	userID   string
+	username string
+	send     chan []byte
+	done     chan struct{}
+	once     sync.Once
+}
+
+// typingPayload is the data of a typing event
+type typingPayload struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// NewHub creates a hub relaying the events of bus
+func NewHub(bus *events.Bus, config Config) *Hub {
+	if config.SendBuffer < 1 {
+		config.SendBuffer = 16
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = 30 * time.Second
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = 10 * time.Second
+	}
+	return &Hub{
+		bus:         bus,
+		config:      config,
+		rooms:       make(map[uint]*room),
+		connections: make(map[string]int),
+	}
+}
+
+// Reserve claims a connection slot for userID before the upgrade. The slot
+// is given back when Serve returns, or by Release if the upgrade fails.
+func (h *Hub) Reserve(userID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.config.MaxConnectionsPerUser > 0 && h.connections[userID] >= h.config.MaxConnectionsPerUser {
+		return ErrTooManyConnections
+	}
+	h.connections[userID]++
+	return nil
+}
+
+// Release gives back a slot claimed by Reserve
+func (h *Hub) Release(userID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.releaseLocked(userID)
+}
+
+func (h *Hub) releaseLocked(userID string) {
+	h.connections[userID]--
+	if h.connections[userID] <= 0 {
+		delete(h.connections, userID)
+	}
+}
+
+// Serve subscribes conn to the thread of postID and blocks until the
+// connection ends. The slot reserved for userID is released on return.
+func (h *Hub) Serve(conn *websocket.Conn, postID uint, userID string, username string) {
+	c := &client{
+		hub:      h,
+		conn:     conn,
+		userID:   userID,
+		username: username,
+		send:     make(chan []byte, h.config.SendBuffer),
+		done:     make(chan struct{}),
+	}
+
+	if !h.join(c, postID) {
+		h.Release(userID)
+		c.closeWith(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+
+	go c.writeLoop()
+	c.readLoop()
+
+	h.leave(c)
+	c.close()
+}
+
+func (h *Hub) join(c *client, postID uint) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return false
+	}
+
+	r, ok := h.rooms[postID]
+	if !ok {
+		sub, _, _ := h.bus.Subscribe(events.ForPost(postID), "", h.config.SendBuffer)
+		r = &room{postID: postID, clients: make(map[*client]struct{}), sub: sub}
+		h.rooms[postID] = r
+		go h.relay(r)
+	}
+
+	c.room = r
+	r.clients[c] = struct{}{}
+	return true
+}
+
+func (h *Hub) leave(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r := c.room
+	if _, ok := r.clients[c]; !ok {
+		return
+	}
+	delete(r.clients, c)
+	h.releaseLocked(c.userID)
+
+	// A room dropped by relay may already have been replaced
+	if len(r.clients) == 0 {
+		if h.rooms[r.postID] == r {
+			delete(h.rooms, r.postID)
+		}
+		r.sub.Close()
+	}
+}
+
+// relay forwards the comment events of a post to its connections until the
+// subscription ends
+func (h *Hub) relay(r *room) {
+	for event := range r.sub.C {
+		if !relayedTypes[event.Type] {
+			continue
+		}
+		message, err := json.Marshal(event)
+		if err != nil {
+			slog.Error("Failed to encode event", "type", event.Type, "error", err)
+			continue
+		}
+		h.broadcast(r, nil, message)
+	}
+
+	// The bus shut down or dropped the room for lagging behind, the clients
+	// reconnect and resubscribe. Later joins open a new room with a new
+	// subscription.
+	h.mu.Lock()
+	if h.rooms[r.postID] == r {
+		delete(h.rooms, r.postID)
+	}
+	clients := make([]*client, 0, len(r.clients))
+	for c := range r.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+	for _, c := range clients {
+		c.closeWith(websocket.CloseTryAgainLater, "event stream interrupted")
+	}
+}
+
+// broadcast queues message for every connection of the room except sender.
+// Connections whose queue is full are disconnected instead of slowing down
+// the others.
+func (h *Hub) broadcast(r *room, sender *client, message []byte) {
+	h.mu.Lock()
+	var slow []*client
+	for c := range r.clients {
+		if c == sender {
+			continue
+		}
+		select {
+		case c.send <- message:
+		default:
+			slow = append(slow, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range slow {
+		c.closeWith(websocket.CloseTryAgainLater, "too slow")
+	}
+}
+
+// Close disconnects every connection. Hijacked connections are not tracked
+// by the HTTP server, so this must run before it shuts down.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	var clients []*client
+	for _, r := range h.rooms {
+		for c := range r.clients {
+			clients = append(clients, c)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+// readLoop handles the messages of the client until the connection fails
+func (c *client) readLoop() {
+	pongWait := 2 * c.hub.config.PingInterval
+	c.conn.SetReadLimit(maxMessageSize)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	var lastTyping time.Time
+	for {
+		var message struct {
+			Type string `json:"type"`
+		}
+		if err := c.conn.ReadJSON(&message); err != nil {
+			// Skip malformed messages, the connection is still usable
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				continue
+			}
+			return
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		if message.Type != TypeTyping || time.Since(lastTyping) < typingInterval {
+			continue
+		}
+		lastTyping = time.Now()
+
+		payload, _ := json.Marshal(typingPayload{UserID: c.userID, Username: c.username})
+		event, err := json.Marshal(events.Event{
+			Type:      TypeTyping,
+			PostID:    c.room.postID,
+			Data:      payload,
+			CreatedAt: lastTyping,
+		})
+		if err != nil {
+			continue
+		}
+		c.hub.broadcast(c.room, c, event)
+	}
+}
+
+// writeLoop sends queued messages and pings until the client is closed
+func (c *client) writeLoop() {
+	ping := time.NewTicker(c.hub.config.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case message := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				c.close()
+				return
+			}
+		case <-ping.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.hub.config.WriteTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// closeWith sends a close frame with the given code and closes the connection
+func (c *client) closeWith(code int, reason string) {
+	deadline := time.Now().Add(c.hub.config.WriteTimeout)
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	c.close()
+}
+
+// close ends the connection, which also stops the read and write loops
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
@@ -0,0 +1,196 @@
+package realtime
+
+import (
+	"encoding/json"
+	"github.com/Ahmad-mufied/iducate-community-service/events"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPostID = 1
+
+// serve starts a server joining every connection to the thread of testPostID
+// as the user named in the user query parameter
+func serve(t *testing.T, h *Hub) *httptest.Server {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.URL.Query().Get("user")
+		if err := h.Reserve(userID); err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			h.Release(userID)
+			return
+		}
+		h.Serve(conn, testPostID, userID, strings.ToUpper(userID))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dial(t *testing.T, server *httptest.Server, userID string) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "?user=" + userID
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitFor polls condition under the hub lock until it holds
+func waitFor(t *testing.T, h *Hub, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		h.mu.Lock()
+		ok := condition()
+		h.mu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met in time")
+}
+
+// readEvent reads the next event sent to conn
+func readEvent(t *testing.T, conn *websocket.Conn) events.Event {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var event events.Event
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestHubRelaysCommentEvents(t *testing.T) {
+	bus := events.NewBus(10)
+	h := NewHub(bus, Config{})
+	server := serve(t, h)
+
+	conn := dial(t, server, "alice")
+	waitFor(t, h, func() bool { return h.rooms[testPostID] != nil })
+
+	// Only comment events of the post are relayed
+	_ = bus.Publish(events.TypeLikesUpdated, testPostID, map[string]int{"like_count": 1})
+	_ = bus.Publish(events.TypeCommentCreated, testPostID+1, map[string]string{"content": "elsewhere"})
+	_ = bus.Publish(events.TypeCommentCreated, testPostID, map[string]string{"content": "hello"})
+
+	event := readEvent(t, conn)
+	if event.Type != events.TypeCommentCreated || event.PostID != testPostID {
+		t.Fatalf("got %s of post %d, want %s of post %d", event.Type, event.PostID, events.TypeCommentCreated, testPostID)
+	}
+}
+
+func TestHubRelaysTypingToOthers(t *testing.T) {
+	h := NewHub(events.NewBus(10), Config{})
+	server := serve(t, h)
+
+	alice := dial(t, server, "alice")
+	bob := dial(t, server, "bob")
+	waitFor(t, h, func() bool { return h.rooms[testPostID] != nil && len(h.rooms[testPostID].clients) == 2 })
+
+	if err := alice.WriteJSON(map[string]string{"type": TypeTyping}); err != nil {
+		t.Fatal(err)
+	}
+
+	event := readEvent(t, bob)
+	var payload typingPayload
+	if err := json.Unmarshal(event.Data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != TypeTyping || payload.UserID != "alice" || payload.Username != "ALICE" {
+		t.Fatalf("got %s from %+v, want typing from alice", event.Type, payload)
+	}
+
+	// The sender doesn't get its own indicator
+	_ = alice.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := alice.ReadMessage(); err == nil {
+		t.Fatal("sender received its own typing indicator")
+	}
+}
+
+func TestHubLimitsConnectionsPerUser(t *testing.T) {
+	h := NewHub(events.NewBus(10), Config{MaxConnectionsPerUser: 1})
+
+	if err := h.Reserve("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Reserve("alice"); err != ErrTooManyConnections {
+		t.Fatalf("got %v, want ErrTooManyConnections", err)
+	}
+	if err := h.Reserve("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Release("alice")
+	if err := h.Reserve("alice"); err != nil {
+		t.Fatalf("slot not given back: %v", err)
+	}
+}
+
+func TestHubResubscribesDroppedRoom(t *testing.T) {
+	bus := events.NewBus(10)
+	h := NewHub(bus, Config{})
+	server := serve(t, h)
+
+	// A client that stays in the room until the hub closes it, its connection
+	// goes to a server that only reads
+	upgrader := websocket.Upgrader{}
+	idle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(idle.Close)
+
+	_ = h.Reserve("stale")
+	stale := &client{hub: h, conn: dial(t, idle, "stale"), userID: "stale", send: make(chan []byte, 1), done: make(chan struct{})}
+	if !h.join(stale, testPostID) {
+		t.Fatal("hub refused to join")
+	}
+	h.mu.Lock()
+	dropped := h.rooms[testPostID]
+	h.mu.Unlock()
+
+	// The bus drops lagging subscriptions the same way
+	dropped.sub.Close()
+	select {
+	case <-stale.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("clients of the dropped room weren't closed")
+	}
+
+	// Joining afterwards subscribes again instead of landing in the dead room
+	conn := dial(t, server, "alice")
+	waitFor(t, h, func() bool {
+		r := h.rooms[testPostID]
+		return r != nil && r != dropped && len(r.clients) == 1
+	})
+
+	_ = bus.Publish(events.TypeCommentCreated, testPostID, map[string]string{"content": "hello"})
+	if event := readEvent(t, conn); event.Type != events.TypeCommentCreated {
+		t.Fatalf("got %s, want %s", event.Type, events.TypeCommentCreated)
+	}
+}
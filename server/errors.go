@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/logging"
+	"github.com/Ahmad-mufied/iducate-community-service/utils"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"net/http"
+)
+
+// HTTPErrorHandler writes every error returned by handlers and middlewares
+// as a utils.APIError carrying the request ID. Unknown errors are answered
+// with a generic 500 so database details never reach the client, the request
+// logger records the cause.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	ctx := c.Request().Context()
+	apiErr := toAPIError(err).WithRequestID(logging.RequestID(ctx))
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(apiErr.Code)
+	} else {
+		err = c.JSON(apiErr.Code, apiErr)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to write error response", "error", err)
+	}
+}
+
+// toAPIError maps an error to the response envelope
+func toAPIError(err error) *utils.APIError {
+	var apiErr *utils.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		return constants.ErrNotFound.WithDetail(err.Error())
+	case errors.Is(err, data.ErrForbidden):
+		return constants.ErrForbidden.WithDetail(err.Error())
+	case errors.Is(err, data.ErrConflict):
+		return constants.ErrConflict.WithDetail(err.Error())
+	}
+
+	// Errors raised by Echo itself, e.g. unknown routes or bind failures
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		if httpErr.Code >= http.StatusInternalServerError {
+			return constants.ErrInternalServerError
+		}
+		message := http.StatusText(httpErr.Code)
+		if msg, ok := httpErr.Message.(string); ok {
+			message = msg
+		}
+		return utils.NewAPIError(httpErr.Code, errorCodeFromStatus(httpErr.Code), message, nil)
+	}
+
+	return constants.ErrInternalServerError
+}
+
+// errorCodeFromStatus derives a machine-readable code from an HTTP status,
+// e.g. 405 becomes "method_not_allowed"
+func errorCodeFromStatus(status int) string {
+	code := []rune(http.StatusText(status))
+	for i, r := range code {
+		switch {
+		case r == ' ' || r == '-':
+			code[i] = '_'
+		case r >= 'A' && r <= 'Z':
+			code[i] = r + ('a' - 'A')
+		}
+	}
+	return string(code)
+}
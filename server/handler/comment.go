@@ -1,113 +1,342 @@
 package handler
 
 import (
-	"database/sql"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/events"
+	"github.com/Ahmad-mufied/iducate-community-service/mentions"
+	"github.com/Ahmad-mufied/iducate-community-service/metrics"
+	"github.com/Ahmad-mufied/iducate-community-service/moderation"
 	"github.com/Ahmad-mufied/iducate-community-service/server/middlewares"
 	"github.com/Ahmad-mufied/iducate-community-service/utils"
+	"github.com/Ahmad-mufied/iducate-community-service/webhooks"
 	"github.com/labstack/echo/v4"
-	"log"
+	"github.com/xeonx/timeago"
 	"net/http"
 	"strconv"
 )
 
-func GetUpdatedCommentCountHandler(c echo.Context) error {
+func (h *Handler) GetUpdatedCommentCountHandler(c echo.Context) error {
 	// Get the post ID from the request parameters
 	postIDParam := c.Param("post_id")
 	postID, err := strconv.Atoi(postIDParam)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post ID"})
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
 	}
 
 	// Use the request's context
 	ctx := c.Request().Context()
 
 	// Fetch the updated comment count for the post
-	count, err := entity.Comment.GetCommentCount(ctx, postID)
+	count, err := h.models.Comment.GetCommentCount(ctx, postID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return err
 	}
 
 	// Return the updated comment count as a JSON response
 	return c.JSON(http.StatusOK, map[string]int{"comment_count": count})
 }
 
-func DeleteCommentHandler(c echo.Context) error {
+func (h *Handler) DeleteCommentHandler(c echo.Context) error {
 	userID := middlewares.GetUserID(c)
 
 	// Parse comment ID from URL parameter
 	commentIDParam := c.Param("id")
 	commentID, err := strconv.Atoi(commentIDParam)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid comment ID"})
+		return constants.ErrBadRequest.WithDetail("Invalid comment ID")
 	}
 
 	// Use the request's context
 	ctx := c.Request().Context()
 
-	// Attempt to delete the comment
-	err = entity.Comment.DeleteComment(ctx, uint(commentID), userID)
-	if err != nil {
-		if err.Error() == "comment not found" {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Comment not found"})
+	// Delete the comment and tell the webhook endpoints together
+	var comment *data.Comment
+	err = h.models.WithTx(ctx, func(tx *data.Models) error {
+		var err error
+		comment, err = tx.Comment.DeleteComment(ctx, uint(commentID), userID)
+		if err != nil {
+			return err
 		}
-		if err.Error() == "unauthorized: you are not the owner of this comment" {
-			return c.JSON(http.StatusForbidden, map[string]string{"error": "You are not authorized to delete this comment"})
+
+		// Comments held for moderation were never announced
+		if comment.Status != data.StatusPublished {
+			return nil
 		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypeCommentDeleted, comment.PostID, commentDeletedPayload(comment))
+	})
+	if err != nil {
+		return err
+	}
+
+	if comment.Status == data.StatusPublished {
+		h.publish(events.TypeCommentDeleted, comment.PostID, map[string]interface{}{
+			"comment_id":    comment.ID,
+			"comment_count": h.commentCount(ctx, comment.PostID),
+		})
 	}
 
 	// Return success message
 	return c.JSON(http.StatusOK, map[string]string{"message": "Comment deleted successfully"})
 }
 
-func CreateCommentHandler(c echo.Context) error {
+func (h *Handler) UpdateCommentHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	// Parse comment ID from URL parameter
+	commentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid comment ID")
+	}
+
+	// Parse content from request body
+	var req = new(data.UpdateCommentRequest)
+	if err := c.Bind(req); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid request body")
+	}
+	req.CommentID = uint(commentID)
+	req.UserID = userID
+
+	// Validate
+	err = h.validate.Struct(req)
+	if err != nil {
+		// Format the validation errors
+		return utils.NewValidationError(utils.FormatValidationErrors(err))
+	}
+
+	// Mask banned words or hold the edited comment for moderation
+	var queued bool
+	req.Content, queued = h.contentFilter.Apply(req.Content)
+	if queued {
+		req.Status = data.StatusPending
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	current, err := h.models.Comment.GetCommentByID(ctx, req.CommentID)
+	if err != nil {
+		return err
+	}
+	if current.UserID != userID {
+		return constants.ErrForbidden.WithDetail("you are not the owner of this comment")
+	}
+
+	// Score the edit for spam like a new comment. A rejected edit leaves the
+	// comment as it was.
+	spam, err := h.scoreSpam(ctx, userID, req.Content, current.Content)
+	if err != nil {
+		return err
+	}
+	if spam.Decision == moderation.SpamDecisionReject {
+		if err := h.recordSpamScore(ctx, h.models, data.ContentTypeComment, current.ID, userID, spam); err != nil {
+			return err
+		}
+		return constants.ErrSpamRejected
+	}
+	if spam.Decision == moderation.SpamDecisionReview {
+		req.Status = data.StatusPending
+	}
+
+	// Published comments held because of the edit are gone for the endpoints
+	// and the live clients
+	withdrawn := current.Status == data.StatusPublished && req.Status == data.StatusPending
+
+	// Update the comment, its spam score and its mentions and notify the newly
+	// mentioned users and the webhook endpoints atomically
+	var comment *data.Comment
+	var commentMentions []data.Mention
+	err = h.models.WithTx(ctx, func(tx *data.Models) error {
+		var err error
+		comment, err = tx.Comment.UpdateComment(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		if err := h.recordSpamScore(ctx, tx, data.ContentTypeComment, comment.ID, userID, spam); err != nil {
+			return err
+		}
+
+		var previous []string
+		commentMentions, previous, err = h.saveMentions(ctx, tx, comment.PostID, comment.ID, comment.Content)
+		if err != nil {
+			return err
+		}
+
+		// Comments held for or turned down by a moderator aren't announced
+		if comment.Status != data.StatusPublished {
+			if withdrawn {
+				return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypeCommentDeleted, comment.PostID, commentDeletedPayload(comment))
+			}
+			return nil
+		}
+
+		// Users mentioned before the edit were told already
+		if err := h.notifier.Mentioned(ctx, tx, comment.PostID, comment.ID, mentions.UserIDs(commentMentions), userID, previous); err != nil {
+			return err
+		}
+		return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypeCommentUpdated, comment.PostID, commentPayload(comment))
+	})
+	if err != nil {
+		return err
+	}
+
+	response := data.CommentResponse{
+		ID:        comment.ID,
+		ParentID:  comment.ParentID,
+		Username:  middlewares.GetUsername(c),
+		Content:   comment.Content,
+		CreatedAt: timeago.English.Format(comment.CreatedAt),
+		Mentions:  commentMentions,
+	}
+
+	// Comments waiting for moderation or rejected are accepted but not visible
+	if comment.Status != data.StatusPublished {
+		if withdrawn {
+			h.publish(events.TypeCommentDeleted, comment.PostID, map[string]interface{}{
+				"comment_id":    comment.ID,
+				"comment_count": h.commentCount(ctx, comment.PostID),
+			})
+		}
+		return c.JSON(http.StatusAccepted, response)
+	}
+
+	h.publish(events.TypeCommentUpdated, comment.PostID, map[string]interface{}{
+		"comment": response,
+	})
+
+	// Return the updated comment as JSON
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) CreateCommentHandler(c echo.Context) error {
 
 	userID := middlewares.GetUserID(c)
 
 	// Parse post ID from URL parameter
 	postIDParam := c.Param("post_id")
-	log.Println(postIDParam)
 	postID, err := strconv.Atoi(postIDParam)
-	log.Println(postID)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post ID"})
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
 	}
 
-	// Parse user ID and content from request body
-	type RequestBody struct {
-		Content string `json:"content" validate:"required"`
-	}
-	var body RequestBody
-	if err := c.Bind(&body); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	// Parse content from request body
+	var req = new(data.CreateCommentRequest)
+	if err := c.Bind(req); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid request body")
 	}
+	req.PostID = uint(postID)
+	req.UserID = userID
 
 	// Validate
-	err = validate.Struct(body)
+	err = h.validate.Struct(req)
 	if err != nil {
 		// Format the validation errors
-		errors := utils.FormatValidationErrors(err)
-		return utils.HandleValidationError(c, errors)
+		return utils.NewValidationError(utils.FormatValidationErrors(err))
+	}
+
+	// Mask banned words or hold the comment for moderation
+	var queued bool
+	req.Content, queued = h.contentFilter.Apply(req.Content)
+	if queued {
+		req.Status = data.StatusPending
 	}
 
 	// Use the request's context
 	ctx := c.Request().Context()
 
-	// Create the comment
-	comment, err := entity.Comment.CreateComment(ctx, uint(postID), userID, body.Content)
+	// Score the comment for spam before saving it
+	spam, err := h.scoreSpam(ctx, userID, req.Content, "")
 	if err != nil {
-		if err.Error() == "post not found" {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
+		return err
+	}
+	if spam.Decision == moderation.SpamDecisionReject {
+		if err := h.recordSpamScore(ctx, h.models, data.ContentTypeComment, 0, userID, spam); err != nil {
+			return err
 		}
-		if err.Error() == "user not found" {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		return constants.ErrSpamRejected
+	}
+	if spam.Decision == moderation.SpamDecisionReview {
+		req.Status = data.StatusPending
+	}
+
+	// Check the post and user, insert the comment, store its spam score and
+	// mentions and notify the post and parent comment authors, the mentioned
+	// users and the webhook endpoints atomically
+	var comment data.CommentResponse
+	err = h.models.WithTx(ctx, func(tx *data.Models) error {
+		var err error
+		comment, err = tx.Comment.CreateComment(ctx, req)
+		if err != nil {
+			return err
 		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+
+		if err := h.recordSpamScore(ctx, tx, data.ContentTypeComment, comment.ID, userID, spam); err != nil {
+			return err
+		}
+
+		comment.Mentions, _, err = h.saveMentions(ctx, tx, req.PostID, comment.ID, req.Content)
+		if err != nil {
+			return err
+		}
+
+		// Comments held for moderation aren't announced
+		if req.Status == data.StatusPending {
+			return nil
+		}
+		created := &data.Comment{
+			ID:       comment.ID,
+			PostID:   req.PostID,
+			UserID:   userID,
+			ParentID: req.ParentID,
+			Content:  comment.Content,
+		}
+		notified, err := h.notifier.CommentCreated(ctx, tx, created)
+		if err != nil {
+			return err
+		}
+
+		// Authors told about the comment already don't hear about the mention
+		if err := h.notifier.Mentioned(ctx, tx, req.PostID, comment.ID, mentions.UserIDs(comment.Mentions), userID, notified); err != nil {
+			return err
+		}
+		return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypeCommentCreated, req.PostID, commentPayload(created))
+	})
+	if err != nil {
+		return err
+	}
+	metrics.CommentsCreated.Inc()
+
+	// Comments waiting for moderation are accepted but not yet visible
+	if req.Status == data.StatusPending {
+		return c.JSON(http.StatusAccepted, comment)
 	}
 
+	h.publish(events.TypeCommentCreated, req.PostID, map[string]interface{}{
+		"comment":       comment,
+		"comment_count": h.commentCount(ctx, req.PostID),
+	})
+
 	// Return the created comment as JSON
 	return c.JSON(http.StatusCreated, comment)
 }
+
+// commentPayload is the webhook data of a created or updated comment
+func commentPayload(comment *data.Comment) map[string]interface{} {
+	return map[string]interface{}{
+		"comment_id": comment.ID,
+		"post_id":    comment.PostID,
+		"user_id":    comment.UserID,
+		"parent_id":  comment.ParentID,
+		"content":    comment.Content,
+	}
+}
+
+// commentDeletedPayload is the webhook data of a deleted comment
+func commentDeletedPayload(comment *data.Comment) map[string]interface{} {
+	return map[string]interface{}{
+		"comment_id": comment.ID,
+		"post_id":    comment.PostID,
+		"user_id":    comment.UserID,
+	}
+}
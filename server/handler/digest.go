@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/digest"
+	"github.com/Ahmad-mufied/iducate-community-service/server/middlewares"
+	"github.com/Ahmad-mufied/iducate-community-service/utils"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+func (h *Handler) GetDigestPreferenceHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	preference, err := h.models.Digest.GetDigestPreference(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, preference)
+}
+
+func (h *Handler) UpdateDigestPreferenceHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	var req = new(data.UpdateDigestPreferenceRequest)
+	if err := c.Bind(req); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid request body")
+	}
+
+	// Validate
+	err := h.validate.Struct(req)
+	if err != nil {
+		// Format the validation errors
+		return utils.NewValidationError(utils.FormatValidationErrors(err))
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	if err := h.models.Digest.UpdateDigestPreference(ctx, userID, req.Frequency); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, data.DigestPreference{Frequency: req.Frequency})
+}
+
+// UnsubscribePageHandler asks for confirmation, so link scanners opening the
+// unsubscribe link don't unsubscribe anyone
+func (h *Handler) UnsubscribePageHandler(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return constants.ErrBadRequest.WithDetail("Missing token")
+	}
+
+	page, err := digest.UnsubscribePage(token, false)
+	if err != nil {
+		return err
+	}
+	return c.HTML(http.StatusOK, page)
+}
+
+// UnsubscribeDigestHandler serves both the confirmation form and one-click
+// unsubscribe requests from mail clients
+func (h *Handler) UnsubscribeDigestHandler(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return constants.ErrBadRequest.WithDetail("Missing token")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	if err := h.models.Digest.UnsubscribeDigest(ctx, token); err != nil {
+		return err
+	}
+
+	page, err := digest.UnsubscribePage(token, true)
+	if err != nil {
+		return err
+	}
+	return c.HTML(http.StatusOK, page)
+}
@@ -2,13 +2,35 @@ package handler
 
 import (
 	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/events"
+	"github.com/Ahmad-mufied/iducate-community-service/moderation"
+	"github.com/Ahmad-mufied/iducate-community-service/notifications"
+	"github.com/Ahmad-mufied/iducate-community-service/realtime"
+	"github.com/Ahmad-mufied/iducate-community-service/views"
 	"github.com/go-playground/validator/v10"
 )
 
-var entity *data.Models
-var validate *validator.Validate
+// Handler holds the dependencies shared by the HTTP handlers
+type Handler struct {
+	models        *data.Models
+	validate      *validator.Validate
+	contentFilter *moderation.ContentFilter
+	spamScorer    *moderation.SpamScorer
+	views         *views.Counter
+	events        *events.Bus
+	live          *realtime.Hub
+	notifier      *notifications.Generator
+}
 
-func InitHandler(m *data.Models, v *validator.Validate) {
-	entity = m
-	validate = v
+func New(m *data.Models, v *validator.Validate, f *moderation.ContentFilter, s *moderation.SpamScorer, vc *views.Counter, b *events.Bus, lh *realtime.Hub) *Handler {
+	return &Handler{
+		models:        m,
+		validate:      v,
+		contentFilter: f,
+		spamScorer:    s,
+		views:         vc,
+		events:        b,
+		live:          lh,
+		notifier:      notifications.NewGenerator(),
+	}
 }
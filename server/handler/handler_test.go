@@ -0,0 +1,373 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/config"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/events"
+	"github.com/Ahmad-mufied/iducate-community-service/moderation"
+	"github.com/Ahmad-mufied/iducate-community-service/realtime"
+	"github.com/Ahmad-mufied/iducate-community-service/server"
+	"github.com/Ahmad-mufied/iducate-community-service/server/handler"
+	"github.com/Ahmad-mufied/iducate-community-service/server/middlewares"
+	"github.com/Ahmad-mufied/iducate-community-service/views"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdminKey = "test-admin-key"
+
+// testServer serves the routes on top of the memory store
+type testServer struct {
+	t *testing.T
+	e *echo.Echo
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	store := data.NewMemoryStore()
+	old := time.Now().Add(-365 * 24 * time.Hour)
+	store.AddUser(data.User{ID: "alice", Email: "alice@example.com", Username: "Alice", CreatedAt: old})
+	store.AddUser(data.User{ID: "bob", Email: "bob@example.com", Username: "Bob", CreatedAt: old})
+	models := data.NewMemory(store)
+
+	// Posts with "blocked" wait for a moderator
+	validate := validator.New()
+	filter, err := moderation.NewContentFilter(moderation.FilterModeQueue, nil, []string{"blocked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := filter.RegisterValidation(validate); err != nil {
+		t.Fatal(err)
+	}
+	scorer := moderation.NewSpamScorer(moderation.SpamConfig{
+		ReviewThreshold: 4,
+		RejectThreshold: 8,
+		NewAccountAge:   72 * time.Hour,
+		VelocityWindow:  time.Hour,
+	})
+
+	bus := events.NewBus(10)
+	hub := realtime.NewHub(bus, realtime.Config{})
+	t.Cleanup(hub.Close)
+	t.Cleanup(bus.Close)
+
+	config.Viper.Set("ADMIN_API_KEY", testAdminKey)
+	e := echo.New()
+	server.Routes(e, handler.New(models, validate, filter, scorer, views.NewCounter(models.Post, time.Hour, time.Hour), bus, hub), nil)
+
+	return &testServer{t: t, e: e}
+}
+
+// idToken mints a token for the user, the middleware doesn't verify it
+func idToken(t *testing.T, userID string) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": userID, "name": userID}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// do sends a request as userID, or anonymously when it is empty, and
+// decodes the JSON response into out when given
+func (s *testServer) do(method, path, userID string, body interface{}, headers map[string]string, out interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader *strings.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = strings.NewReader(string(raw))
+	} else {
+		reader = strings.NewReader("")
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if userID != "" {
+		req.Header.Set("id_token", idToken(s.t, userID))
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+
+	if out != nil && rec.Code < http.StatusBadRequest {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+// expect fails the test unless the response has the status
+func expect(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Fatalf("status %d, want %d: %s", rec.Code, status, rec.Body.String())
+	}
+}
+
+// expectError fails the test unless the response is the error envelope with
+// the status and error code
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, errorCode string) {
+	t.Helper()
+
+	expect(t, rec, status)
+	var body struct {
+		ErrorCode string `json:"error_code"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if body.ErrorCode != errorCode {
+		t.Fatalf("error code %q, want %q: %s", body.ErrorCode, errorCode, rec.Body.String())
+	}
+}
+
+func (s *testServer) createPost(userID, title, content string) data.PostResponse {
+	s.t.Helper()
+
+	var post data.PostResponse
+	rec := s.do(http.MethodPost, "/posts", userID, map[string]string{"title": title, "content": content}, nil, &post)
+	expect(s.t, rec, http.StatusCreated)
+	return post
+}
+
+func (s *testServer) createComment(userID string, postID uint, content string) data.CommentResponse {
+	s.t.Helper()
+
+	var comment data.CommentResponse
+	rec := s.do(http.MethodPost, fmt.Sprintf("/comments/post/%d", postID), userID, map[string]string{"content": content}, nil, &comment)
+	expect(s.t, rec, http.StatusCreated)
+	return comment
+}
+
+func TestPosts(t *testing.T) {
+	s := newTestServer(t)
+
+	expectError(t, s.do(http.MethodPost, "/posts", "", map[string]string{"title": "Hello", "content": "World"}, nil, nil), http.StatusUnauthorized, "unauthorized")
+	expectError(t, s.do(http.MethodPost, "/posts", "alice", map[string]string{"content": "No title"}, nil, nil), http.StatusBadRequest, "validation_failed")
+
+	first := s.createPost("alice", "First", "Hello")
+	second := s.createPost("bob", "Second", "World")
+	if first.Author != "Alice" {
+		t.Fatalf("created post by %q, want Alice", first.Author)
+	}
+
+	var feed []data.PostResponse
+	rec := s.do(http.MethodGet, "/posts?sort_type=latest&sort=desc", "", nil, nil, &feed)
+	expect(t, rec, http.StatusOK)
+	if len(feed) != 2 || feed[0].ID != second.ID || feed[1].ID != first.ID {
+		t.Fatalf("feed %+v, want posts %d and %d", feed, second.ID, first.ID)
+	}
+	if got := rec.Header().Get("Cache-Control"); !strings.HasPrefix(got, "public") {
+		t.Fatalf("feed sent Cache-Control %q, want public", got)
+	}
+
+	// Shared caches must not answer views, which are counted by the handler
+	rec = s.do(http.MethodGet, fmt.Sprintf("/posts/%d", first.ID), "", nil, nil, nil)
+	expect(t, rec, http.StatusOK)
+	if got := rec.Header().Get("Cache-Control"); got != "private, no-cache" {
+		t.Fatalf("post detail sent Cache-Control %q, want private, no-cache", got)
+	}
+	etag := rec.Header().Get("ETag")
+	expect(t, s.do(http.MethodGet, fmt.Sprintf("/posts/%d", first.ID), "", nil, map[string]string{"If-None-Match": etag}, nil), http.StatusNotModified)
+	expectError(t, s.do(http.MethodGet, "/posts/999", "", nil, nil, nil), http.StatusNotFound, "not_found")
+
+	expect(t, s.do(http.MethodDelete, fmt.Sprintf("/posts/%d", first.ID), "alice", nil, nil, nil), http.StatusOK)
+	expectError(t, s.do(http.MethodGet, fmt.Sprintf("/posts/%d", first.ID), "", nil, nil, nil), http.StatusNotFound, "not_found")
+	expectError(t, s.do(http.MethodDelete, fmt.Sprintf("/posts/%d", first.ID), "alice", nil, nil, nil), http.StatusNotFound, "not_found")
+}
+
+func TestCreatePostIdempotent(t *testing.T) {
+	s := newTestServer(t)
+	headers := map[string]string{middlewares.IdempotencyKeyHeader: "key-1"}
+	body := map[string]string{"title": "Once", "content": "Only once"}
+
+	var first, replayed data.PostResponse
+	expect(t, s.do(http.MethodPost, "/posts", "alice", body, headers, &first), http.StatusCreated)
+	rec := s.do(http.MethodPost, "/posts", "alice", body, headers, &replayed)
+	expect(t, rec, http.StatusCreated)
+	if rec.Header().Get("Idempotent-Replayed") != "true" || replayed.ID != first.ID {
+		t.Fatalf("retry created post %d, want replay of %d", replayed.ID, first.ID)
+	}
+
+	body["content"] = "Something else"
+	expectError(t, s.do(http.MethodPost, "/posts", "alice", body, headers, nil), http.StatusConflict, "idempotency_key_reused")
+
+	var feed []data.PostResponse
+	expect(t, s.do(http.MethodGet, "/posts", "", nil, nil, &feed), http.StatusOK)
+	if len(feed) != 1 {
+		t.Fatalf("%d posts, want 1", len(feed))
+	}
+}
+
+func TestComments(t *testing.T) {
+	s := newTestServer(t)
+	post := s.createPost("alice", "Post", "Content")
+
+	expectError(t, s.do(http.MethodPost, "/comments/post/999", "bob", map[string]string{"content": "Hi"}, nil, nil), http.StatusNotFound, "not_found")
+
+	comment := s.createComment("bob", post.ID, "Nice post")
+	path := fmt.Sprintf("/comments/%d", comment.ID)
+
+	expectError(t, s.do(http.MethodPut, path, "alice", map[string]string{"content": "Hijacked"}, nil, nil), http.StatusForbidden, "forbidden")
+	expectError(t, s.do(http.MethodPut, "/comments/999", "bob", map[string]string{"content": "Edit"}, nil, nil), http.StatusNotFound, "not_found")
+
+	// Saving the comment unchanged isn't a duplicate of itself
+	expect(t, s.do(http.MethodPut, path, "bob", map[string]string{"content": "Nice post"}, nil, nil), http.StatusOK)
+
+	var count map[string]int
+	expect(t, s.do(http.MethodGet, fmt.Sprintf("/comments/post/%d", post.ID), "", nil, nil, &count), http.StatusOK)
+	if count["comment_count"] != 1 {
+		t.Fatalf("comment count %d, want 1", count["comment_count"])
+	}
+
+	expectError(t, s.do(http.MethodDelete, path, "alice", nil, nil, nil), http.StatusForbidden, "forbidden")
+	expect(t, s.do(http.MethodDelete, path, "bob", nil, nil, nil), http.StatusOK)
+	expectError(t, s.do(http.MethodDelete, path, "bob", nil, nil, nil), http.StatusNotFound, "not_found")
+}
+
+func TestUpdateCommentSpam(t *testing.T) {
+	s := newTestServer(t)
+	post := s.createPost("alice", "Post", "Content")
+
+	links := "see http://a.example http://b.example http://c.example"
+	s.createComment("bob", post.ID, links)
+	comment := s.createComment("bob", post.ID, "Harmless")
+	path := fmt.Sprintf("/comments/%d", comment.ID)
+
+	// Three links and a duplicate of the other comment need a moderator
+	expect(t, s.do(http.MethodPut, path, "bob", map[string]string{"content": links}, nil, nil), http.StatusAccepted)
+
+	var pending struct {
+		Pending []data.PendingContent `json:"pending"`
+	}
+	headers := map[string]string{middlewares.AdminKeyHeader: testAdminKey}
+	expect(t, s.do(http.MethodGet, "/admin/moderation/pending", "", nil, headers, &pending), http.StatusOK)
+	if len(pending.Pending) != 1 || pending.Pending[0].ID != comment.ID || pending.Pending[0].SpamScore == nil {
+		t.Fatalf("pending %+v, want scored comment %d", pending.Pending, comment.ID)
+	}
+}
+
+func TestUpdateRejectedComment(t *testing.T) {
+	s := newTestServer(t)
+	headers := map[string]string{middlewares.AdminKeyHeader: testAdminKey}
+	post := s.createPost("alice", "Post", "Content")
+
+	var held data.CommentResponse
+	expect(t, s.do(http.MethodPost, fmt.Sprintf("/comments/post/%d", post.ID), "bob", map[string]string{"content": "This is blocked"}, nil, &held), http.StatusAccepted)
+	expect(t, s.do(http.MethodPost, fmt.Sprintf("/admin/moderation/comments/%d/reject", held.ID), "", nil, headers, nil), http.StatusOK)
+
+	// Editing doesn't publish a rejected comment or notify its mentions
+	expect(t, s.do(http.MethodPut, fmt.Sprintf("/comments/%d", held.ID), "bob", map[string]string{"content": "Hey @Alice"}, nil, nil), http.StatusAccepted)
+
+	var count map[string]int
+	expect(t, s.do(http.MethodGet, fmt.Sprintf("/comments/post/%d", post.ID), "", nil, nil, &count), http.StatusOK)
+	if count["comment_count"] != 0 {
+		t.Fatalf("comment count %d, want 0", count["comment_count"])
+	}
+	expect(t, s.do(http.MethodGet, "/me/notifications/unread-count", "alice", nil, nil, &count), http.StatusOK)
+	if count["unread_count"] != 0 {
+		t.Fatalf("unread count %d, want 0", count["unread_count"])
+	}
+
+	// And it stays rejected rather than coming back to the queue
+	var pending struct {
+		Pending []data.PendingContent `json:"pending"`
+	}
+	expect(t, s.do(http.MethodGet, "/admin/moderation/pending", "", nil, headers, &pending), http.StatusOK)
+	if len(pending.Pending) != 0 {
+		t.Fatalf("pending %+v, want none", pending.Pending)
+	}
+}
+
+func TestLikes(t *testing.T) {
+	s := newTestServer(t)
+	post := s.createPost("alice", "Post", "Content")
+	path := fmt.Sprintf("/likes/post/%d", post.ID)
+
+	// Liking twice counts once and notifies once
+	expect(t, s.do(http.MethodPost, path, "bob", nil, nil, nil), http.StatusOK)
+	expect(t, s.do(http.MethodPost, path, "bob", nil, nil, nil), http.StatusOK)
+
+	var count map[string]int
+	expect(t, s.do(http.MethodGet, path, "", nil, nil, &count), http.StatusOK)
+	if count["like_count"] != 1 {
+		t.Fatalf("like count %d, want 1", count["like_count"])
+	}
+	expect(t, s.do(http.MethodGet, "/me/notifications/unread-count", "alice", nil, nil, &count), http.StatusOK)
+	if count["unread_count"] != 1 {
+		t.Fatalf("unread count %d, want 1", count["unread_count"])
+	}
+
+	expect(t, s.do(http.MethodDelete, path, "bob", nil, nil, nil), http.StatusOK)
+	expect(t, s.do(http.MethodGet, path, "", nil, nil, &count), http.StatusOK)
+	if count["like_count"] != 0 {
+		t.Fatalf("like count %d, want 0", count["like_count"])
+	}
+
+	expectError(t, s.do(http.MethodPost, "/likes/post/999", "bob", nil, nil, nil), http.StatusNotFound, "not_found")
+}
+
+func TestModerationQueue(t *testing.T) {
+	s := newTestServer(t)
+	headers := map[string]string{middlewares.AdminKeyHeader: testAdminKey}
+
+	var held data.PostResponse
+	expect(t, s.do(http.MethodPost, "/posts", "alice", map[string]string{"title": "Held", "content": "This is blocked"}, nil, &held), http.StatusAccepted)
+	expectError(t, s.do(http.MethodGet, fmt.Sprintf("/posts/%d", held.ID), "", nil, nil, nil), http.StatusNotFound, "not_found")
+
+	expectError(t, s.do(http.MethodGet, "/admin/moderation/pending", "", nil, nil, nil), http.StatusUnauthorized, "unauthorized")
+	expectError(t, s.do(http.MethodGet, "/admin/moderation/pending?content_type=video", "", nil, headers, nil), http.StatusBadRequest, "bad_request")
+
+	var pending struct {
+		Pending []data.PendingContent `json:"pending"`
+	}
+	expect(t, s.do(http.MethodGet, "/admin/moderation/pending?content_type=post", "", nil, headers, &pending), http.StatusOK)
+	if len(pending.Pending) != 1 || pending.Pending[0].ID != held.ID {
+		t.Fatalf("pending %+v, want post %d", pending.Pending, held.ID)
+	}
+
+	approve := fmt.Sprintf("/admin/moderation/posts/%d/approve", held.ID)
+	var approved data.PostResponse
+	expect(t, s.do(http.MethodPost, approve, "", nil, headers, &approved), http.StatusOK)
+	if approved.Author != "Alice" {
+		t.Fatalf("approved post by %q, want Alice", approved.Author)
+	}
+	expect(t, s.do(http.MethodGet, fmt.Sprintf("/posts/%d", held.ID), "", nil, nil, nil), http.StatusOK)
+
+	var heldComment data.CommentResponse
+	expect(t, s.do(http.MethodPost, fmt.Sprintf("/comments/post/%d", held.ID), "bob", map[string]string{"content": "Also blocked"}, nil, &heldComment), http.StatusAccepted)
+	var approvedComment data.CommentResponse
+	expect(t, s.do(http.MethodPost, fmt.Sprintf("/admin/moderation/comments/%d/approve", heldComment.ID), "", nil, headers, &approvedComment), http.StatusOK)
+	if approvedComment.Username != "Bob" {
+		t.Fatalf("approved comment by %q, want Bob", approvedComment.Username)
+	}
+
+	// A moderator already decided
+	expectError(t, s.do(http.MethodPost, approve, "", nil, headers, nil), http.StatusConflict, "conflict")
+	expectError(t, s.do(http.MethodPost, fmt.Sprintf("/admin/moderation/posts/%d/reject", held.ID), "", nil, headers, nil), http.StatusConflict, "conflict")
+	expectError(t, s.do(http.MethodPost, "/admin/moderation/posts/999/approve", "", nil, headers, nil), http.StatusNotFound, "not_found")
+
+	expect(t, s.do(http.MethodGet, "/admin/moderation/pending", "", nil, headers, &pending), http.StatusOK)
+	if len(pending.Pending) != 0 {
+		t.Fatalf("pending %+v, want none", pending.Pending)
+	}
+}
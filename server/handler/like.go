@@ -1,13 +1,17 @@
 package handler
 
 import (
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/metrics"
 	"github.com/Ahmad-mufied/iducate-community-service/server/middlewares"
+	"github.com/Ahmad-mufied/iducate-community-service/webhooks"
 	"github.com/labstack/echo/v4"
 	"net/http"
 	"strconv"
 )
 
-func LikePostHandler(c echo.Context) error {
+func (h *Handler) LikePostHandler(c echo.Context) error {
 
 	// Get the user ID from middleware
 	userID := middlewares.GetUserID(c)
@@ -17,23 +21,40 @@ func LikePostHandler(c echo.Context) error {
 
 	postID, err := strconv.Atoi(postIDParam)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post ID"})
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
 	}
 
 	// Use the request's context
 	ctx := c.Request().Context()
 
-	// Add like
-	err = entity.Like.AddLike(ctx, userID, postID)
+	// Add like and notify the post author and the webhook endpoints together.
+	// Liking a post again changes nothing, so nobody hears about it.
+	var added bool
+	err = h.models.WithTx(ctx, func(tx *data.Models) error {
+		var err error
+		added, err = tx.Like.AddLike(ctx, userID, postID)
+		if err != nil || !added {
+			return err
+		}
+		if err := h.notifier.PostLiked(ctx, tx, uint(postID), userID); err != nil {
+			return err
+		}
+		return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypePostLiked, uint(postID), likePayload(postID, userID))
+	})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return err
+	}
+
+	if added {
+		metrics.Likes.Inc()
+		h.publishLikeCount(ctx, postID)
 	}
 
 	// Return success message
 	return c.JSON(http.StatusOK, map[string]string{"message": "Post liked successfully"})
 }
 
-func UnlikePostHandler(c echo.Context) error {
+func (h *Handler) UnlikePostHandler(c echo.Context) error {
 	// Get the user ID from middleware
 	userID := middlewares.GetUserID(c)
 
@@ -42,40 +63,62 @@ func UnlikePostHandler(c echo.Context) error {
 
 	postID, err := strconv.Atoi(postIDParam)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post ID"})
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
 	}
 
 	// Use the request's context
 	ctx := c.Request().Context()
 
-	// Remove like
-	err = entity.Like.RemoveLike(ctx, userID, postID)
+	// Remove like and tell the webhook endpoints together, unless the post
+	// wasn't liked
+	var removed bool
+	err = h.models.WithTx(ctx, func(tx *data.Models) error {
+		var err error
+		removed, err = tx.Like.RemoveLike(ctx, userID, postID)
+		if err != nil || !removed {
+			return err
+		}
+		return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypePostUnliked, uint(postID), likePayload(postID, userID))
+	})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return err
+	}
+
+	if removed {
+		metrics.Unlikes.Inc()
+		h.publishLikeCount(ctx, postID)
 	}
 
 	// Return success message
 	return c.JSON(http.StatusOK, map[string]string{"message": "Post unliked successfully"})
 }
 
-func GetLikesCountHandler(c echo.Context) error {
+func (h *Handler) GetLikesCountHandler(c echo.Context) error {
 	// Get the post ID from the request
 	postIDParam := c.Param("post_id") // Assume post ID is passed as a route parameter
 
 	postID, err := strconv.Atoi(postIDParam)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post ID"})
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
 	}
 
 	// Use the request's context
 	ctx := c.Request().Context()
 
 	// Count likes
-	likeCount, err := entity.Like.CountLikes(ctx, postID)
+	likeCount, err := h.models.Like.CountLikes(ctx, postID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return err
 	}
 
 	// Return like count
 	return c.JSON(http.StatusOK, map[string]int{"like_count": likeCount})
 }
+
+// likePayload is the webhook data of a like or unlike
+func likePayload(postID int, userID string) map[string]interface{} {
+	return map[string]interface{}{
+		"post_id": postID,
+		"user_id": userID,
+	}
+}
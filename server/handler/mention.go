@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/mentions"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// saveMentions resolves the @mentions in content and stores them for the
+// post, or for one of its comments when commentID isn't 0. It returns the
+// mentions and the users mentioned before.
+func (h *Handler) saveMentions(ctx context.Context, models *data.Models, postID uint, commentID uint, content string) ([]data.Mention, []string, error) {
+	found := []data.Mention{}
+	if names := mentions.Candidates(content); len(names) > 0 {
+		users, err := models.User.FindUsersByUsernames(ctx, names)
+		if err != nil {
+			return nil, nil, err
+		}
+		found = mentions.Resolve(content, users)
+	}
+
+	previous, err := models.Mention.ReplaceMentions(ctx, postID, commentID, found)
+	if err != nil {
+		return nil, nil, err
+	}
+	return found, previous, nil
+}
+
+func (h *Handler) SearchUsersHandler(c echo.Context) error {
+	q := strings.TrimSpace(strings.TrimPrefix(c.QueryParam("q"), "@"))
+	if q == "" {
+		return c.JSON(http.StatusOK, map[string]interface{}{"users": []data.UserSummary{}})
+	}
+
+	limit := 10
+	if l, err := strconv.Atoi(c.QueryParam("limit")); err == nil && l >= 1 && l <= 20 {
+		limit = l
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	users, err := h.models.User.SearchUsers(ctx, q, limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"users": users})
+}
@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/events"
+	"github.com/Ahmad-mufied/iducate-community-service/mentions"
+	"github.com/Ahmad-mufied/iducate-community-service/moderation"
+	"github.com/Ahmad-mufied/iducate-community-service/webhooks"
+	"github.com/labstack/echo/v4"
+	"github.com/xeonx/timeago"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// scoreSpam rates new or edited content against its author's recent activity.
+// replaced is the content an edit replaces, which is left out of the activity
+// so an edit isn't a duplicate of itself.
+func (h *Handler) scoreSpam(ctx context.Context, userID string, content string, replaced string) (moderation.SpamResult, error) {
+	since := time.Now().Add(-h.spamScorer.VelocityWindow())
+	activity, err := h.models.Spam.GetUserActivity(ctx, userID, since)
+	if err != nil {
+		return moderation.SpamResult{}, err
+	}
+
+	recent := activity.RecentContents
+	if replaced != "" {
+		for i, recentContent := range recent {
+			if recentContent == replaced {
+				recent = append(recent[:i:i], recent[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// Accounts without a creation time are unknown, not new
+	var accountAge time.Duration
+	if !activity.AccountCreatedAt.IsZero() {
+		accountAge = time.Since(activity.AccountCreatedAt)
+	}
+
+	return h.spamScorer.Score(moderation.SpamInput{
+		Content:        content,
+		AccountAge:     accountAge,
+		RecentContents: recent,
+	}), nil
+}
+
+// recordSpamScore stores a non-zero score for moderator review. Rejected
+// content has no ID yet and is stored with contentID 0. Pass the transaction's
+// models to store the score together with the content.
+func (h *Handler) recordSpamScore(ctx context.Context, models *data.Models, contentType string, contentID uint, userID string, result moderation.SpamResult) error {
+	if result.Score == 0 {
+		return nil
+	}
+
+	return models.Spam.RecordSpamScore(ctx, contentType, contentID, userID, result.Score, result.Reasons, string(result.Decision))
+}
+
+func (h *Handler) GetPendingContentHandler(c echo.Context) error {
+	// Parse query parameters
+	var query data.PendingContentQuery
+	if err := query.Parse(c); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid query parameters")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	contents, err := h.models.Moderation.GetPendingContent(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"pending": contents})
+}
+
+func (h *Handler) ApprovePostHandler(c echo.Context) error {
+	// Parse post ID from URL parameter
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	// Publish the post and announce it like a new one: notify the mentioned
+	// users and the webhook endpoints together
+	var response data.PostResponse
+	err = h.models.WithTx(ctx, func(tx *data.Models) error {
+		post, err := tx.Moderation.ModeratePost(ctx, uint(postID), data.StatusPublished)
+		if err != nil {
+			return err
+		}
+		author, err := tx.User.GetUser(ctx, post.UserID)
+		if err != nil {
+			return err
+		}
+
+		response = data.PostResponse{
+			ID:        post.ID,
+			Title:     post.Title,
+			Content:   post.Content,
+			Views:     post.Views,
+			Author:    author.Username,
+			CreatedAt: timeago.English.Format(post.CreatedAt),
+		}
+		response.Mentions, _, err = h.saveMentions(ctx, tx, post.ID, 0, post.Content)
+		if err != nil {
+			return err
+		}
+
+		if err := h.notifier.Mentioned(ctx, tx, post.ID, 0, mentions.UserIDs(response.Mentions), post.UserID, nil); err != nil {
+			return err
+		}
+		return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypePostCreated, post.ID, map[string]interface{}{
+			"post_id": post.ID,
+			"user_id": post.UserID,
+			"title":   post.Title,
+			"content": post.Content,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	h.publish(events.TypePostCreated, response.ID, response)
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) RejectPostHandler(c echo.Context) error {
+	// Parse post ID from URL parameter
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	// Rejected posts stay stored but are never shown
+	if _, err := h.models.Moderation.ModeratePost(ctx, uint(postID), data.StatusRejected); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Post rejected successfully"})
+}
+
+func (h *Handler) ApproveCommentHandler(c echo.Context) error {
+	// Parse comment ID from URL parameter
+	commentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid comment ID")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	// Publish the comment, which counts it for its post, and announce it like
+	// a new one: notify the post and parent comment authors, the mentioned
+	// users and the webhook endpoints together
+	var comment *data.Comment
+	var response data.CommentResponse
+	err = h.models.WithTx(ctx, func(tx *data.Models) error {
+		var err error
+		comment, err = tx.Moderation.ModerateComment(ctx, uint(commentID), data.StatusPublished)
+		if err != nil {
+			return err
+		}
+		author, err := tx.User.GetUser(ctx, comment.UserID)
+		if err != nil {
+			return err
+		}
+
+		response = data.CommentResponse{
+			ID:        comment.ID,
+			ParentID:  comment.ParentID,
+			Username:  author.Username,
+			Content:   comment.Content,
+			CreatedAt: timeago.English.Format(comment.CreatedAt),
+		}
+		response.Mentions, _, err = h.saveMentions(ctx, tx, comment.PostID, comment.ID, comment.Content)
+		if err != nil {
+			return err
+		}
+
+		notified, err := h.notifier.CommentCreated(ctx, tx, comment)
+		if err != nil {
+			return err
+		}
+
+		// Authors told about the comment already don't hear about the mention
+		if err := h.notifier.Mentioned(ctx, tx, comment.PostID, comment.ID, mentions.UserIDs(response.Mentions), comment.UserID, notified); err != nil {
+			return err
+		}
+		return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypeCommentCreated, comment.PostID, commentPayload(comment))
+	})
+	if err != nil {
+		return err
+	}
+
+	h.publish(events.TypeCommentCreated, comment.PostID, map[string]interface{}{
+		"comment":       response,
+		"comment_count": h.commentCount(ctx, comment.PostID),
+	})
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) RejectCommentHandler(c echo.Context) error {
+	// Parse comment ID from URL parameter
+	commentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid comment ID")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	// Rejected comments stay stored but are never shown
+	if _, err := h.models.Moderation.ModerateComment(ctx, uint(commentID), data.StatusRejected); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Comment rejected successfully"})
+}
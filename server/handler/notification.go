@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/server/middlewares"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) GetNotificationsHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	// Parse query parameters
+	var query data.NotificationQuery
+	if err := query.Parse(c); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid query parameters")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	notifications, err := h.models.Notification.GetNotifications(ctx, userID, query)
+	if err != nil {
+		return err
+	}
+
+	unreadCount, err := h.models.Notification.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"notifications": notifications,
+		"unread_count":  unreadCount,
+	})
+}
+
+func (h *Handler) GetUnreadNotificationCountHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	unreadCount, err := h.models.Notification.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]int{"unread_count": unreadCount})
+}
+
+func (h *Handler) MarkNotificationReadHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	// Parse notification ID from URL parameter
+	notificationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid notification ID")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	err = h.models.Notification.MarkNotificationRead(ctx, userID, uint(notificationID))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Notification marked as read"})
+}
+
+func (h *Handler) MarkAllNotificationsReadHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	updated, err := h.models.Notification.MarkAllNotificationsRead(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Notifications marked as read",
+		"updated": updated,
+	})
+}
+
+func (h *Handler) GetNotificationPreferencesHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	preferences, err := h.models.Notification.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, preferences)
+}
+
+// UpdateNotificationPreferencesHandler changes the channels given in the
+// body, e.g. {"like": {"email": true}}, and keeps the others
+func (h *Handler) UpdateNotificationPreferencesHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	var req map[string]map[string]bool
+	if err := c.Bind(&req); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid request body")
+	}
+	for notificationType, channels := range req {
+		if !isNotificationType(notificationType) {
+			return constants.ErrBadRequest.WithDetail("Unknown notification type " + strconv.Quote(notificationType))
+		}
+		for channel := range channels {
+			if !new(data.ChannelPreferences).Set(channel, true) {
+				return constants.ErrBadRequest.WithDetail("Unknown channel " + strconv.Quote(channel))
+			}
+		}
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	var preferences data.NotificationPreferences
+	err := h.models.WithTx(ctx, func(tx *data.Models) error {
+		var err error
+		preferences, err = tx.Notification.GetNotificationPreferences(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		changed := make(data.NotificationPreferences, len(req))
+		for notificationType, channels := range req {
+			updated := preferences[notificationType]
+			for channel, enabled := range channels {
+				updated.Set(channel, enabled)
+			}
+			preferences[notificationType] = updated
+			changed[notificationType] = updated
+		}
+
+		return tx.Notification.UpdateNotificationPreferences(ctx, userID, changed)
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, preferences)
+}
+
+func isNotificationType(notificationType string) bool {
+	for _, t := range data.NotificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
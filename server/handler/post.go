@@ -1,68 +1,71 @@
 package handler
 
 import (
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
 	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/events"
+	"github.com/Ahmad-mufied/iducate-community-service/mentions"
+	"github.com/Ahmad-mufied/iducate-community-service/metrics"
+	"github.com/Ahmad-mufied/iducate-community-service/moderation"
 	"github.com/Ahmad-mufied/iducate-community-service/server/middlewares"
 	"github.com/Ahmad-mufied/iducate-community-service/utils"
+	"github.com/Ahmad-mufied/iducate-community-service/views"
+	"github.com/Ahmad-mufied/iducate-community-service/webhooks"
 	"github.com/labstack/echo/v4"
 	"net/http"
 	"strconv"
 )
 
-func GetPaginatedPostsHandler(c echo.Context) error {
+func (h *Handler) GetPaginatedPostsHandler(c echo.Context) error {
 	// Parse query parameters
 	var query data.PaginatedFeedQuery
 	if err := query.Parse(c); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid query parameters"})
+		return constants.ErrBadRequest.WithDetail("Invalid query parameters")
 	}
 
-	posts, err := entity.Post.GetPaginatedPosts(query)
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	posts, err := h.models.Post.GetPaginatedPosts(ctx, query)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return err
 	}
 
 	// Return the response
 	return c.JSON(http.StatusOK, posts)
 }
 
-func GetPostDetailHandler(c echo.Context) error {
+func (h *Handler) GetPostDetailHandler(c echo.Context) error {
 	// Get post ID from URL parameter
 	postIDParam := c.Param("id")
 	postID, err := strconv.Atoi(postIDParam)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post ID"})
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
 	}
 
 	// Use the request's context
 	ctx := c.Request().Context()
 
 	// Check if the post exists
-	exists, err := entity.Post.CheckPostByID(ctx, uint(postID))
+	exists, err := h.models.Post.CheckPostByID(ctx, uint(postID))
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
+		return err
 	}
 
 	if !exists {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
+		return constants.ErrNotFound.WithDetail("post not found")
 	}
 
 	// Fetch post details with comments
-	post, comments, err := entity.Post.GetPostDetailWithComments(ctx, uint(postID))
+	post, comments, err := h.models.Post.GetPostDetailWithComments(ctx, uint(postID))
 	if err != nil {
-		if err.Error() == "post not found" {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return err
 	}
 
-	// Increment views count
-	err = entity.Post.IncrementPostViews(ctx, uint(postID))
-	if err != nil {
-		if err.Error() == "post not found" {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	}
+	// Count the view, written to the database in batches
+	userAgent := c.Request().UserAgent()
+	viewerKey := views.ViewerKey(middlewares.GetUserID(c), c.RealIP(), userAgent)
+	h.views.Record(uint(postID), viewerKey, userAgent)
 
 	if post == nil {
 		post = &data.PostResponse{}
@@ -82,6 +85,7 @@ func GetPostDetailHandler(c echo.Context) error {
 		LikeCount:    post.LikeCount,
 		CommentCount: post.CommentCount,
 		CreatedAt:    post.CreatedAt,
+		Mentions:     post.Mentions,
 		Comments:     comments,
 	}
 
@@ -98,7 +102,7 @@ func GetPostDetailHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, postComment)
 }
 
-func CreatePostHandler(c echo.Context) error {
+func (h *Handler) CreatePostHandler(c echo.Context) error {
 
 	userID := middlewares.GetUserID(c)
 
@@ -107,59 +111,125 @@ func CreatePostHandler(c echo.Context) error {
 
 	// Bind and validate the request body
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return constants.ErrBadRequest.WithDetail("Invalid request body")
 	}
 	// Validate
-	err := validate.Struct(req)
+	err := h.validate.Struct(req)
 	if err != nil {
 		// Format the validation errors
-		errors := utils.FormatValidationErrors(err)
-		return utils.HandleValidationError(c, errors)
+		return utils.NewValidationError(utils.FormatValidationErrors(err))
+	}
+
+	// Mask banned words or hold the post for moderation
+	var titleQueued, contentQueued bool
+	req.Title, titleQueued = h.contentFilter.Apply(req.Title)
+	req.Content, contentQueued = h.contentFilter.Apply(req.Content)
+	if titleQueued || contentQueued {
+		req.Status = data.StatusPending
 	}
 
 	// Use the request's context
 	ctx := c.Request().Context()
 
-	// Create the post
-	post, err := entity.Post.CreatePost(ctx, req)
+	// Score the post for spam before saving it. Recent posts come back as
+	// title and content the same way, so reposts count as duplicates.
+	spam, err := h.scoreSpam(ctx, userID, req.Title+"\n"+req.Content, "")
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return err
+	}
+	if spam.Decision == moderation.SpamDecisionReject {
+		if err := h.recordSpamScore(ctx, h.models, data.ContentTypePost, 0, userID, spam); err != nil {
+			return err
+		}
+		return constants.ErrSpamRejected
+	}
+	if spam.Decision == moderation.SpamDecisionReview {
+		req.Status = data.StatusPending
 	}
 
+	// Create the post, store its spam score and mentions and notify the
+	// mentioned users and the webhook endpoints together
+	var post data.PostResponse
+	err = h.models.WithTx(ctx, func(tx *data.Models) error {
+		var err error
+		post, err = tx.Post.CreatePost(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		if err := h.recordSpamScore(ctx, tx, data.ContentTypePost, post.ID, userID, spam); err != nil {
+			return err
+		}
+
+		post.Mentions, _, err = h.saveMentions(ctx, tx, post.ID, 0, req.Content)
+		if err != nil {
+			return err
+		}
+
+		// Posts held for moderation aren't announced
+		if req.Status == data.StatusPending {
+			return nil
+		}
+		if err := h.notifier.Mentioned(ctx, tx, post.ID, 0, mentions.UserIDs(post.Mentions), userID, nil); err != nil {
+			return err
+		}
+		return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypePostCreated, post.ID, map[string]interface{}{
+			"post_id": post.ID,
+			"user_id": userID,
+			"title":   post.Title,
+			"content": post.Content,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	metrics.PostsCreated.Inc()
+
+	// Posts waiting for moderation are accepted but not yet visible
+	if req.Status == data.StatusPending {
+		return c.JSON(http.StatusAccepted, post)
+	}
+
+	h.publish(events.TypePostCreated, post.ID, post)
+
 	// Return the created post as JSON
 	return c.JSON(http.StatusCreated, post)
 }
 
-func DeletePostHandler(c echo.Context) error {
+func (h *Handler) DeletePostHandler(c echo.Context) error {
 	// Get post ID from URL parameter
 	postIDParam := c.Param("id")
 	postID, err := strconv.Atoi(postIDParam)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid post ID"})
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
 	}
 
 	// Use the request's context
 	ctx := c.Request().Context()
 
 	// Check if the post exists
-	exists, err := entity.Post.CheckPostByID(ctx, uint(postID))
+	exists, err := h.models.Post.CheckPostByID(ctx, uint(postID))
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
+		return err
 	}
 
 	if !exists {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
+		return constants.ErrNotFound.WithDetail("post not found")
 	}
 
-	// Delete the post
-	err = entity.Post.DeletePost(ctx, uint(postID))
-	if err != nil {
-		if err.Error() == "no post found with the given ID" {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "Post not found"})
+	// Delete the post and tell the webhook endpoints together
+	err = h.models.WithTx(ctx, func(tx *data.Models) error {
+		if err := tx.Post.DeletePost(ctx, uint(postID)); err != nil {
+			return err
 		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return tx.Webhook.AddOutboxEvent(ctx, webhooks.TypePostDeleted, uint(postID), map[string]int{"post_id": postID})
+	})
+	if err != nil {
+		return err
 	}
 
+	h.publish(events.TypePostDeleted, uint(postID), map[string]int{"post_id": postID})
+
 	// Return success message
 	return c.JSON(http.StatusOK, map[string]string{"message": "Post deleted successfully"})
 }
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/events"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// sseHeartbeatInterval keeps idle streams open through proxies
+	sseHeartbeatInterval = 15 * time.Second
+	// sseBuffer is how many events a slow client may lag behind before it is
+	// disconnected and has to resume with Last-Event-ID
+	sseBuffer = 64
+	// sseResetEvent tells the client it missed events and should refetch
+	sseResetEvent = "reset"
+)
+
+// StreamPostHandler streams the comments and like counts of one post
+func (h *Handler) StreamPostHandler(c echo.Context) error {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
+	}
+
+	exists, err := h.models.Post.CheckPostByID(c.Request().Context(), uint(postID))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return constants.ErrNotFound.WithDetail("post not found")
+	}
+
+	return h.streamEvents(c, events.ForPost(uint(postID)))
+}
+
+// StreamFeedHandler streams new and deleted posts and count changes of all posts
+func (h *Handler) StreamFeedHandler(c echo.Context) error {
+	return h.streamEvents(c, nil)
+}
+
+// streamEvents writes the events matching filter as Server-Sent Events until
+// the client disconnects or the bus shuts down
+func (h *Handler) streamEvents(c echo.Context, filter events.Filter) error {
+	// Browsers resend the last received ID in the header, the query
+	// parameter covers clients that can't set headers
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("lastEventId")
+	}
+
+	sub, replay, complete := h.events.Subscribe(filter, lastEventID, sseBuffer)
+	defer sub.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	res.WriteHeader(http.StatusOK)
+
+	if !complete {
+		if _, err := fmt.Fprintf(res, "event: %s\ndata: {}\n\n", sseResetEvent); err != nil {
+			return nil
+		}
+	}
+	for _, event := range replay {
+		if err := writeSSEEvent(res, event); err != nil {
+			return nil
+		}
+	}
+	res.Flush()
+
+	ctx := c.Request().Context()
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := writeSSEEvent(res, event); err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, payload)
+	return err
+}
+
+// publish sends an event to the real-time subscribers. It runs after the
+// change is committed; a failure only affects live updates so it is logged.
+func (h *Handler) publish(eventType string, postID uint, payload interface{}) {
+	if err := h.events.Publish(eventType, postID, payload); err != nil {
+		slog.Error("Failed to publish event", "type", eventType, "error", err)
+	}
+}
+
+// publishLikeCount publishes the current like count of a post
+func (h *Handler) publishLikeCount(ctx context.Context, postID int) {
+	count, err := h.models.Like.CountLikes(ctx, postID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count likes for event", "error", err)
+		return
+	}
+	h.publish(events.TypeLikesUpdated, uint(postID), map[string]int{"like_count": count})
+}
+
+// commentCount returns the comment count sent along with comment events
+func (h *Handler) commentCount(ctx context.Context, postID uint) int {
+	count, err := h.models.Comment.GetCommentCount(ctx, int(postID))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count comments for event", "error", err)
+	}
+	return count
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"github.com/Ahmad-mufied/iducate-community-service/utils"
+	"github.com/Ahmad-mufied/iducate-community-service/webhooks"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (h *Handler) CreateWebhookEndpointHandler(c echo.Context) error {
+	var req = new(data.CreateWebhookEndpointRequest)
+	if err := c.Bind(req); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid request body")
+	}
+
+	// Validate
+	err := h.validate.Struct(req)
+	if err != nil {
+		// Format the validation errors
+		return utils.NewValidationError(utils.FormatValidationErrors(err))
+	}
+	for _, eventType := range req.EventTypes {
+		if !isWebhookType(eventType) {
+			return constants.ErrBadRequest.WithDetail("Unknown event type " + strconv.Quote(eventType))
+		}
+	}
+
+	if req.Secret == "" {
+		req.Secret, err = webhooks.NewSecret()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	endpoint, err := h.models.Webhook.CreateWebhookEndpoint(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	// The secret is only ever shown here
+	return c.JSON(http.StatusCreated, endpoint)
+}
+
+func (h *Handler) GetWebhookEndpointsHandler(c echo.Context) error {
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	endpoints, err := h.models.Webhook.GetWebhookEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"endpoints": endpoints})
+}
+
+func (h *Handler) DeleteWebhookEndpointHandler(c echo.Context) error {
+	// Parse endpoint ID from URL parameter
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid endpoint ID")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	if err := h.models.Webhook.DeleteWebhookEndpoint(ctx, uint(endpointID)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook endpoint deleted successfully"})
+}
+
+func (h *Handler) GetWebhookDeliveriesHandler(c echo.Context) error {
+	// Parse query parameters
+	var query data.WebhookDeliveryQuery
+	if err := query.Parse(c); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid query parameters")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	deliveries, err := h.models.Webhook.GetWebhookDeliveries(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"deliveries": deliveries})
+}
+
+func (h *Handler) ReplayWebhookEventHandler(c echo.Context) error {
+	// Parse event ID from URL parameter
+	eventID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid event ID")
+	}
+
+	// Optionally limit the replay to one endpoint
+	var req struct {
+		EndpointID uint `json:"endpoint_id"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid request body")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	replayed, err := h.models.Webhook.ReplayOutboxEvent(ctx, uint(eventID), req.EndpointID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]int{"replayed": replayed})
+}
+
+func (h *Handler) ReplayWebhookEndpointHandler(c echo.Context) error {
+	// Parse endpoint ID from URL parameter
+	endpointID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid endpoint ID")
+	}
+
+	// Replay the events since a time, or the dead deliveries without one
+	var req struct {
+		Since *time.Time `json:"since"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid request body")
+	}
+
+	// Use the request's context
+	ctx := c.Request().Context()
+
+	replayed, err := h.models.Webhook.ReplayWebhookEndpoint(ctx, uint(endpointID), req.Since)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]int{"replayed": replayed})
+}
+
+func isWebhookType(eventType string) bool {
+	for _, t := range webhooks.Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/realtime"
+	"github.com/Ahmad-mufied/iducate-community-service/server/middlewares"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strconv"
+)
+
+// upgrader accepts any origin, matching the CORS policy of the API
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// PostWebSocketHandler upgrades to a WebSocket receiving the comment events
+// and typing indicators of a post
+func (h *Handler) PostWebSocketHandler(c echo.Context) error {
+	userID := middlewares.GetUserID(c)
+
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return constants.ErrBadRequest.WithDetail("Invalid post ID")
+	}
+
+	exists, err := h.models.Post.CheckPostByID(c.Request().Context(), uint(postID))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return constants.ErrNotFound.WithDetail("post not found")
+	}
+
+	if err := h.live.Reserve(userID); err != nil {
+		if errors.Is(err, realtime.ErrTooManyConnections) {
+			return constants.ErrTooManyRequests.WithDetail("Too many open connections")
+		}
+		return err
+	}
+
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		h.live.Release(userID)
+		return nil
+	}
+
+	h.live.Serve(conn, uint(postID), userID, middlewares.GetUsername(c))
+	return nil
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"github.com/Ahmad-mufied/iducate-community-service/health"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// HealthRoutes registers the probes of the orchestrator. /healthz answers
+// as long as the process serves requests, /readyz only while it can take
+// traffic.
+func HealthRoutes(e *echo.Echo, checker *health.Checker) {
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": health.StatusOK})
+	})
+
+	e.GET("/readyz", func(c echo.Context) error {
+		report := checker.Ready(c.Request().Context())
+		if report.Status != health.StatusOK {
+			return c.JSON(http.StatusServiceUnavailable, report)
+		}
+		return c.JSON(http.StatusOK, report)
+	})
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/labstack/echo/v4"
+)
+
+// AdminKeyHeader carries the admin API key
+const AdminKeyHeader = "X-Admin-Key"
+
+// AdminKeyMiddleware lets through requests carrying apiKey in the
+// X-Admin-Key header. An empty apiKey disables the admin API.
+func AdminKeyMiddleware(apiKey string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if apiKey == "" {
+				return constants.ErrForbidden.WithDetail("Admin API is disabled")
+			}
+
+			key := c.Request().Header.Get(AdminKeyHeader)
+			if key == "" {
+				return constants.ErrUnauthorized.WithDetail("Missing " + AdminKeyHeader + " header")
+			}
+			if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) != 1 {
+				return constants.ErrUnauthorized.WithDetail("Invalid admin API key")
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/cache"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPCacheConfig controls the conditional request middleware
+type HTTPCacheConfig struct {
+	// MaxAge is how long shared caches and browsers may reuse an anonymous
+	// response without revalidating
+	MaxAge time.Duration
+	// Versions remembers when each URL last produced a different ETag so
+	// Last-Modified stays stable across requests and replicas
+	Versions cache.Store
+	// VersionTTL is how long a remembered version is kept
+	VersionTTL time.Duration
+	// Private makes every response `private, no-cache` so each view reaches
+	// the handler, revalidating with the ETag instead of being served by a
+	// shared cache
+	Private bool
+}
+
+// HTTPCacheMiddleware adds ETag, Last-Modified and Cache-Control headers to
+// successful GET responses and answers matching If-None-Match or
+// If-Modified-Since requests with 304 Not Modified.
+//
+// Responses to requests carrying credentials are marked private so shared
+// caches never hand viewer-specific data to someone else.
+func HTTPCacheMiddleware(config HTTPCacheConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				return next(c)
+			}
+
+			res := c.Response()
+			original := res.Writer
+			buffer := &bufferedResponseWriter{ResponseWriter: original, status: http.StatusOK}
+			res.Writer = buffer
+
+			err := next(c)
+			res.Writer = original
+			if err != nil && !buffer.wroteHeader {
+				// Nothing was written yet, let the error handler respond
+				return err
+			}
+
+			header := res.Header()
+			if buffer.status == http.StatusOK {
+				body := buffer.body.Bytes()
+				etag := computeETag(body)
+				modified := lastModified(req.Context(), config, req.URL.RequestURI(), etag)
+
+				header.Set(echo.HeaderVary, "Authorization, id_token")
+				header.Set("Cache-Control", cacheControl(req, config))
+				header.Set("ETag", etag)
+				header.Set(echo.HeaderLastModified, modified.Format(http.TimeFormat))
+
+				if notModified(req, etag, modified) {
+					header.Del(echo.HeaderContentType)
+					header.Del(echo.HeaderContentLength)
+					res.Status = http.StatusNotModified
+					original.WriteHeader(http.StatusNotModified)
+					return err
+				}
+			}
+
+			original.WriteHeader(buffer.status)
+			if _, writeErr := original.Write(buffer.body.Bytes()); writeErr != nil {
+				slog.ErrorContext(req.Context(), "Failed to write response", "error", writeErr)
+			}
+			return err
+		}
+	}
+}
+
+// hasCredentials reports whether the request was made on behalf of a user
+func hasCredentials(req *http.Request) bool {
+	return req.Header.Get("id_token") != "" || req.Header.Get(echo.HeaderAuthorization) != ""
+}
+
+func cacheControl(req *http.Request, config HTTPCacheConfig) string {
+	if config.Private || hasCredentials(req) {
+		return "private, no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", int(config.MaxAge.Seconds()))
+}
+
+// computeETag returns a strong validator for the response body
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// lastModified returns when uri first produced etag. Responses are built from
+// several rows without a single modification time, so the time a
+// representation was first served stands in for it.
+func lastModified(ctx context.Context, config HTTPCacheConfig, uri, etag string) time.Time {
+	now := time.Now().UTC().Truncate(time.Second)
+	if config.Versions == nil {
+		return now
+	}
+
+	key := "http:version:" + uri
+	value, ok, err := config.Versions.Get(ctx, key)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read cache key", "key", key, "error", err)
+		return now
+	}
+	if ok {
+		if seenETag, seenAt, found := strings.Cut(string(value), " "); found && seenETag == etag {
+			if unix, err := strconv.ParseInt(seenAt, 10, 64); err == nil {
+				return time.Unix(unix, 0).UTC()
+			}
+		}
+	}
+
+	value = []byte(etag + " " + strconv.FormatInt(now.Unix(), 10))
+	if err := config.Versions.Set(ctx, key, value, config.VersionTTL); err != nil {
+		slog.ErrorContext(ctx, "Failed to write cache key", "key", key, "error", err)
+	}
+	return now
+}
+
+// notModified evaluates the conditional headers, If-None-Match taking
+// precedence over If-Modified-Since as in RFC 9110
+func notModified(req *http.Request, etag string, modified time.Time) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := req.Header.Get(echo.HeaderIfModifiedSince); since != "" {
+		sinceTime, err := http.ParseTime(since)
+		return err == nil && !modified.After(sinceTime)
+	}
+	return false
+}
+
+// bufferedResponseWriter holds the response back until the validators are
+// known, since headers can't change once the body is written
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
+
+// Flush is a no-op, the body is sent once the handler returns
+func (w *bufferedResponseWriter) Flush() {}
@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"github.com/Ahmad-mufied/iducate-community-service/cache"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// cachedRequest runs a GET of /posts/1 through the middleware with the given
+// request headers
+func cachedRequest(mw echo.MiddlewareFunc, handler echo.HandlerFunc, headers map[string]string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/posts/1", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	if err := mw(handler)(e.NewContext(req, rec)); err != nil {
+		e.HTTPErrorHandler(err, e.NewContext(req, rec))
+	}
+	return rec
+}
+
+func testHTTPCacheConfig() HTTPCacheConfig {
+	return HTTPCacheConfig{MaxAge: 10 * time.Second, Versions: cache.NewLRU(10), VersionTTL: time.Hour}
+}
+
+func TestHTTPCacheControl(t *testing.T) {
+	handler := func(c echo.Context) error { return c.JSON(http.StatusOK, map[string]int{"id": 1}) }
+	private := testHTTPCacheConfig()
+	private.Private = true
+
+	tests := []struct {
+		name    string
+		config  HTTPCacheConfig
+		headers map[string]string
+		want    string
+	}{
+		{"anonymous", testHTTPCacheConfig(), nil, "public, max-age=10"},
+		{"id_token", testHTTPCacheConfig(), map[string]string{"id_token": "token"}, "private, no-cache"},
+		{"authorization", testHTTPCacheConfig(), map[string]string{echo.HeaderAuthorization: "Bearer token"}, "private, no-cache"},
+		{"private anonymous", private, nil, "private, no-cache"},
+	}
+	for _, tt := range tests {
+		rec := cachedRequest(HTTPCacheMiddleware(tt.config), handler, tt.headers)
+		if got := rec.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s: got Cache-Control %q, want %q", tt.name, got, tt.want)
+		}
+		if rec.Header().Get("ETag") == "" || rec.Header().Get(echo.HeaderLastModified) == "" {
+			t.Errorf("%s: validators missing", tt.name)
+		}
+	}
+}
+
+func TestHTTPCacheRevalidation(t *testing.T) {
+	config := testHTTPCacheConfig()
+	config.Private = true
+	mw := HTTPCacheMiddleware(config)
+
+	calls := 0
+	body := "v1"
+	handler := func(c echo.Context) error {
+		calls++
+		return c.String(http.StatusOK, body)
+	}
+
+	first := cachedRequest(mw, handler, nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || first.Body.String() != "v1" {
+		t.Fatalf("got %d %q, want 200 v1", first.Code, first.Body)
+	}
+
+	// Matching validators get 304 without a body, the handler still runs
+	for name, headers := range map[string]map[string]string{
+		"If-None-Match":     {"If-None-Match": `"other", ` + etag},
+		"If-Modified-Since": {echo.HeaderIfModifiedSince: first.Header().Get(echo.HeaderLastModified)},
+	} {
+		rec := cachedRequest(mw, handler, headers)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("%s: got %d %q, want 304 without body", name, rec.Code, rec.Body)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("handler ran %d times, want every request counted", calls)
+	}
+
+	// A changed body is sent in full
+	body = "v2"
+	rec := cachedRequest(mw, handler, map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusOK || rec.Body.String() != "v2" || rec.Header().Get("ETag") == etag {
+		t.Fatalf("got %d %q, want the new version", rec.Code, rec.Body)
+	}
+}
+
+func TestHTTPCacheSkipsErrors(t *testing.T) {
+	mw := HTTPCacheMiddleware(testHTTPCacheConfig())
+
+	rec := cachedRequest(mw, func(c echo.Context) error { return echo.ErrNotFound }, nil)
+	if rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" || rec.Header().Get("Cache-Control") != "" {
+		t.Fatalf("got %d with ETag %q and Cache-Control %q, want an uncached 404", rec.Code, rec.Header().Get("ETag"), rec.Header().Get("Cache-Control"))
+	}
+}
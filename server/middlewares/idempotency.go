@@ -0,0 +1,215 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/labstack/echo/v4"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header carrying the client's key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyLease is how long a key stays reserved while its first request
+// runs. A key whose request never finished, e.g. because the process died,
+// can be used again after it instead of after the full TTL.
+const idempotencyLease = time.Minute
+
+// IdempotencyRecord is the first response stored for an idempotency key
+type IdempotencyRecord struct {
+	RequestHash string // Hash of method, path and body of the first request
+	Completed   bool   // False while the first request is still running
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyStore keeps the responses replayed for retried requests
+type IdempotencyStore interface {
+	// Reserve claims key for a new request until the lease ends. When the key
+	// is already taken it returns the existing record and reserved is false.
+	Reserve(ctx context.Context, key string, requestHash string, lease time.Duration) (existing *IdempotencyRecord, reserved bool, err error)
+	// Complete stores the response of the request that reserved key
+	Complete(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error
+	// Release frees key so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyMiddleware replays the first response for requests repeating the
+// same Idempotency-Key, scoped per user. Reusing a key with a different body
+// is answered with 409. Requests without the header pass through.
+func IdempotencyMiddleware(store IdempotencyStore, ttl time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			idempotencyKey := c.Request().Header.Get(IdempotencyKeyHeader)
+			if idempotencyKey == "" {
+				return next(c)
+			}
+
+			// Read the body and put it back for the handler
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return constants.ErrBadRequest.WithDetail("Invalid request body")
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := sha256.New()
+			hash.Write([]byte(c.Request().Method + " " + c.Request().URL.Path + "\n"))
+			hash.Write(body)
+			requestHash := hex.EncodeToString(hash.Sum(nil))
+
+			owner := "ip:" + c.RealIP()
+			if userID := GetUserID(c); userID != "" {
+				owner = "user:" + userID
+			}
+			key := owner + ":" + idempotencyKey
+
+			ctx := c.Request().Context()
+			existing, reserved, err := store.Reserve(ctx, key, requestHash, idempotencyLease)
+			if err != nil {
+				// Fall back to normal processing when the store is unavailable
+				slog.ErrorContext(ctx, "Idempotency store error", "error", err)
+				return next(c)
+			}
+
+			if !reserved {
+				if existing.RequestHash != requestHash {
+					return constants.ErrIdempotencyKeyReused
+				}
+				if !existing.Completed {
+					return constants.ErrIdempotencyKeyInProgress
+				}
+
+				// Replay the stored response
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.Blob(existing.StatusCode, existing.ContentType, existing.Body)
+			}
+
+			// The key is freed even when the client went away
+			release := func() {
+				if releaseErr := store.Release(context.WithoutCancel(ctx), key); releaseErr != nil {
+					slog.ErrorContext(ctx, "Failed to release idempotency key", "error", releaseErr)
+				}
+			}
+
+			// A panicking handler doesn't leave the key reserved
+			defer func() {
+				if r := recover(); r != nil {
+					release()
+					panic(r)
+				}
+			}()
+
+			// Capture the response while writing it to the client
+			capture := &bodyCaptureWriter{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = capture
+
+			err = next(c)
+
+			// Errors, rate limits and server failures may succeed on retry
+			status := c.Response().Status
+			if err != nil || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+				release()
+				return err
+			}
+
+			record := &IdempotencyRecord{
+				RequestHash: requestHash,
+				Completed:   true,
+				StatusCode:  status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				Body:        capture.body.Bytes(),
+			}
+			if completeErr := store.Complete(ctx, key, record, ttl); completeErr != nil {
+				slog.ErrorContext(ctx, "Failed to store idempotent response", "error", completeErr)
+			}
+
+			return nil
+		}
+	}
+}
+
+// bodyCaptureWriter copies everything written to the response
+type bodyCaptureWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore kept in process memory
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]*memoryIdempotencyEntry
+	lastSweep time.Time
+}
+
+type memoryIdempotencyEntry struct {
+	record    IdempotencyRecord
+	expiresAt time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records:   make(map[string]*memoryIdempotencyEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key string, requestHash string, lease time.Duration) (*IdempotencyRecord, bool, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired records once a minute so the map doesn't grow forever
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, entry := range s.records {
+			if !now.Before(entry.expiresAt) {
+				delete(s.records, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if entry, ok := s.records[key]; ok && now.Before(entry.expiresAt) {
+		record := entry.record
+		return &record, false, nil
+	}
+
+	s.records[key] = &memoryIdempotencyEntry{
+		record:    IdempotencyRecord{RequestHash: requestHash},
+		expiresAt: now.Add(lease),
+	}
+	return nil, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = &memoryIdempotencyEntry{
+		record:    *record,
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,160 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// leaseStore records the lease requested by the middleware
+type leaseStore struct {
+	*MemoryIdempotencyStore
+	lease time.Duration
+}
+
+func (s *leaseStore) Reserve(ctx context.Context, key string, requestHash string, lease time.Duration) (*IdempotencyRecord, bool, error) {
+	s.lease = lease
+	return s.MemoryIdempotencyStore.Reserve(ctx, key, requestHash, lease)
+}
+
+// idempotentRequest runs a POST through the middleware as userID
+func idempotentRequest(mw echo.MiddlewareFunc, handler echo.HandlerFunc, userID, key, body string) (*httptest.ResponseRecorder, error) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("user_id", userID)
+	return rec, mw(handler)(c)
+}
+
+// countingHandler answers status and counts its calls
+func countingHandler(calls *int, status int) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		*calls++
+		return c.JSON(status, map[string]int{"call": *calls})
+	}
+}
+
+func TestIdempotencyReplaysFirstResponse(t *testing.T) {
+	store := &leaseStore{MemoryIdempotencyStore: NewMemoryIdempotencyStore()}
+	mw := IdempotencyMiddleware(store, time.Hour)
+	calls := 0
+	handler := countingHandler(&calls, http.StatusCreated)
+
+	first, err := idempotentRequest(mw, handler, "alice", "k1", `{"title":"a"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.lease != idempotencyLease {
+		t.Fatalf("reserved for %s, want the %s lease", store.lease, idempotencyLease)
+	}
+
+	replay, err := idempotentRequest(mw, handler, "alice", "k1", `{"title":"a"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want once", calls)
+	}
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() || replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("got %d %q, want the replayed %d %q", replay.Code, replay.Body, first.Code, first.Body)
+	}
+
+	// Keys are scoped per user
+	if _, err := idempotentRequest(mw, handler, "bob", "k1", `{"title":"a"}`); err != nil || calls != 2 {
+		t.Fatalf("got %v after %d calls, want bob's request handled", err, calls)
+	}
+}
+
+func TestIdempotencyRejectsReusedKey(t *testing.T) {
+	mw := IdempotencyMiddleware(NewMemoryIdempotencyStore(), time.Hour)
+	calls := 0
+	handler := countingHandler(&calls, http.StatusCreated)
+
+	if _, err := idempotentRequest(mw, handler, "alice", "k1", `{"title":"a"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idempotentRequest(mw, handler, "alice", "k1", `{"title":"b"}`); err != constants.ErrIdempotencyKeyReused {
+		t.Fatalf("got %v, want ErrIdempotencyKeyReused", err)
+	}
+}
+
+func TestIdempotencyRejectsKeyInProgress(t *testing.T) {
+	mw := IdempotencyMiddleware(NewMemoryIdempotencyStore(), time.Hour)
+	calls := 0
+
+	// The handler of the first request retries while it still holds the key
+	var nested error
+	handler := func(c echo.Context) error {
+		_, nested = idempotentRequest(mw, countingHandler(&calls, http.StatusCreated), "alice", "k1", `{}`)
+		return c.NoContent(http.StatusCreated)
+	}
+	if _, err := idempotentRequest(mw, handler, "alice", "k1", `{}`); err != nil {
+		t.Fatal(err)
+	}
+	if nested != constants.ErrIdempotencyKeyInProgress || calls != 0 {
+		t.Fatalf("got %v after %d calls, want ErrIdempotencyKeyInProgress", nested, calls)
+	}
+}
+
+func TestIdempotencyReleasesFailedRequests(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	mw := IdempotencyMiddleware(store, time.Hour)
+
+	failures := map[string]echo.HandlerFunc{
+		"error":        func(c echo.Context) error { return constants.ErrBadRequest },
+		"server error": func(c echo.Context) error { return c.NoContent(http.StatusServiceUnavailable) },
+		"rate limited": func(c echo.Context) error { return c.NoContent(http.StatusTooManyRequests) },
+	}
+	for name, handler := range failures {
+		_, _ = idempotentRequest(mw, handler, "alice", name, `{}`)
+
+		// The retry runs the handler again
+		calls := 0
+		if _, err := idempotentRequest(mw, countingHandler(&calls, http.StatusCreated), "alice", name, `{}`); err != nil || calls != 1 {
+			t.Errorf("%s: got %v after %d calls, want the retry handled", name, err, calls)
+		}
+	}
+}
+
+func TestIdempotencyReleasesOnPanic(t *testing.T) {
+	mw := IdempotencyMiddleware(NewMemoryIdempotencyStore(), time.Hour)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic was swallowed")
+			}
+		}()
+		_, _ = idempotentRequest(mw, func(c echo.Context) error { panic("boom") }, "alice", "k1", `{}`)
+	}()
+
+	calls := 0
+	if _, err := idempotentRequest(mw, countingHandler(&calls, http.StatusCreated), "alice", "k1", `{}`); err != nil || calls != 1 {
+		t.Fatalf("got %v after %d calls, want the retry handled", err, calls)
+	}
+}
+
+func TestMemoryIdempotencyStoreLeaseExpires(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	ctx := context.Background()
+
+	if _, reserved, _ := store.Reserve(ctx, "k1", "h", 10*time.Millisecond); !reserved {
+		t.Fatal("fresh key not reserved")
+	}
+	if _, reserved, _ := store.Reserve(ctx, "k1", "h", 10*time.Millisecond); reserved {
+		t.Fatal("key reserved twice")
+	}
+
+	// An abandoned reservation frees the key once its lease ends
+	time.Sleep(20 * time.Millisecond)
+	if _, reserved, _ := store.Reserve(ctx, "k1", "h", time.Minute); !reserved {
+		t.Fatal("key still taken after the lease")
+	}
+}
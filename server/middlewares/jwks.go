@@ -0,0 +1,150 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/utils"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval is the least time between two fetches of the key set.
+// Tokens signed with an unknown key trigger a fetch, so rotated keys are
+// picked up without letting forged key IDs hammer the user pool.
+const jwksRefreshInterval = time.Minute
+
+// JWKS holds the public keys ID tokens are signed with, fetched from a JSON
+// Web Key Set such as https://cognito-idp.<region>.amazonaws.com/<pool>/.well-known/jwks.json
+type JWKS struct {
+	url string
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey // By key ID
+	fetchedAt time.Time                 // Last fetch, successful or not
+}
+
+type jsonWebKey struct {
+	KeyID   string `json:"kid"`
+	KeyType string `json:"kty"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+// NewJWKS creates a key set fetched from url on first use
+func NewJWKS(url string) *JWKS {
+	return &JWKS{url: url, keys: make(map[string]*rsa.PublicKey)}
+}
+
+// Refresh fetches the key set. The keys fetched before are kept when it fails.
+func (k *JWKS) Refresh(ctx context.Context) error {
+	keys, err := k.fetch(ctx)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.fetchedAt = time.Now()
+	if err != nil {
+		return err
+	}
+	k.keys = keys
+	return nil
+}
+
+func (k *JWKS) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	body, err := utils.RequestGET(ctx, k.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	// Only RSA signing keys are used for ID tokens
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.rsaPublicKey()
+		if err != nil {
+			slog.WarnContext(ctx, "Skipping invalid JWKS key", "kid", jwk.KeyID, "error", err)
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no RSA signing keys")
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("unsupported exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// Key returns the key with the ID, fetching the key set again when it is
+// unknown and the last fetch is old enough
+func (k *JWKS) Key(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	k.mu.RLock()
+	key, ok := k.keys[keyID]
+	stale := time.Since(k.fetchedAt) >= jwksRefreshInterval
+	k.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if stale {
+		if err := k.Refresh(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to refresh JWKS", "error", err)
+		}
+		k.mu.RLock()
+		key, ok = k.keys[keyID]
+		k.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", keyID)
+}
+
+// Check is the readiness check of the key set: it passes once keys are
+// loaded, fetching them when they aren't yet
+func (k *JWKS) Check(ctx context.Context) error {
+	k.mu.RLock()
+	loaded := len(k.keys) > 0
+	k.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	if err := k.Refresh(ctx); err != nil {
+		// The error may name internal hosts, it is only logged
+		slog.WarnContext(ctx, "Loading JWKS failed", "error", err)
+		return errors.New("signing keys not loaded")
+	}
+	return nil
+}
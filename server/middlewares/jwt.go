@@ -1,26 +1,36 @@
 package middlewares
 
 import (
+	"context"
 	"errors"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/logging"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"strings"
 )
 
-// CognitoJWTMiddleware extracts and parses the Cognito ID token from headers
-func CognitoJWTMiddleware() echo.MiddlewareFunc {
+// CognitoJWTMiddleware extracts and parses the Cognito ID token from headers.
+// The token's signature and expiry are verified against keys; without keys
+// the token is only decoded, which is meant for development.
+func CognitoJWTMiddleware(keys *JWKS) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			// Extract ID token from headers
 			idToken := c.Request().Header.Get("id_token")
 			if idToken == "" {
-				return echo.NewHTTPError(401, "Missing id_token in headers")
+				return constants.ErrUnauthorized.WithDetail("Missing id_token in headers")
 			}
 
-			// Decode token without signature verification
-			claims, err := decodeIDToken(idToken)
+			var claims jwt.MapClaims
+			var err error
+			if keys != nil {
+				claims, err = verifyIDToken(c.Request().Context(), idToken, keys)
+			} else {
+				claims, err = decodeIDToken(idToken)
+			}
 			if err != nil {
-				return echo.NewHTTPError(401, err.Error())
+				return constants.ErrUnauthorized.WithDetail(err.Error())
 			}
 
 			// Set token claims in context for later use
@@ -28,11 +38,51 @@ func CognitoJWTMiddleware() echo.MiddlewareFunc {
 			c.Set("user_id", claims["sub"])
 			c.Set("name", claims["name"])
 
+			// Log lines of the request name the user
+			if userID := GetUserID(c); userID != "" {
+				c.SetRequest(c.Request().WithContext(logging.WithUserID(c.Request().Context(), userID)))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// IDTokenFromQuery lets clients that can't set headers, such as browsers
+// opening a WebSocket, pass the ID token as the id_token query parameter.
+// Use it in front of CognitoJWTMiddleware on those routes only.
+func IDTokenFromQuery() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("id_token") == "" {
+				if idToken := c.QueryParam("id_token"); idToken != "" {
+					c.Request().Header.Set("id_token", idToken)
+				}
+			}
 			return next(c)
 		}
 	}
 }
 
+// verifyIDToken parses the JWT token and checks it was signed with one of
+// keys and hasn't expired
+func verifyIDToken(ctx context.Context, tokenString string, keys *JWKS) (jwt.MapClaims, error) {
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		return keys.Key(ctx, keyID)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, errors.New("id_token has expired")
+		}
+		return nil, errors.New("invalid id_token")
+	}
+	return claims, nil
+}
+
 // decodeIDToken decodes the JWT token without signature verification
 func decodeIDToken(tokenString string) (jwt.MapClaims, error) {
 	// Remove "Bearer " prefix if present
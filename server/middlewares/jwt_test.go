@@ -0,0 +1,221 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/Ahmad-mufied/iducate-community-service/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keyServer serves a JWKS with the keys it currently holds
+type keyServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	fetches int
+}
+
+func newKeyServer(t *testing.T) *keyServer {
+	t.Helper()
+
+	ks := &keyServer{keys: map[string]*rsa.PrivateKey{}}
+	ks.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ks.mu.Lock()
+		defer ks.mu.Unlock()
+
+		ks.fetches++
+		var set struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		for kid, key := range ks.keys {
+			set.Keys = append(set.Keys, jsonWebKey{
+				KeyID:   kid,
+				KeyType: "RSA",
+				Use:     "sig",
+				N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(ks.Close)
+	return ks
+}
+
+// addKey generates a signing key published under kid
+func (ks *keyServer) addKey(t *testing.T, kid string) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.mu.Lock()
+	ks.keys[kid] = key
+	ks.mu.Unlock()
+	return key
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "alice", "name": "Alice", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+// authenticate runs a request with idToken through the middleware and
+// returns the user it was made as
+func authenticate(keys *JWKS, idToken string) (string, error) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("id_token", idToken)
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	var userID string
+	err := CognitoJWTMiddleware(keys)(func(c echo.Context) error {
+		userID = GetUserID(c)
+		return nil
+	})(c)
+	return userID, err
+}
+
+func expectUnauthorized(t *testing.T, err error) {
+	t.Helper()
+
+	var apiErr *utils.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode != constants.ErrUnauthorized.ErrorCode {
+		t.Fatalf("got %v, want unauthorized", err)
+	}
+}
+
+func TestCognitoJWTVerifiesSignature(t *testing.T) {
+	ks := newKeyServer(t)
+	key := ks.addKey(t, "k1")
+	keys := NewJWKS(ks.URL)
+
+	userID, err := authenticate(keys, signToken(t, key, "k1", validClaims()))
+	if err != nil || userID != "alice" {
+		t.Fatalf("got %q and %v, want alice", userID, err)
+	}
+
+	// Signed with a key the user pool doesn't publish
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = authenticate(keys, signToken(t, other, "k1", validClaims()))
+	expectUnauthorized(t, err)
+
+	// Expired, or without expiry
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = authenticate(keys, signToken(t, key, "k1", expired))
+	expectUnauthorized(t, err)
+	forever := validClaims()
+	delete(forever, "exp")
+	_, err = authenticate(keys, signToken(t, key, "k1", forever))
+	expectUnauthorized(t, err)
+
+	// Symmetric algorithms aren't accepted
+	hs, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = authenticate(keys, hs)
+	expectUnauthorized(t, err)
+}
+
+func TestCognitoJWTWithoutKeysDecodes(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}).SignedString([]byte("any"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := authenticate(nil, token)
+	if err != nil || userID != "alice" {
+		t.Fatalf("got %q and %v, want alice", userID, err)
+	}
+
+	_, err = authenticate(nil, "")
+	expectUnauthorized(t, err)
+}
+
+func TestJWKSPicksUpRotatedKeys(t *testing.T) {
+	ks := newKeyServer(t)
+	ks.addKey(t, "k1")
+	keys := NewJWKS(ks.URL)
+	ctx := context.Background()
+
+	if _, err := keys.Key(ctx, "k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown keys refetch at most once per interval
+	rotated := ks.addKey(t, "k2")
+	if _, err := keys.Key(ctx, "k2"); err == nil {
+		t.Fatal("key fetched again right away")
+	}
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	keys.mu.Unlock()
+
+	userID, err := authenticate(keys, signToken(t, rotated, "k2", validClaims()))
+	if err != nil || userID != "alice" {
+		t.Fatalf("got %q and %v, want alice", userID, err)
+	}
+	if ks.fetches != 2 {
+		t.Fatalf("fetched %d times, want 2", ks.fetches)
+	}
+}
+
+func TestJWKSCheck(t *testing.T) {
+	ks := newKeyServer(t)
+	keys := NewJWKS(ks.URL)
+	ctx := context.Background()
+
+	// An empty set isn't ready
+	if err := keys.Check(ctx); err == nil {
+		t.Fatal("ready without keys")
+	}
+
+	ks.addKey(t, "k1")
+	if err := keys.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loaded keys survive the user pool being unreachable
+	ks.Close()
+	if err := keys.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.Refresh(ctx); err == nil {
+		t.Fatal("refresh from a closed server succeeded")
+	}
+	if _, err := keys.Key(ctx, "k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewJWKS(ks.URL).Check(ctx); err == nil {
+		t.Fatal("ready without reaching the user pool")
+	}
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"github.com/Ahmad-mufied/iducate-community-service/metrics"
+	"github.com/labstack/echo/v4"
+	"time"
+)
+
+// unmatchedRoute labels requests no route matched, so scanners probing
+// random paths don't create a series per path
+const unmatchedRoute = "unmatched"
+
+// MetricsMiddleware counts requests and their latency by route template and
+// status. Use it before RequestLoggerMiddleware, which writes errors, so the
+// final status is known here.
+func MetricsMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			route := c.Path()
+			if route == "" {
+				route = unmatchedRoute
+			}
+			metrics.ObserveRequest(c.Request().Method, route, c.Response().Status, time.Since(start))
+
+			return err
+		}
+	}
+}
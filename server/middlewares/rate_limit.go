@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"context"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/labstack/echo/v4"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitStore keeps the hit counters used by the rate limiter
+type RateLimitStore interface {
+	// Allow records a hit for key and reports whether it is within limit for
+	// the current window. When it is not, retryAfter tells how long until the
+	// window resets.
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// RateLimitQuota is the number of requests allowed per window
+type RateLimitQuota struct {
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitMiddleware limits requests per authenticated user, falling back to
+// the client IP for anonymous routes. The name separates the counters of
+// different routes sharing one store.
+func RateLimitMiddleware(store RateLimitStore, name string, quota RateLimitQuota) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// A zero limit disables the quota
+			if quota.Limit <= 0 {
+				return next(c)
+			}
+
+			key := name + ":ip:" + c.RealIP()
+			if userID := GetUserID(c); userID != "" {
+				key = name + ":user:" + userID
+			}
+
+			allowed, retryAfter, err := store.Allow(c.Request().Context(), key, quota.Limit, quota.Window)
+			if err != nil {
+				// Don't lock users out when the store is unavailable
+				slog.ErrorContext(c.Request().Context(), "Rate limit store error", "error", err)
+				return next(c)
+			}
+
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+				return constants.ErrTooManyRequests
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// MemoryRateLimitStore is a fixed window RateLimitStore kept in process memory
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	windows   map[string]*rateLimitWindow
+	lastSweep time.Time
+}
+
+type rateLimitWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		windows:   make(map[string]*rateLimitWindow),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryRateLimitStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired windows once a minute so the map doesn't grow forever
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, w := range s.windows {
+			if !now.Before(w.resetAt) {
+				delete(s.windows, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &rateLimitWindow{resetAt: now.Add(window)}
+		s.windows[key] = w
+	}
+
+	if w.count >= limit {
+		return false, w.resetAt.Sub(now), nil
+	}
+
+	w.count++
+	return true, 0, nil
+}
@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"github.com/Ahmad-mufied/iducate-community-service/constants"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// limitedRequest runs a request through the middleware as userID, or
+// anonymously from ip when userID is empty
+func limitedRequest(mw echo.MiddlewareFunc, userID, ip string) (*httptest.ResponseRecorder, error) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/posts", nil)
+	req.RemoteAddr = ip + ":1234"
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if userID != "" {
+		c.Set("user_id", userID)
+	}
+	return rec, mw(func(c echo.Context) error { return c.NoContent(http.StatusOK) })(c)
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	mw := RateLimitMiddleware(NewMemoryRateLimitStore(), "posts", RateLimitQuota{Limit: 2, Window: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if _, err := limitedRequest(mw, "alice", "10.0.0.1"); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+
+	rec, err := limitedRequest(mw, "alice", "10.0.0.1")
+	if err != constants.ErrTooManyRequests {
+		t.Fatalf("got %v, want ErrTooManyRequests", err)
+	}
+	retryAfter, _ := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if retryAfter < 1 || retryAfter > 60 {
+		t.Fatalf("got Retry-After %q, want up to a minute", rec.Header().Get("Retry-After"))
+	}
+
+	// Other users and anonymous clients from the same IP have their own quota
+	if _, err := limitedRequest(mw, "bob", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limitedRequest(mw, "", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimitPerIP(t *testing.T) {
+	mw := RateLimitMiddleware(NewMemoryRateLimitStore(), "posts", RateLimitQuota{Limit: 1, Window: time.Minute})
+
+	if _, err := limitedRequest(mw, "", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limitedRequest(mw, "", "10.0.0.1"); err != constants.ErrTooManyRequests {
+		t.Fatalf("got %v, want ErrTooManyRequests", err)
+	}
+	if _, err := limitedRequest(mw, "", "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimitSeparatesRoutes(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	quota := RateLimitQuota{Limit: 1, Window: time.Minute}
+	posts := RateLimitMiddleware(store, "posts", quota)
+	comments := RateLimitMiddleware(store, "comments", quota)
+
+	if _, err := limitedRequest(posts, "alice", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limitedRequest(comments, "alice", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	mw := RateLimitMiddleware(NewMemoryRateLimitStore(), "posts", RateLimitQuota{})
+
+	for i := 0; i < 5; i++ {
+		if _, err := limitedRequest(mw, "alice", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// failingRateLimitStore is an unavailable store
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	return false, 0, errors.New("store down")
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	mw := RateLimitMiddleware(failingRateLimitStore{}, "posts", RateLimitQuota{Limit: 1, Window: time.Minute})
+
+	if _, err := limitedRequest(mw, "alice", "10.0.0.1"); err != nil {
+		t.Fatalf("got %v, want the request let through", err)
+	}
+}
+
+func TestMemoryRateLimitStoreWindowResets(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	ctx := context.Background()
+
+	if allowed, _, _ := store.Allow(ctx, "k", 1, 20*time.Millisecond); !allowed {
+		t.Fatal("first hit refused")
+	}
+	allowed, retryAfter, _ := store.Allow(ctx, "k", 1, 20*time.Millisecond)
+	if allowed || retryAfter <= 0 || retryAfter > 20*time.Millisecond {
+		t.Fatalf("got %v and retry after %s, want refused until the window ends", allowed, retryAfter)
+	}
+
+	time.Sleep(retryAfter + 5*time.Millisecond)
+	if allowed, _, _ := store.Allow(ctx, "k", 1, 20*time.Millisecond); !allowed {
+		t.Fatal("hit refused in a new window")
+	}
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/Ahmad-mufied/iducate-community-service/logging"
+	"github.com/labstack/echo/v4"
+	"regexp"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = echo.HeaderXRequestID
+
+// requestIDPattern limits the request IDs accepted from clients, so they
+// can't inject anything into the logs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware takes the request ID from the X-Request-ID header or
+// generates one, echoes it in the response and puts it in the request
+// context, where the logger and the error handler pick it up
+func RequestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			requestID := c.Request().Header.Get(RequestIDHeader)
+			if !requestIDPattern.MatchString(requestID) {
+				requestID = newRequestID()
+			}
+
+			c.Response().Header().Set(RequestIDHeader, requestID)
+			c.SetRequest(c.Request().WithContext(logging.WithRequestID(c.Request().Context(), requestID)))
+
+			return next(c)
+		}
+	}
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,87 @@
+package middlewares
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// redactedQueryParams carry credentials, e.g. the ID token of WebSocket
+// connections, and are never logged
+var redactedQueryParams = []string{"id_token", "token"}
+
+// RequestLoggerMiddleware logs every request as one JSON line with its route,
+// status and latency. The request and user IDs come from the context, so
+// use it behind RequestIDMiddleware.
+func RequestLoggerMiddleware() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		// Let the error handler set the status before it is logged
+		HandleError:  true,
+		LogLatency:   true,
+		LogMethod:    true,
+		LogURI:       true,
+		LogRoutePath: true,
+		LogStatus:    true,
+		LogRemoteIP:  true,
+		LogUserAgent: true,
+		LogError:     true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			switch {
+			case v.Status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case v.Status >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", redactURI(c.Request().URL)),
+				slog.String("route", v.RoutePath),
+				slog.Int("status", v.Status),
+				slog.Float64("latency_ms", float64(v.Latency.Microseconds())/1000),
+				slog.String("remote_ip", v.RemoteIP),
+				slog.String("user_agent", v.UserAgent),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+
+			slog.LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
+
+// redactURI returns the path and query of u with the values of credential
+// parameters replaced
+func redactURI(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for _, param := range redactedQueryParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.RequestURI()
+	}
+
+	copied := *u
+	copied.RawQuery = query.Encode()
+	return copied.RequestURI()
+}
+
+// RecoverMiddleware turns panics into 500 responses and logs them with their
+// stack like every other log line
+func RecoverMiddleware() echo.MiddlewareFunc {
+	return middleware.RecoverWithConfig(middleware.RecoverConfig{
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			slog.ErrorContext(c.Request().Context(), "Recovered from panic", "error", err, "stack", string(stack))
+			return err
+		},
+	})
+}
@@ -1,44 +1,153 @@
 package server
 
 import (
+	"github.com/Ahmad-mufied/iducate-community-service/cache"
+	"github.com/Ahmad-mufied/iducate-community-service/config"
+	"github.com/Ahmad-mufied/iducate-community-service/metrics"
 	"github.com/Ahmad-mufied/iducate-community-service/server/handler"
 	"github.com/Ahmad-mufied/iducate-community-service/server/middlewares"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"net/http"
+	"time"
 )
 
-func Routes(e *echo.Echo) {
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
+// Routes registers the API. ID tokens are verified against keys, or only
+// decoded when keys is nil.
+func Routes(e *echo.Echo, h *handler.Handler, keys *middlewares.JWKS) {
+	e.HTTPErrorHandler = HTTPErrorHandler
 
-	e.GET("/posts", handler.GetPaginatedPostsHandler) // Get paginated and sorted list of posts
-	e.GET("/posts/:id", handler.GetPostDetailHandler)
+	e.Use(middlewares.RequestIDMiddleware())
+	e.Use(middlewares.TracingMiddleware())
+	e.Use(middlewares.MetricsMiddleware())
+	e.Use(middlewares.RequestLoggerMiddleware())
+	e.Use(middlewares.RecoverMiddleware())
 
-	e.POST("/posts", handler.CreatePostHandler, middlewares.CognitoJWTMiddleware())       // Create a new post
-	e.DELETE("/posts/:id", handler.DeletePostHandler, middlewares.CognitoJWTMiddleware()) // Delete a post by ID
+	auth := middlewares.CognitoJWTMiddleware(keys)
+
+	// Per-user quotas on write endpoints
+	rateLimitStore := middlewares.NewMemoryRateLimitStore()
+	postsLimit := middlewares.RateLimitMiddleware(rateLimitStore, "posts", middlewares.RateLimitQuota{
+		Limit:  getIntOrDefault("RATE_LIMIT_POSTS_PER_HOUR", 10),
+		Window: time.Hour,
+	})
+	commentsLimit := middlewares.RateLimitMiddleware(rateLimitStore, "comments", middlewares.RateLimitQuota{
+		Limit:  getIntOrDefault("RATE_LIMIT_COMMENTS_PER_MINUTE", 10),
+		Window: time.Minute,
+	})
+	likesLimit := middlewares.RateLimitMiddleware(rateLimitStore, "likes", middlewares.RateLimitQuota{
+		Limit:  getIntOrDefault("RATE_LIMIT_LIKES_PER_MINUTE", 30),
+		Window: time.Minute,
+	})
+
+	// Replay responses of retried create requests
+	idempotencyTTL := 24 * time.Hour
+	if config.Viper.IsSet("IDEMPOTENCY_TTL") {
+		idempotencyTTL = config.Viper.GetDuration("IDEMPOTENCY_TTL")
+	}
+	idempotency := middlewares.IdempotencyMiddleware(middlewares.NewMemoryIdempotencyStore(), idempotencyTTL)
+
+	// Conditional GETs on read endpoints
+	httpCacheMaxAge := 10 * time.Second
+	if config.Viper.IsSet("HTTP_CACHE_MAX_AGE") {
+		httpCacheMaxAge = config.Viper.GetDuration("HTTP_CACHE_MAX_AGE")
+	}
+	httpCacheConfig := middlewares.HTTPCacheConfig{
+		MaxAge:     httpCacheMaxAge,
+		Versions:   cache.NewLRU(getIntOrDefault("HTTP_CACHE_VERSIONS", 10000)),
+		VersionTTL: 24 * time.Hour,
+	}
+	httpCache := middlewares.HTTPCacheMiddleware(httpCacheConfig)
+
+	// Post detail counts views, so every request has to reach the handler
+	httpCacheConfig.Private = true
+	httpCachePrivate := middlewares.HTTPCacheMiddleware(httpCacheConfig)
+
+	e.GET("/posts", h.GetPaginatedPostsHandler, httpCache) // Get paginated and sorted list of posts
+	e.GET("/posts/:id", h.GetPostDetailHandler, httpCachePrivate)
+
+	e.POST("/posts", h.CreatePostHandler, auth, idempotency, postsLimit) // Create a new post
+	e.DELETE("/posts/:id", h.DeletePostHandler, auth)                    // Delete a post by ID
 
 	// Add CORS middleware
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
 		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAuthorization},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAuthorization, middlewares.IdempotencyKeyHeader,
+			"If-None-Match", echo.HeaderIfModifiedSince, "Last-Event-ID", middlewares.RequestIDHeader,
+			"traceparent", "tracestate"},
+		ExposeHeaders: []string{"ETag", middlewares.RequestIDHeader},
 	}))
-	
+
 	// Commnet
 	commentGroup := e.Group("/comments")
-	commentGroup.GET("/post/:post_id", handler.GetUpdatedCommentCountHandler) // Get comments for a post
+	commentGroup.GET("/post/:post_id", h.GetUpdatedCommentCountHandler, httpCache) // Get comments for a post
 	// Comment a post
-	commentGroup.POST("/post/:post_id", handler.CreateCommentHandler, middlewares.CognitoJWTMiddleware()) // Get paginated comments for a post
+	commentGroup.POST("/post/:post_id", h.CreateCommentHandler, auth, idempotency, commentsLimit) // Get paginated comments for a post
+	// Edit a comment
+	e.PUT("/comments/:id", h.UpdateCommentHandler, auth, commentsLimit)
 	// Delete a comment
-	e.DELETE("/comments/:id", handler.DeleteCommentHandler, middlewares.CognitoJWTMiddleware()) // Delete a comment by ID
+	e.DELETE("/comments/:id", h.DeleteCommentHandler, auth) // Delete a comment by ID
+
+	// Real-time updates as Server-Sent Events
+	e.GET("/stream/feed", h.StreamFeedHandler)
+	e.GET("/stream/posts/:id", h.StreamPostHandler)
+
+	// Live comment thread over WebSocket
+	e.GET("/ws/posts/:id", h.PostWebSocketHandler, middlewares.IDTokenFromQuery(), auth)
+
+	// Notifications and their settings of the authenticated user
+	meGroup := e.Group("/me", auth)
+	meGroup.GET("/notifications", h.GetNotificationsHandler)                         // Paginated, ?unread=true for unread only
+	meGroup.GET("/notifications/unread-count", h.GetUnreadNotificationCountHandler)  // Badge count
+	meGroup.POST("/notifications/read-all", h.MarkAllNotificationsReadHandler)       // Mark every notification as read
+	meGroup.POST("/notifications/:id/read", h.MarkNotificationReadHandler)           // Mark one notification as read
+	meGroup.GET("/notification-preferences", h.GetNotificationPreferencesHandler)    // Channels per notification type
+	meGroup.PUT("/notification-preferences", h.UpdateNotificationPreferencesHandler) // Change some channels
+	meGroup.GET("/digest", h.GetDigestPreferenceHandler)                             // Email digest frequency
+	meGroup.PUT("/digest", h.UpdateDigestPreferenceHandler)                          // daily, weekly or off
+
+	// Unsubscribe links of the digest emails
+	e.GET("/digest/unsubscribe", h.UnsubscribePageHandler)    // ?token=<token>, asks for confirmation
+	e.POST("/digest/unsubscribe", h.UnsubscribeDigestHandler) // ?token=<token>, also RFC 8058 one-click
+
+	// Mention autocomplete
+	e.GET("/users/search", h.SearchUsersHandler, auth) // ?q=<prefix>
+
+	// Webhook administration for other iducate services, behind ADMIN_API_KEY
+	adminGroup := e.Group("/admin", middlewares.AdminKeyMiddleware(config.Viper.GetString("ADMIN_API_KEY")))
+	adminGroup.POST("/webhooks/endpoints", h.CreateWebhookEndpointHandler)            // Register an endpoint
+	adminGroup.GET("/webhooks/endpoints", h.GetWebhookEndpointsHandler)               // List endpoints
+	adminGroup.DELETE("/webhooks/endpoints/:id", h.DeleteWebhookEndpointHandler)      // Remove an endpoint
+	adminGroup.POST("/webhooks/endpoints/:id/replay", h.ReplayWebhookEndpointHandler) // Replay dead deliveries or events since a time
+	adminGroup.GET("/webhooks/deliveries", h.GetWebhookDeliveriesHandler)             // ?status=dead&endpoint_id=1
+	adminGroup.POST("/webhooks/events/:id/replay", h.ReplayWebhookEventHandler)       // Replay one event
+
+	adminGroup.GET("/moderation/pending", h.GetPendingContentHandler)            // ?content_type=post|comment
+	adminGroup.POST("/moderation/posts/:id/approve", h.ApprovePostHandler)       // Publish a pending post
+	adminGroup.POST("/moderation/posts/:id/reject", h.RejectPostHandler)         // Turn down a pending post
+	adminGroup.POST("/moderation/comments/:id/approve", h.ApproveCommentHandler) // Publish a pending comment
+	adminGroup.POST("/moderation/comments/:id/reject", h.RejectCommentHandler)   // Turn down a pending comment
+
+	// Prometheus metrics, served on their own port instead when METRICS_PORT is set
+	if config.Viper.GetString("METRICS_PORT") == "" {
+		e.GET("/metrics", echo.WrapHandler(metrics.Handler()), middlewares.AdminKeyMiddleware(config.Viper.GetString("ADMIN_API_KEY")))
+	}
 
 	// Like a post
 	// Group by like route
 	likesGroup := e.Group("/likes")
 
-	likesGroup.GET("/post/:post_id", handler.GetLikesCountHandler)                                     // Get total likes for a post
-	likesGroup.POST("/post/:post_id", handler.LikePostHandler, middlewares.CognitoJWTMiddleware())     // Like a post
-	likesGroup.DELETE("/post/:post_id", handler.UnlikePostHandler, middlewares.CognitoJWTMiddleware()) // Unlike a post
+	likesGroup.GET("/post/:post_id", h.GetLikesCountHandler, httpCache)        // Get total likes for a post
+	likesGroup.POST("/post/:post_id", h.LikePostHandler, auth, likesLimit)     // Like a post
+	likesGroup.DELETE("/post/:post_id", h.UnlikePostHandler, auth, likesLimit) // Unlike a post
+
+}
 
+// getIntOrDefault reads an integer setting, falling back when it is unset
+func getIntOrDefault(key string, defaultValue int) int {
+	if !config.Viper.IsSet(key) {
+		return defaultValue
+	}
+	return config.Viper.GetInt(key)
 }
@@ -1,15 +1,23 @@
+-- Sample data for development. Load it into an empty database after the
+-- migrations, e.g.:
+--
+--   go run ./cmd migrate up
+--   psql -h "$DB_HOST" -U "$DB_USER" -d "$DB_NAME" -f sql/Seed.sql
+BEGIN;
 
--- Seeding Data: Users
-INSERT INTO users (id, email, username, gender, country, degree, major)
-VALUES ('b9ba95ec-3041-708f-44b0-bfad168dc0ca', 'john.doe@gmail.com', 'John Doe', 'Man', 'US', 'Bachelor', 'Science'),
+-- Seeding Data: Users. Created long ago so the spam heuristics treat them as
+-- established accounts.
+INSERT INTO users (id, email, username, gender, country, degree, major, created_at)
+VALUES ('b9ba95ec-3041-708f-44b0-bfad168dc0ca', 'john.doe@gmail.com', 'John Doe', 'Man', 'US', 'Bachelor', 'Science',
+        '2024-01-01 00:00:00+00'),
        ('c9eac5bc-d071-70f5-9ece-1ace39ec4cf2', 'jane.smith@gmail.com', 'Jane Smith', 'Women', 'Germany', 'Master',
-        'Art'),
+        'Art', '2024-01-01 00:00:00+00'),
        ('599ac52c-a0c1-70ca-3505-5cdf9f2c54539', 'amir.malaysia@gmail.com', 'Amir Khan', 'Man', 'Malaysia', 'Doctoral',
-        'Social'),
+        'Social', '2024-01-01 00:00:00+00'),
        ('09fad50c-b061-7089-68b0-b900aca5551e', 'lisa.lee@gmail.com', 'Lisa Lee', 'Women', 'Australia', 'Diploma',
-        'Art'),
+        'Art', '2024-01-01 00:00:00+00'),
        ('094ae51c-7091-70da-8ed5-3c8665a3968b', 'emma.clark@gmail.com', 'Emma Clark', 'Women', 'US', 'Bachelor',
-        'Social');
+        'Social', '2024-01-01 00:00:00+00');
 
 -- Seeding Data: Posts
 INSERT INTO posts (user_id, title, content, views)
@@ -22,19 +30,29 @@ VALUES ('b9ba95ec-3041-708f-44b0-bfad168dc0ca', 'My First Post', 'This is the co
        ('094ae51c-7091-70da-8ed5-3c8665a3968b', 'Breaking Barriers',
         'Innovative ideas to break stereotypes in education.', 50);
 
--- Seeding Data: Comments
+-- Seeding Data: Comments. Posts are looked up by title, their IDs depend on
+-- the sequence. The comment and like counters are kept by triggers.
 INSERT INTO comments (post_id, user_id, content)
-VALUES (1, 'c9eac5bc-d071-70f5-9ece-1ace39ec4cf2', 'Great first post! Keep it up.'),
-       (1, '599ac52c-a0c1-70ca-3505-5cdf9f2c54539', 'Nice content. Looking forward to more.'),
-       (2, '09fad50c-b061-7089-68b0-b900aca5551e', 'Amazing insights into art and science.'),
-       (3, 'b9ba95ec-3041-708f-44b0-bfad168dc0ca', 'This is very informative. Thanks for sharing.'),
-       (4, '094ae51c-7091-70da-8ed5-3c8665a3968b', 'Excellent advice for creative projects!');
+SELECT posts.id, seed.user_id, seed.content
+FROM (VALUES ('My First Post', 'c9eac5bc-d071-70f5-9ece-1ace39ec4cf2', 'Great first post! Keep it up.'),
+             ('My First Post', '599ac52c-a0c1-70ca-3505-5cdf9f2c54539', 'Nice content. Looking forward to more.'),
+             ('Art and Science', '09fad50c-b061-7089-68b0-b900aca5551e', 'Amazing insights into art and science.'),
+             ('Social Studies in Malaysia', 'b9ba95ec-3041-708f-44b0-bfad168dc0ca',
+              'This is very informative. Thanks for sharing.'),
+             ('Creative Design', '094ae51c-7091-70da-8ed5-3c8665a3968b', 'Excellent advice for creative projects!'))
+         AS seed (title, user_id, content)
+         JOIN posts ON posts.title = seed.title;
 
 -- Seeding Data: Likes
 INSERT INTO likes (post_id, user_id)
-VALUES (1, 'c9eac5bc-d071-70f5-9ece-1ace39ec4cf2'),
-       (1, '599ac52c-a0c1-70ca-3505-5cdf9f2c54539'),
-       (2, 'b9ba95ec-3041-708f-44b0-bfad168dc0ca'),
-       (3, '09fad50c-b061-7089-68b0-b900aca5551e'),
-       (3, '094ae51c-7091-70da-8ed5-3c8665a3968b'),
-       (4, 'c9eac5bc-d071-70f5-9ece-1ace39ec4cf2');
\ No newline at end of file
+SELECT posts.id, seed.user_id
+FROM (VALUES ('My First Post', 'c9eac5bc-d071-70f5-9ece-1ace39ec4cf2'),
+             ('My First Post', '599ac52c-a0c1-70ca-3505-5cdf9f2c54539'),
+             ('Art and Science', 'b9ba95ec-3041-708f-44b0-bfad168dc0ca'),
+             ('Social Studies in Malaysia', '09fad50c-b061-7089-68b0-b900aca5551e'),
+             ('Social Studies in Malaysia', '094ae51c-7091-70da-8ed5-3c8665a3968b'),
+             ('Creative Design', 'c9eac5bc-d071-70f5-9ece-1ace39ec4cf2'))
+         AS seed (title, user_id)
+         JOIN posts ON posts.title = seed.title;
+
+COMMIT;
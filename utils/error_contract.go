@@ -7,27 +7,51 @@ import (
 
 // APIError represents a structured error message.
 type APIError struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Detail  interface{} `json:"detail,omitempty"` // Changed to interface{} to support different data types
+	Code      int         `json:"code"`
+	ErrorCode string      `json:"error_code"` // Stable machine-readable code, e.g. "not_found"
+	Message   string      `json:"message"`
+	Detail    interface{} `json:"detail,omitempty"` // Changed to interface{} to support different data types
+	RequestID string      `json:"request_id,omitempty"`
 }
 
 // NewAPIError creates a new APIError instance.
-func NewAPIError(code int, msg string, detail interface{}) *APIError {
-	return &APIError{Code: code, Message: msg, Detail: detail}
+func NewAPIError(code int, errorCode string, msg string, detail interface{}) *APIError {
+	return &APIError{Code: code, ErrorCode: errorCode, Message: msg, Detail: detail}
+}
+
+// Error implements the error interface so handlers can return an APIError.
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// WithDetail returns a copy of the error carrying the given detail, leaving shared errors untouched.
+func (e *APIError) WithDetail(detail interface{}) *APIError {
+	return NewAPIError(e.Code, e.ErrorCode, e.Message, detail)
+}
+
+// WithRequestID returns a copy of the error naming the request it answers
+func (e *APIError) WithRequestID(requestID string) *APIError {
+	copied := *e
+	copied.RequestID = requestID
+	return &copied
+}
+
+// NewValidationError formats validation errors into an APIError.
+func NewValidationError(validationErrors map[string]any) *APIError {
+	return NewAPIError(http.StatusBadRequest, "validation_failed", "Validation failed", validationErrors)
 }
 
 // HandleValidationError handles validation errors and formats them into an APIError.
 func HandleValidationError(c echo.Context, validationErrors map[string]any) error {
-	apiError := NewAPIError(http.StatusBadRequest, "Validation failed", validationErrors)
+	apiError := NewValidationError(validationErrors)
 	return c.JSON(apiError.Code, apiError)
 }
 
 // HandleError handles generic API errors.
 func HandleError(c echo.Context, err *APIError, detail ...string) error {
-	// Check if a detail was provided and append it to the error's detail field
+	// Check if a detail was provided and append it to a copy of the error
 	if len(detail) > 0 && detail[0] != "" {
-		err.Detail = detail[0]
+		err = err.WithDetail(detail[0])
 	}
 	return c.JSON(err.Code, err)
 }
@@ -1,16 +1,19 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"io"
 	"net/http"
 )
 
-func RequestGET(url string, headers map[string]string) ([]byte, error) {
+// httpClient traces outgoing requests and passes the trace context on
+var httpClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
 
-	client := new(http.Client)
+func RequestGET(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
 
-	request, err := http.NewRequest("GET", url, nil)
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -19,7 +22,7 @@ func RequestGET(url string, headers map[string]string) ([]byte, error) {
 		request.Header.Set(key, value)
 	}
 
-	response, err := client.Do(request)
+	response, err := httpClient.Do(request)
 	if err != nil {
 		return nil, err
 	}
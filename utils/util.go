@@ -2,7 +2,7 @@ package utils
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"time"
 )
@@ -33,7 +33,7 @@ func ParsePostgresTimestamp(timestamp string) (time.Time, error) {
 	// Try parsing the timestamp with offset format
 	parsedTime, err := time.Parse(timeFormatWithOffset, timestamp)
 	if err != nil {
-		log.Printf("Error parsing timestamp '%s': %v", timestamp, err)
+		slog.Warn("Error parsing timestamp", "timestamp", timestamp, "error", err)
 		return time.Time{}, fmt.Errorf("unable to parse timestamp: %v", err)
 	}
 
@@ -38,6 +38,10 @@ func FormatValidationErrors(err error) map[string]interface{} {
 			}
 
 			// Add the error message to the appropriate field using snake_case fieldName
+			if fieldError.Tag() == "clean" {
+				currentMap[fieldName] = fmt.Sprintf("The %s field contains banned words", fieldName)
+				continue
+			}
 			currentMap[fieldName] = fmt.Sprintf("The %s field is %s", fieldName, fieldError.Tag())
 		}
 	} else {
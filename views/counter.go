@@ -0,0 +1,164 @@
+package views
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store persists aggregated view counts
+type Store interface {
+	IncrementPostViewsBy(ctx context.Context, views map[uint]int) error
+}
+
+// botPattern matches the user agents of crawlers, previewers and scripts
+var botPattern = regexp.MustCompile(`(?i)(bot|crawl|spider|slurp|facebookexternalhit|embedly|preview|headless|lighthouse|curl|wget|python-requests|go-http-client|httpclient|okhttp|java/|libwww|scrapy)`)
+
+// Counter buffers post views in memory and writes them in batches. Each
+// viewer is counted once per post within the dedup window, and bots are ignored.
+type Counter struct {
+	store    Store
+	interval time.Duration
+	window   time.Duration
+
+	mu      sync.Mutex
+	pending map[uint]int
+	seen    map[string]time.Time
+
+	started  atomic.Bool
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewCounter creates a counter flushing to store every interval and counting
+// a viewer once per post within window
+func NewCounter(store Store, interval time.Duration, window time.Duration) *Counter {
+	return &Counter{
+		store:    store,
+		interval: interval,
+		window:   window,
+		pending:  make(map[uint]int),
+		seen:     make(map[string]time.Time),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// ViewerKey identifies a viewer by user ID, or by a hash of IP and user agent
+// for anonymous requests
+func ViewerKey(userID string, ip string, userAgent string) string {
+	if userID != "" {
+		return "user:" + userID
+	}
+	sum := sha256.Sum256([]byte(ip + "|" + userAgent))
+	return "anon:" + hex.EncodeToString(sum[:16])
+}
+
+// IsBot reports whether the user agent belongs to a crawler or a script.
+// Requests without a user agent are treated as bots.
+func IsBot(userAgent string) bool {
+	return strings.TrimSpace(userAgent) == "" || botPattern.MatchString(userAgent)
+}
+
+// Record buffers a view and reports whether it was counted
+func (c *Counter) Record(postID uint, viewerKey string, userAgent string) bool {
+	if IsBot(userAgent) {
+		return false
+	}
+
+	now := time.Now()
+	key := fmt.Sprintf("%d:%s", postID, viewerKey)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if seenAt, ok := c.seen[key]; ok && now.Sub(seenAt) < c.window {
+		return false
+	}
+
+	c.seen[key] = now
+	c.pending[postID]++
+	return true
+}
+
+// Start flushes the buffer every interval until Close is called
+func (c *Counter) Start() {
+	if c.started.Swap(true) {
+		return
+	}
+
+	go func() {
+		defer close(c.stopped)
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.Flush(context.Background()); err != nil {
+					slog.Error("Failed to flush post views", "error", err)
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Flush writes the buffered views. On failure the views are kept for the
+// next flush.
+func (c *Counter) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	batch := c.pending
+	c.pending = make(map[uint]int)
+
+	// Forget viewers outside the dedup window
+	now := time.Now()
+	for key, seenAt := range c.seen {
+		if now.Sub(seenAt) >= c.window {
+			delete(c.seen, key)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := c.store.IncrementPostViewsBy(ctx, batch); err != nil {
+		c.mu.Lock()
+		for postID, count := range batch {
+			c.pending[postID] += count
+		}
+		c.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Close stops the flush loop and writes the remaining views
+func (c *Counter) Close(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+
+	if c.started.Load() {
+		select {
+		case <-c.stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return c.Flush(ctx)
+}
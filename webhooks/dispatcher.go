@@ -0,0 +1,287 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types sent to webhook endpoints
+const (
+	TypePostCreated    = "post.created"
+	TypePostDeleted    = "post.deleted"
+	TypePostLiked      = "post.liked"
+	TypePostUnliked    = "post.unliked"
+	TypeCommentCreated = "comment.created"
+	TypeCommentUpdated = "comment.updated"
+	TypeCommentDeleted = "comment.deleted"
+)
+
+// Types lists the event types endpoints can subscribe to
+var Types = []string{
+	TypePostCreated, TypePostDeleted, TypePostLiked, TypePostUnliked,
+	TypeCommentCreated, TypeCommentUpdated, TypeCommentDeleted,
+}
+
+// Headers set on every delivery
+const (
+	HeaderEventID   = "X-Webhook-Event-Id"  // Outbox event ID, the same on retries and replays
+	HeaderEventType = "X-Webhook-Event"     // One of Types
+	HeaderTimestamp = "X-Webhook-Timestamp" // Unix time of the attempt
+	HeaderSignature = "X-Webhook-Signature" // "sha256=" followed by the hex HMAC
+)
+
+// maxErrorBody bounds how much of a failed response is kept as the error
+const maxErrorBody = 512
+
+// Store holds the outbox deliveries
+type Store interface {
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]data.DueWebhookDelivery, error)
+	MarkWebhookDelivered(ctx context.Context, deliveryID uint, statusCode int) error
+	MarkWebhookFailed(ctx context.Context, deliveryID uint, statusCode int, message string, retryAt *time.Time) error
+}
+
+// Config tunes the dispatcher
+type Config struct {
+	// PollInterval is how often the outbox is checked for due deliveries
+	PollInterval time.Duration
+	// BatchSize caps the deliveries sent concurrently in one round
+	BatchSize int
+	// Timeout bounds every request to an endpoint
+	Timeout time.Duration
+	// MaxAttempts is how often a delivery is tried before it is dead
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled for every
+	// later one up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Dispatcher sends the events of the outbox to the webhook endpoints. Every
+// request carries an HMAC-SHA256 signature of "<timestamp>.<body>" keyed with
+// the endpoint secret; see Sign. Failed deliveries are retried with
+// exponential backoff and marked dead after MaxAttempts.
+type Dispatcher struct {
+	store  Store
+	config Config
+	client *http.Client
+
+	started  atomic.Bool
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewDispatcher creates a dispatcher delivering the outbox of store
+func NewDispatcher(store Store, config Config) *Dispatcher {
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+	if config.BatchSize < 1 {
+		config.BatchSize = 20
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 8
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = 30 * time.Second
+	}
+	if config.MaxBackoff < config.InitialBackoff {
+		config.MaxBackoff = 6 * time.Hour
+	}
+	return &Dispatcher{
+		store:   store,
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Sign returns the signature of a delivery body sent at timestamp, as set in
+// HeaderSignature. Receivers recompute it to authenticate the request.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret generates a random endpoint secret
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Start delivers due events every poll interval until Close is called
+func (d *Dispatcher) Start() {
+	if d.started.Swap(true) {
+		return
+	}
+
+	go func() {
+		defer close(d.stopped)
+
+		ticker := time.NewTicker(d.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// Keep going while full batches come back
+				for {
+					sent, err := d.Dispatch(context.Background())
+					if err != nil {
+						slog.Error("Failed to dispatch webhooks", "error", err)
+					}
+					if err != nil || sent < d.config.BatchSize || d.stopping() {
+						break
+					}
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Dispatch sends one batch of due deliveries and returns how many were
+// attempted
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	// Claims outlive the requests, so another dispatcher doesn't retry a
+	// delivery still in flight
+	lease := 2*d.config.Timeout + time.Minute
+	deliveries, err := d.store.ClaimWebhookDeliveries(ctx, d.config.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery data.DueWebhookDelivery) {
+			defer wg.Done()
+			d.deliver(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// deliver sends one delivery and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery data.DueWebhookDelivery) {
+	statusCode, err := d.send(ctx, delivery)
+	if err == nil {
+		if err := d.store.MarkWebhookDelivered(ctx, delivery.ID, statusCode); err != nil {
+			slog.ErrorContext(ctx, "Failed to record webhook delivery", "delivery", delivery.ID, "error", err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if delivery.Attempts < d.config.MaxAttempts {
+		at := time.Now().Add(d.backoff(delivery.Attempts))
+		retryAt = &at
+	} else {
+		slog.WarnContext(ctx, "Webhook delivery is dead", "delivery", delivery.ID, "url", delivery.URL, "attempts", delivery.Attempts, "error", err)
+	}
+
+	if err := d.store.MarkWebhookFailed(ctx, delivery.ID, statusCode, err.Error(), retryAt); err != nil {
+		slog.ErrorContext(ctx, "Failed to record webhook delivery", "delivery", delivery.ID, "error", err)
+	}
+}
+
+// send posts the event to the endpoint and returns the response status.
+// Anything but a 2xx response is an error.
+func (d *Dispatcher) send(ctx context.Context, delivery data.DueWebhookDelivery) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "iducate-community-webhooks")
+	req.Header.Set(HeaderEventID, strconv.FormatUint(uint64(delivery.Event.ID), 10))
+	req.Header.Set(HeaderEventType, delivery.Event.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s: %s", resp.Status, bytes.TrimSpace(snippet))
+	}
+
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait after the given number of attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.config.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= d.config.MaxBackoff {
+			return d.config.MaxBackoff
+		}
+	}
+	return wait
+}
+
+func (d *Dispatcher) stopping() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the dispatch loop, waiting for the deliveries in flight
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+
+	if d.started.Load() {
+		select {
+		case <-d.stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ahmad-mufied/iducate-community-service/data"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore hands out the given deliveries once and records the outcomes
+type fakeStore struct {
+	mu         sync.Mutex
+	due        []data.DueWebhookDelivery
+	delivered  map[uint]int
+	failed     map[uint]failure
+	claimLease time.Duration
+}
+
+type failure struct {
+	statusCode int
+	message    string
+	retryAt    *time.Time
+}
+
+func newFakeStore(due ...data.DueWebhookDelivery) *fakeStore {
+	return &fakeStore{due: due, delivered: make(map[uint]int), failed: make(map[uint]failure)}
+}
+
+func (s *fakeStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]data.DueWebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.claimLease = lease
+	if limit > len(s.due) {
+		limit = len(s.due)
+	}
+	claimed := s.due[:limit]
+	s.due = s.due[limit:]
+	return claimed, nil
+}
+
+func (s *fakeStore) MarkWebhookDelivered(ctx context.Context, deliveryID uint, statusCode int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delivered[deliveryID] = statusCode
+	return nil
+}
+
+func (s *fakeStore) MarkWebhookFailed(ctx context.Context, deliveryID uint, statusCode int, message string, retryAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed[deliveryID] = failure{statusCode: statusCode, message: message, retryAt: retryAt}
+	return nil
+}
+
+func delivery(id uint, url string, attempts int) data.DueWebhookDelivery {
+	return data.DueWebhookDelivery{
+		ID:       id,
+		Attempts: attempts,
+		URL:      url,
+		Secret:   "secret",
+		Event: data.OutboxEvent{
+			ID:      7,
+			Type:    TypeCommentCreated,
+			PostID:  3,
+			Payload: json.RawMessage(`{"comment_id":1}`),
+		},
+	}
+}
+
+func testConfig() Config {
+	return Config{Timeout: time.Second, MaxAttempts: 3, InitialBackoff: time.Minute, MaxBackoff: time.Hour}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	signature := Sign("secret", 1700000000, body)
+
+	if !strings.HasPrefix(signature, "sha256=") || len(signature) != len("sha256=")+64 {
+		t.Fatalf("got %q, want sha256= and a hex SHA-256", signature)
+	}
+	if Sign("secret", 1700000000, body) != signature {
+		t.Fatal("signature isn't deterministic")
+	}
+	for name, other := range map[string]string{
+		"secret":    Sign("other", 1700000000, body),
+		"timestamp": Sign("secret", 1700000001, body),
+		"body":      Sign("secret", 1700000000, []byte(`{"id":2}`)),
+	} {
+		if other == signature {
+			t.Errorf("changing the %s kept the signature", name)
+		}
+	}
+}
+
+func TestDispatchDeliversSignedEvents(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	store := newFakeStore(delivery(1, server.URL, 1))
+	sent, err := NewDispatcher(store, testConfig()).Dispatch(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("got %d sent and error %v, want 1 and none", sent, err)
+	}
+	if store.delivered[1] != http.StatusNoContent {
+		t.Fatalf("got delivered %v and failed %v, want delivery 1 delivered", store.delivered, store.failed)
+	}
+
+	// The receiver can authenticate the request from its headers
+	timestamp, err := strconv.ParseInt(got.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.Get(HeaderSignature) != Sign("secret", timestamp, gotBody) {
+		t.Fatal("signature doesn't match the body")
+	}
+	if got.Header.Get(HeaderEventID) != "7" || got.Header.Get(HeaderEventType) != TypeCommentCreated {
+		t.Fatalf("got event %q of type %q, want 7 of %s", got.Header.Get(HeaderEventID), got.Header.Get(HeaderEventType), TypeCommentCreated)
+	}
+
+	var event data.OutboxEvent
+	if err := json.Unmarshal(gotBody, &event); err != nil || event.ID != 7 || string(event.Payload) != `{"comment_id":1}` {
+		t.Fatalf("got body %s, want the outbox event", gotBody)
+	}
+}
+
+func TestDispatchRetriesFailuresWithBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	store := newFakeStore(delivery(1, server.URL, 2))
+	before := time.Now()
+	if _, err := NewDispatcher(store, testConfig()).Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	failed, ok := store.failed[1]
+	if !ok || failed.statusCode != http.StatusServiceUnavailable || !strings.Contains(failed.message, "try later") {
+		t.Fatalf("got %+v, want a 503 failure with the response body", failed)
+	}
+
+	// Second attempt failed, so the third waits twice the initial backoff
+	if failed.retryAt == nil {
+		t.Fatal("failed delivery isn't retried")
+	}
+	if wait := failed.retryAt.Sub(before); wait < 2*time.Minute || wait > 2*time.Minute+time.Second {
+		t.Fatalf("retry in %s, want 2m", wait)
+	}
+}
+
+func TestDispatchUnreachableEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	store := newFakeStore(delivery(1, url, 1))
+	if _, err := NewDispatcher(store, testConfig()).Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if failed := store.failed[1]; failed.statusCode != 0 || failed.retryAt == nil {
+		t.Fatalf("got %+v, want a retried failure without status", failed)
+	}
+}
+
+func TestDispatchMarksLastAttemptDead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	store := newFakeStore(delivery(1, server.URL, 3))
+	if _, err := NewDispatcher(store, testConfig()).Dispatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if failed, ok := store.failed[1]; !ok || failed.retryAt != nil {
+		t.Fatalf("got %+v, want a dead delivery", failed)
+	}
+}
+
+func TestDispatchBatches(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	store := newFakeStore(delivery(1, server.URL, 1), delivery(2, server.URL, 1), delivery(3, server.URL, 1))
+	config := testConfig()
+	config.BatchSize = 2
+	dispatcher := NewDispatcher(store, config)
+
+	for _, want := range []int{2, 1, 0} {
+		sent, err := dispatcher.Dispatch(context.Background())
+		if err != nil || sent != want {
+			t.Fatalf("got %d sent and error %v, want %d", sent, err, want)
+		}
+	}
+	if len(store.delivered) != 3 {
+		t.Fatalf("got %d delivered, want 3", len(store.delivered))
+	}
+
+	// Claims outlive the requests in flight
+	if store.claimLease <= config.Timeout {
+		t.Fatalf("claimed for %s, want longer than the %s timeout", store.claimLease, config.Timeout)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(newFakeStore(), Config{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+
+	for attempts, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  5 * time.Second,
+		40: 5 * time.Second,
+	} {
+		if got := d.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestCloseWithoutStart(t *testing.T) {
+	d := NewDispatcher(newFakeStore(), testConfig())
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}